@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type sessionInfo struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"user_id"`
+	Provider   string    `json:"provider"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// handleLocalLogin serves POST /auth/local/login for users with a password.
+// When two-factor authentication is enabled the TOTP code is required too.
+func handleLocalLogin(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var login struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		query := "SELECT id, COALESCE(password_hash, ''), COALESCE(totp_secret, ''), totp_enabled, totp_last_step FROM users WHERE email = ?"
+
+		var userID int
+		var passwordHash, totpSecret string
+		var totpEnabled bool
+		var lastStep int64
+		err := db.QueryRow(query, login.Email).Scan(&userID, &passwordHash, &totpSecret, &totpEnabled, &lastStep)
+		if err != nil && err != sql.ErrNoRows {
+			fmt.Printf("Error getting user %s: %v\n", login.Email, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if passwordHash == "" || bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(login.Password)) != nil {
+			writeError(w, http.StatusUnauthorized, "invalid email or password")
+			return
+		}
+
+		if totpEnabled {
+			if login.Code == "" {
+				writeError(w, http.StatusUnauthorized, "two-factor code required")
+				return
+			}
+			step, ok := verifyTOTP(totpSecret, login.Code, lastStep)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "invalid two-factor code")
+				return
+			}
+			if _, err := db.Exec("UPDATE users SET totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+				fmt.Printf("Error updating user %d: %v\n", userID, err)
+			}
+		}
+
+		token, err := createSession(db, r, userID, "local")
+		if err != nil {
+			fmt.Printf("Error creating session for %s: %v\n", login.Email, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		setSessionCookie(w, r, token)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleTOTPSetup serves POST /api/account/totp/setup. It generates a new
+// secret that only takes effect once confirmed through handleTOTPEnable.
+func handleTOTPSetup(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "only available for logged in users")
+			return
+		}
+
+		var email string
+		var enabled bool
+		err := db.QueryRow("SELECT email, totp_enabled FROM users WHERE id = ?", userID).Scan(&email, &enabled)
+		if err != nil {
+			fmt.Printf("Error getting user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if enabled {
+			writeError(w, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+
+		secret := newTOTPSecret()
+		if _, err := db.Exec("UPDATE users SET totp_secret = ? WHERE id = ?", secret, userID); err != nil {
+			fmt.Printf("Error updating user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"secret": secret, "url": totpURL(secret, email)})
+	}
+}
+
+// handleTOTPEnable serves POST /api/account/totp/enable and handleTOTPDisable
+// POST /api/account/totp/disable. Both need a current code.
+func handleTOTPEnable(db *sql.DB) http.HandlerFunc {
+	return handleTOTPToggle(db, true)
+}
+
+func handleTOTPDisable(db *sql.DB) http.HandlerFunc {
+	return handleTOTPToggle(db, false)
+}
+
+func handleTOTPToggle(db *sql.DB, enable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "only available for logged in users")
+			return
+		}
+
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		var secret string
+		var lastStep int64
+		err := db.QueryRow("SELECT COALESCE(totp_secret, ''), totp_last_step FROM users WHERE id = ?", userID).Scan(&secret, &lastStep)
+		if err != nil {
+			fmt.Printf("Error getting user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if secret == "" {
+			writeError(w, http.StatusConflict, "two-factor authentication is not set up")
+			return
+		}
+
+		step, ok := verifyTOTP(secret, body.Code, lastStep)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid two-factor code")
+			return
+		}
+
+		query := "UPDATE users SET totp_enabled = ?, totp_last_step = ? WHERE id = ?"
+		if !enable {
+			query = "UPDATE users SET totp_enabled = ?, totp_last_step = ?, totp_secret = NULL WHERE id = ?"
+		}
+		if _, err := db.Exec(query, enable, step, userID); err != nil {
+			fmt.Printf("Error updating user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleListSessions serves GET /api/sessions. Logged in users see their own
+// sessions; with the API token sessions of any user can be listed with ?user_id=.
+func handleListSessions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			userID = intQuery(r, "user_id", 0)
+		}
+
+		query := "SELECT token_hash, user_id, provider, COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at, last_seen_at, expires_at FROM sessions WHERE (? = 0 OR user_id = ?) AND expires_at > NOW() ORDER BY last_seen_at DESC"
+
+		rows, err := db.Query(query, userID, userID)
+		if err != nil {
+			fmt.Printf("Error getting sessions: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer rows.Close()
+
+		sessions := []sessionInfo{}
+		for rows.Next() {
+			var s sessionInfo
+			if err := rows.Scan(&s.ID, &s.UserID, &s.Provider, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+				fmt.Printf("Error reading session: %v\n", err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			sessions = append(sessions, s)
+		}
+
+		writeJSON(w, http.StatusOK, sessions)
+	}
+}
+
+// handleRevokeSession serves DELETE /api/sessions/{id}. Users can only revoke
+// their own sessions.
+func handleRevokeSession(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := "DELETE FROM sessions WHERE token_hash = ?"
+		args := []any{r.PathValue("id")}
+		if userID, ok := requestUser(r); ok {
+			query += " AND user_id = ?"
+			args = append(args, userID)
+		}
+
+		res, err := db.Exec(query, args...)
+		if err != nil {
+			fmt.Printf("Error revoking session: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeError(w, http.StatusNotFound, "session not found")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleRevokeUserSessions serves DELETE /api/users/{id}/sessions, for signing
+// a user out everywhere when a login leaked. Only available with the API token.
+func handleRevokeUserSessions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", r.PathValue("id"))
+		if err != nil {
+			fmt.Printf("Error revoking sessions: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		n, _ := res.RowsAffected()
+		writeJSON(w, http.StatusOK, map[string]int64{"revoked": n})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"syscall"
+	"time"
+)
+
+type adhocCheck struct {
+	URL            string `json:"url"`
+	Method         string `json:"method"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	ExpectedStatus int    `json:"expected_status"`
+	MaxBodyBytes   int64  `json:"max_body_bytes"`
+	Trace          bool   `json:"trace"`
+}
+
+type adhocSSL struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Version   string    `json:"version"`
+}
+
+type adhocResult struct {
+	URL            string      `json:"url"`
+	Up             bool        `json:"up"`
+	StatusCode     int         `json:"status_code,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	ResponseTimeMs float64     `json:"response_time_ms"`
+	BodyBytes      int         `json:"body_bytes"`
+	FinalURL       string      `json:"final_url,omitempty"`
+	SSL            *adhocSSL   `json:"ssl,omitempty"`
+	Trace          *checkTrace `json:"trace,omitempty"`
+}
+
+// publicIP reports whether ip is on the internet, as opposed to loopback,
+// private or link-local addresses.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// publicAddress refuses connections to addresses that aren't public. It runs
+// after DNS resolution for every connection, redirects included, so a name
+// that resolves differently on the second lookup can't get through either.
+func publicAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
+
+// runAdhocCheck runs a single check without touching the database, the same
+// way checkWebsite requests a website.
+func runAdhocCheck(ctx context.Context, check adhocCheck) adhocResult {
+	result := adhocResult{URL: check.URL}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, check.Method, asciiURL(check.URL), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var trace *checkTrace
+	if check.Trace {
+		req, trace = traceRequest(req)
+		result.Trace = trace
+	}
+
+	start := time.Now()
+	client := checkClient(websiteSettings{}, trace)
+	followRedirects(client, check.URL, maxRedirects)
+	d := &net.Dialer{Timeout: 30 * time.Second, Control: publicAddress}
+	client.Transport = &http.Transport{
+		DialContext:         d.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   true,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.ResponseTimeMs = msSince(start)
+		result.Error = err.Error()
+		if trace != nil {
+			trace.finish(nil, nil, err)
+		}
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, err := readBody(resp, check.MaxBodyBytes)
+	result.ResponseTimeMs = msSince(start)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if trace != nil {
+		trace.finish(resp, body, err)
+	}
+
+	result.StatusCode = resp.StatusCode
+	result.BodyBytes = len(body)
+	result.FinalURL = resp.Request.URL.String()
+	result.Up = err == nil && resp.StatusCode == check.ExpectedStatus
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		result.SSL = &adhocSSL{
+			Issuer:    cert.Issuer.String(),
+			Subject:   cert.Subject.String(),
+			ExpiresAt: cert.NotAfter,
+			Version:   tls.VersionName(resp.TLS.Version),
+		}
+	}
+
+	return result
+}
+
+// handleRunCheck serves POST /api/checks/run. It checks a URL right away and
+// returns the result without creating a monitor. URLs that resolve to loopback,
+// private or link-local addresses are refused.
+func handleRunCheck() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		check := adhocCheck{
+			Method:         http.MethodGet,
+			TimeoutSeconds: 30,
+			ExpectedStatus: http.StatusOK,
+			MaxBodyBytes:   maxBodyBytes,
+		}
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		u, err := neturl.Parse(check.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, http.StatusBadRequest, "url must be an absolute http or https URL")
+			return
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(r.Context(), asciiHost(u.Hostname()))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("resolving %s: %v", u.Hostname(), err))
+			return
+		}
+		for _, addr := range addrs {
+			if !publicIP(addr.IP) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s resolves to %s, which is not a public address", u.Hostname(), addr.IP))
+				return
+			}
+		}
+		if check.TimeoutSeconds <= 0 || check.TimeoutSeconds > 120 {
+			check.TimeoutSeconds = 30
+		}
+		if check.MaxBodyBytes <= 0 || check.MaxBodyBytes > maxBodyBytes {
+			check.MaxBodyBytes = maxBodyBytes
+		}
+
+		writeJSON(w, http.StatusOK, runAdhocCheck(r.Context(), check))
+	}
+}
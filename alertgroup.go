@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type pendingAlert struct {
+	url    string
+	status string
+}
+
+var (
+	pendingAlertsMu sync.Mutex
+	pendingAlerts   = make(map[string][]pendingAlert)
+)
+
+// queueClientAlert holds a downtime email for the client of the website until
+// the check cycle is done, so flushClientAlerts can send one email per client.
+func queueClientAlert(db *sql.DB, url, status string) {
+	clientEmail, err := getClientEmail(db, url)
+	if err != nil {
+		fmt.Printf("Error getting client email for %s: %v\n", url, err)
+		return
+	}
+
+	pendingAlertsMu.Lock()
+	pendingAlerts[clientEmail] = append(pendingAlerts[clientEmail], pendingAlert{url: url, status: status})
+	pendingAlertsMu.Unlock()
+}
+
+func flushClientAlerts(db *sql.DB) {
+	pendingAlertsMu.Lock()
+	alerts := pendingAlerts
+	pendingAlerts = make(map[string][]pendingAlert)
+	pendingAlertsMu.Unlock()
+
+	for clientEmail, sites := range alerts {
+		if len(sites) == 1 {
+			sendEmailToClient(db, sites[0].url, sites[0].status)
+			sendPush(db, clientEmail, fmt.Sprintf("%s is down", sites[0].url), sites[0].status, sites[0].url)
+			continue
+		}
+
+		var list strings.Builder
+		for _, site := range sites {
+			fmt.Fprintf(&list, "- %s\n   Status: %s\n", site.url, site.status)
+		}
+
+		subject := fmt.Sprintf("ALERT!!!: %d websites are Down", len(sites))
+		body := fmt.Sprintf("Dear user,\n\nThe following websites are currently down:\n\n%s\nPlease check them ASAP", list.String())
+		sendEmail(clientEmail, subject, body)
+		sendPush(db, clientEmail, fmt.Sprintf("%d websites are down", len(sites)), strings.TrimSpace(list.String()), "")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var apiToken string
+
+// startAPI serves the JSON API on API_ADDR. Every request needs API_TOKEN as a
+// bearer token or a dashboard session; without a token configured the API is
+// not started at all. Routes that manage websites and configuration only take
+// the API token, signed in users only see the websites of their client.
+// Read-only reporting and dashboard routes query readDB, which is the primary
+// unless a read replica is configured.
+func startAPI(db, readDB *sql.DB) {
+	addr := os.Getenv("API_ADDR")
+	if addr == "" {
+		return
+	}
+	apiToken = os.Getenv("API_TOKEN")
+	if apiToken == "" {
+		fmt.Println("API_ADDR is set but API_TOKEN is empty, not starting the API")
+		return
+	}
+
+	loadIdentityProviders()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", handleHealth(db))
+	mux.HandleFunc("GET /auth/{provider}/login", handleLogin())
+	mux.HandleFunc("GET /auth/{provider}/callback", handleLoginCallback(db))
+	mux.HandleFunc("POST /auth/logout", handleLogout(db))
+	mux.HandleFunc("POST /auth/local/login", handleLocalLogin(db))
+	mux.HandleFunc("POST /api/account/totp/setup", requireAuth(db, handleTOTPSetup(db)))
+	mux.HandleFunc("POST /api/account/totp/enable", requireAuth(db, handleTOTPEnable(db)))
+	mux.HandleFunc("POST /api/account/totp/disable", requireAuth(db, handleTOTPDisable(db)))
+	mux.HandleFunc("GET /api/sessions", requireAuth(db, handleListSessions(db)))
+	mux.HandleFunc("DELETE /api/sessions/{id}", requireAuth(db, handleRevokeSession(db)))
+	mux.HandleFunc("DELETE /api/users/{id}/sessions", requireToken(handleRevokeUserSessions(db)))
+	mux.HandleFunc("GET /api/status-codes", requireAuth(db, handleStatusCodes(readDB)))
+	mux.HandleFunc("POST /api/websites", requireToken(handleAddWebsite(db)))
+	mux.HandleFunc("POST /api/websites/import", requireToken(handleImportWebsites(db)))
+	mux.HandleFunc("GET /api/websites/duplicates", requireToken(handleDuplicateWebsites(readDB)))
+	mux.HandleFunc("POST /api/websites/bulk", requireToken(handleBulkWebsites(db)))
+	mux.HandleFunc("POST /api/websites/debug", requireToken(handleSetDebug(db)))
+	mux.HandleFunc("GET /api/websites/debug-logs", requireToken(handleDebugLogs(readDB)))
+	mux.HandleFunc("POST /api/checks/run", requireToken(handleRunCheck()))
+	mux.HandleFunc("PUT /api/websites/tags", requireToken(handleSetTags(db)))
+	mux.HandleFunc("GET /api/signals", requireToken(handleSignals(readDB)))
+	mux.HandleFunc("GET /api/incidents", requireAuth(db, handleIncidents(readDB)))
+	mux.HandleFunc("PUT /api/incidents/{id}/postmortem", requireToken(handleSetPostmortem(db)))
+	mux.HandleFunc("GET /api/reliability", requireAuth(db, handleReliability(readDB)))
+	mux.HandleFunc("GET /api/compare", requireAuth(db, handleCompare(readDB)))
+	mux.HandleFunc("GET /api/expiring", requireAuth(db, handleExpiring(readDB)))
+	mux.HandleFunc("GET /api/reviews/quarterly", requireAuth(db, handleQuarterlyReview(readDB)))
+	mux.HandleFunc("GET /api/websites/schema", requireToken(handleGetResponseSchema(db)))
+	mux.HandleFunc("PUT /api/websites/schema", requireToken(handleSetResponseSchema(db)))
+	mux.HandleFunc("GET /api/push/devices", requireAuth(db, handleListPushDevices(db)))
+	mux.HandleFunc("POST /api/push/devices", requireAuth(db, handleRegisterPushDevice(db)))
+	mux.HandleFunc("DELETE /api/push/devices/{id}", requireAuth(db, handleDeletePushDevice(db)))
+	mux.HandleFunc("GET /public/sla", handlePublicSLA(readDB))
+	mux.HandleFunc("GET /public/sla/jwks.json", handleSLAKeys)
+	mux.HandleFunc("POST /public/sla/verify", handleVerifySLA)
+	mux.HandleFunc("GET /webpush-sw.js", handleWebPushWorker)
+	mux.HandleFunc("GET /api/webpush/key", handleWebPushKey)
+	mux.HandleFunc("POST /api/webpush/subscriptions", requireAuth(db, handleWebPushSubscribe(db)))
+	mux.HandleFunc("DELETE /api/webpush/subscriptions", requireAuth(db, handleWebPushUnsubscribe(db)))
+	mux.HandleFunc("GET /api/watch", requireAuth(db, handleListWatched(db)))
+	mux.HandleFunc("PUT /api/watch", requireAuth(db, handleWatch(db, true)))
+	mux.HandleFunc("DELETE /api/watch", requireAuth(db, handleWatch(db, false)))
+	mux.HandleFunc("POST /api/channels/verify", requireToken(handleVerifyChannels(db)))
+	mux.HandleFunc("GET /api/jobs", requireToken(handleJobs()))
+	mux.HandleFunc("POST /api/jobs/{name}/run", requireToken(handleRunJob(db)))
+	mux.HandleFunc("GET /api/events", requireAuth(db, handleEvents(readDB)))
+	mux.HandleFunc("GET /api/notifications", requireToken(handleNotifications(readDB)))
+	mux.HandleFunc("GET /api/regions", requireAuth(db, handleRegions(readDB)))
+	mux.HandleFunc("GET /status", requireAuth(db, handleStatusPage(readDB)))
+	mux.HandleFunc("GET /public/status/{slug}", handlePublicStatusPage(readDB))
+	mux.HandleFunc("GET /api/schedule", requireToken(handleSchedule(readDB)))
+	mux.HandleFunc("GET /api/maintenance", requireToken(handleMaintenanceWindows(readDB)))
+	mux.HandleFunc("GET /api/escalation-policies", requireToken(handleEscalationPolicies(db)))
+	mux.HandleFunc("PUT /api/escalation-policies/{name}", requireToken(handleSetEscalationPolicy(db)))
+	mux.HandleFunc("DELETE /api/escalation-policies/{name}", requireToken(handleDeleteEscalationPolicy(db)))
+	mux.HandleFunc("PUT /api/websites/escalation-policy", requireToken(handleSetWebsiteEscalation(db)))
+	mux.HandleFunc("GET /api/templates", requireToken(handleCheckTemplates(db)))
+	mux.HandleFunc("PUT /api/templates/{name}", requireToken(handleSetCheckTemplate(db)))
+	mux.HandleFunc("DELETE /api/templates/{name}", requireToken(handleDeleteCheckTemplate(db)))
+	mux.HandleFunc("PUT /api/websites/template", requireToken(handleSetWebsiteTemplate(db)))
+	mux.HandleFunc("POST /api/maintenance", requireToken(handleCreateMaintenanceWindow(db)))
+	mux.HandleFunc("DELETE /api/maintenance/{id}", requireToken(handleDeleteMaintenanceWindow(db)))
+
+	go func() {
+		fmt.Printf("API listening on %s\n", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Printf("Error running the API: %v\n", err)
+			sendSlackMessage("WARNING --> API stopped: " + err.Error())
+		}
+	}()
+}
+
+func requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Error writing API response: %v\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func intQuery(r *http.Request, name string, fallback int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// queryTimeRange reads the from and to query parameters (YYYY-MM-DD or
+// RFC 3339). Missing values default to the last `fallback` until now.
+func queryTimeRange(r *http.Request, fallback time.Duration) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.Add(-fallback)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %v", err)
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to: %v", err)
+		}
+		to = t
+	}
+
+	return from, to, nil
+}
+
+// parseQueryTime reads an RFC 3339 time or a date.
+func parseQueryTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
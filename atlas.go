@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// When our probe opens an incident, RIPE Atlas probes around the world are
+// asked to connect to the website too, so an incident the client disputes
+// comes with a third-party view: a TLS handshake for https websites, a TCP
+// traceroute to the port for http ones. The probes resolve the host name
+// themselves. It needs RIPE_ATLAS_KEY, an API key allowed to create
+// measurements; RIPE_ATLAS_PROBES (default 10) and RIPE_ATLAS_AREA (WW,
+// West, North-Central, South-Central, North-East or South-East, default WW)
+// choose the probes. Measurements cost Atlas credits.
+const atlasAPI = "https://atlas.ripe.net/api/v2"
+
+var (
+	atlasWait    = 2 * time.Minute
+	atlasTimeout = 15 * time.Minute
+)
+
+type incidentConfirmation struct {
+	Provider      string     `json:"provider"`
+	MeasurementID int64      `json:"measurement_id"`
+	Measurement   string     `json:"measurement"`
+	RequestedAt   time.Time  `json:"requested_at"`
+	CompletedAt   *time.Time `json:"completed_at"`
+	Probes        *int       `json:"probes"`
+	Reachable     *int       `json:"reachable"`
+	MedianRTTMs   *float64   `json:"median_rtt_ms"`
+	ProbeRTTMs    *float64   `json:"probe_rtt_ms"`
+	Summary       *string    `json:"summary"`
+}
+
+func atlasProbes() int {
+	if n, err := strconv.Atoi(os.Getenv("RIPE_ATLAS_PROBES")); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// requestConfirmation starts an Atlas measurement for the incident that just
+// opened for the website.
+func requestConfirmation(db *sql.DB, url string) {
+	key := os.Getenv("RIPE_ATLAS_KEY")
+	if key == "" || getWebsiteSettings(db, url).InMaintenance {
+		return
+	}
+
+	var incidentID int
+	err := db.QueryRow("SELECT id FROM incidents WHERE website_url = ? AND ended_at IS NULL ORDER BY started_at DESC LIMIT 1", url).Scan(&incidentID)
+	if err != nil {
+		fmt.Printf("Error getting incident for RIPE Atlas measurement of %s: %v\n", url, err)
+		return
+	}
+
+	u, err := neturl.Parse(url)
+	if err != nil {
+		fmt.Printf("Invalid website URL %s: %v\n", url, err)
+		return
+	}
+	host := asciiHost(u.Hostname())
+	definition := map[string]any{
+		"af":               4,
+		"target":           host,
+		"resolve_on_probe": true,
+		"description":      "UptimeMonitor confirmation of " + url,
+	}
+	if u.Scheme == "https" {
+		definition["type"] = "sslcert"
+		definition["hostname"] = host
+		definition["port"] = 443
+	} else {
+		definition["type"] = "traceroute"
+		definition["protocol"] = "TCP"
+		definition["port"] = 80
+	}
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		definition["port"] = port
+	}
+
+	area := os.Getenv("RIPE_ATLAS_AREA")
+	if area == "" {
+		area = "WW"
+	}
+	payload, err := json.Marshal(map[string]any{
+		"definitions": []any{definition},
+		"probes":      []any{map[string]any{"type": "area", "value": area, "requested": atlasProbes()}},
+		"is_oneoff":   true,
+	})
+	if err != nil {
+		return
+	}
+
+	var created struct {
+		Measurements []int64 `json:"measurements"`
+	}
+	if err := atlasRequest(key, http.MethodPost, "/measurements/", payload, &created); err != nil {
+		fmt.Printf("Error creating RIPE Atlas measurement for %s: %v\n", url, err)
+		return
+	}
+	if len(created.Measurements) == 0 {
+		fmt.Printf("RIPE Atlas created no measurement for %s\n", url)
+		return
+	}
+
+	query := "INSERT INTO incident_confirmations (incident_id, provider, measurement_id, measurement, requested_at) VALUES (?, 'ripe-atlas', ?, ?, NOW())"
+	if _, err := db.Exec(query, incidentID, created.Measurements[0], definition["type"]); err != nil {
+		fmt.Printf("Error saving RIPE Atlas measurement for %s: %v\n", url, err)
+	}
+}
+
+func atlasRequest(key, method, path string, payload []byte, result any) error {
+	req, err := http.NewRequest(method, atlasAPI+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Key "+key)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Error struct {
+				Detail string `json:"detail"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &failure) == nil && failure.Error.Detail != "" {
+			return fmt.Errorf("RIPE Atlas returned %s: %s", resp.Status, failure.Error.Detail)
+		}
+		return fmt.Errorf("RIPE Atlas returned %s", resp.Status)
+	}
+	return json.Unmarshal(data, result)
+}
+
+// atlasResult is the part of the sslcert and traceroute results we use.
+type atlasResult struct {
+	DstAddr string   `json:"dst_addr"`
+	Cert    []string `json:"cert"`
+	RT      float64  `json:"rt"`
+	Result  []struct {
+		Result []struct {
+			From string  `json:"from"`
+			RTT  float64 `json:"rtt"`
+		} `json:"result"`
+	} `json:"result"`
+}
+
+// reached reports whether the probe could connect and how long it took.
+func (r atlasResult) reached(measurement string) (bool, float64) {
+	if measurement == "sslcert" {
+		return len(r.Cert) > 0, r.RT
+	}
+	if len(r.Result) == 0 || r.DstAddr == "" {
+		return false, 0
+	}
+	for _, reply := range r.Result[len(r.Result)-1].Result {
+		if reply.From == r.DstAddr {
+			return true, reply.RTT
+		}
+	}
+	return false, 0
+}
+
+// runConfirmations collects the results of the Atlas measurements once the
+// probes had time to report, and posts what they saw next to our probe.
+func runConfirmations(db *sql.DB) error {
+	key := os.Getenv("RIPE_ATLAS_KEY")
+	if key == "" {
+		return nil
+	}
+
+	query := `SELECT incident_confirmations.id, incident_confirmations.measurement_id, incident_confirmations.measurement,
+		incident_confirmations.requested_at, incidents.website_url, incidents.started_at
+		FROM incident_confirmations JOIN incidents ON incidents.id = incident_confirmations.incident_id
+		WHERE incident_confirmations.completed_at IS NULL AND incident_confirmations.requested_at < ?`
+	rows, err := db.Query(query, time.Now().Add(-atlasWait))
+	if err != nil {
+		return fmt.Errorf("getting pending RIPE Atlas measurements: %v", err)
+	}
+	type pending struct {
+		id, measurementID int64
+		measurement, url  string
+		requested, start  time.Time
+	}
+	var measurements []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.measurementID, &p.measurement, &p.requested, &p.url, &p.start); err != nil {
+			rows.Close()
+			return fmt.Errorf("reading pending RIPE Atlas measurements: %v", err)
+		}
+		measurements = append(measurements, p)
+	}
+	rows.Close()
+
+	for _, p := range measurements {
+		var results []atlasResult
+		if err := atlasRequest(key, http.MethodGet, fmt.Sprintf("/measurements/%d/results/", p.measurementID), nil, &results); err != nil {
+			fmt.Printf("Error getting RIPE Atlas results for %s: %v\n", p.url, err)
+			continue
+		}
+		timedOut := time.Since(p.requested) > atlasTimeout
+		if len(results) < atlasProbes() && !timedOut {
+			continue
+		}
+
+		var rtts []float64
+		for _, r := range results {
+			if ok, rtt := r.reached(p.measurement); ok {
+				rtts = append(rtts, rtt)
+			}
+		}
+		var median *float64
+		if len(rtts) > 0 {
+			sort.Float64s(rtts)
+			m := rtts[len(rtts)/2]
+			median = &m
+		}
+
+		var probeRTT sql.NullFloat64
+		err := db.QueryRow("SELECT AVG(response_time) * 1000 FROM check_results WHERE website_url = ? AND up = 1 AND checked_at BETWEEN ? AND ?", p.url, p.start.Add(-time.Hour), p.start).Scan(&probeRTT)
+		if err != nil {
+			fmt.Printf("Error getting response times of %s: %v\n", p.url, err)
+		}
+
+		summary := confirmationSummary(len(results), len(rtts), median, probeRTT)
+		query := "UPDATE incident_confirmations SET completed_at = NOW(), probes = ?, reachable = ?, median_rtt_ms = ?, probe_rtt_ms = ?, summary = ? WHERE id = ?"
+		if _, err := db.Exec(query, len(results), len(rtts), median, probeRTT, summary, p.id); err != nil {
+			fmt.Printf("Error saving RIPE Atlas results for %s: %v\n", p.url, err)
+			continue
+		}
+		recordEvent(eventIncident, p.url, "RIPE Atlas: "+summary, map[string]any{"measurement_id": p.measurementID, "probes": len(results), "reachable": len(rtts)})
+		sendSlackMessage(fmt.Sprintf("MONITOR --> RIPE Atlas on %s: %s", p.url, summary))
+	}
+	return nil
+}
+
+func confirmationSummary(probes, reachable int, median *float64, probeRTT sql.NullFloat64) string {
+	if probes == 0 {
+		return "no probe reported a result"
+	}
+
+	s := fmt.Sprintf("%d of %d probes could connect", reachable, probes)
+	if median != nil {
+		s += fmt.Sprintf(" (median %.0f ms", *median)
+		if probeRTT.Valid {
+			s += fmt.Sprintf(", our probe %.0f ms in the hour before the incident", probeRTT.Float64)
+		}
+		s += ")"
+	}
+	switch {
+	case reachable == 0:
+		return s + ", they confirm the outage"
+	case reachable*2 >= probes:
+		return s + ", the outage may be local to our probe"
+	}
+	return s + ", the outage is partial"
+}
+
+func getIncidentConfirmations(db *sql.DB, incidentID int) ([]incidentConfirmation, error) {
+	query := "SELECT provider, measurement_id, measurement, requested_at, completed_at, probes, reachable, median_rtt_ms, probe_rtt_ms, summary FROM incident_confirmations WHERE incident_id = ? ORDER BY requested_at"
+
+	rows, err := db.Query(query, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	confirmations := []incidentConfirmation{}
+	for rows.Next() {
+		var c incidentConfirmation
+		if err := rows.Scan(&c.Provider, &c.MeasurementID, &c.Measurement, &c.RequestedAt, &c.CompletedAt, &c.Probes, &c.Reachable, &c.MedianRTTMs, &c.ProbeRTTMs, &c.Summary); err != nil {
+			return nil, err
+		}
+		confirmations = append(confirmations, c)
+	}
+
+	return confirmations, rows.Err()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const sessionCookie = "session"
+
+// Sessions end after sessionLifetime, or earlier when unused for sessionIdleTimeout.
+var sessionLifetime = 7 * 24 * time.Hour
+var sessionIdleTimeout = 12 * time.Hour
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createSession stores a new dashboard session for the user. Only the hash of
+// the token is kept in the database.
+func createSession(db *sql.DB, r *http.Request, userID int, provider string) (string, error) {
+	token := randomToken()
+
+	query := "INSERT INTO sessions (token_hash, user_id, provider, created_at, last_seen_at, expires_at, user_agent, ip_address) VALUES (?, ?, ?, NOW(), NOW(), ?, ?, ?)"
+	_, err := db.Exec(query, hashToken(token), userID, provider, time.Now().Add(sessionLifetime), r.UserAgent(), clientIP(r))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sessionUser returns the user of a valid, unexpired session token and marks
+// the session as used.
+func sessionUser(db *sql.DB, token string) (int, error) {
+	query := "SELECT user_id FROM sessions WHERE token_hash = ? AND expires_at > NOW() AND last_seen_at > ?"
+
+	var userID int
+	err := db.QueryRow(query, hashToken(token), time.Now().Add(-sessionIdleTimeout)).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.Exec("UPDATE sessions SET last_seen_at = NOW() WHERE token_hash = ?", hashToken(token))
+	if err != nil {
+		fmt.Printf("Error updating session: %v\n", err)
+	}
+
+	return userID, nil
+}
+
+// requestUser returns the logged in user of a request. Requests made with the
+// API token have no user.
+func requestUser(r *http.Request) (int, bool) {
+	userID, ok := r.Context().Value(userContextKey).(int)
+	return userID, ok
+}
+
+// allowedWebsite reports whether the request may see the website. The API
+// token sees every website, a signed in user only the websites of their client.
+func allowedWebsite(db *sql.DB, r *http.Request, url string) bool {
+	userID, ok := requestUser(r)
+	if !ok {
+		return true
+	}
+
+	var allowed bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM websites WHERE website_url = ? AND client = ?)", url, userID).Scan(&allowed)
+	if err != nil {
+		fmt.Printf("Error checking access of user %d to %s: %v\n", userID, url, err)
+		return false
+	}
+	return allowed
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(publicURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// requireAuth lets a request through with either the API token as a bearer
+// token or a valid dashboard session cookie.
+func requireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	token := requireToken(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			if userID, err := sessionUser(db, c.Value); err == nil {
+				next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, userID)))
+				return
+			}
+		}
+		token(w, r)
+	}
+}
+
+// handleLogin serves GET /auth/{provider}/login and redirects to the provider.
+func handleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := identityProviders[r.PathValue("provider")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown identity provider")
+			return
+		}
+
+		state, nonce := randomToken(), randomToken()
+		http.SetCookie(w, &http.Cookie{
+			Name:     "login_state",
+			Value:    state + "." + nonce,
+			Path:     "/auth/",
+			MaxAge:   600,
+			HttpOnly: true,
+			Secure:   r.TLS != nil || strings.HasPrefix(publicURL(), "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		http.Redirect(w, r, provider.AuthURL(state, nonce), http.StatusFound)
+	}
+}
+
+// handleLoginCallback serves GET /auth/{provider}/callback. Only users that
+// already exist in the users table can log in.
+func handleLoginCallback(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("provider")
+		provider, ok := identityProviders[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown identity provider")
+			return
+		}
+
+		c, err := r.Cookie("login_state")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "login expired, please try again")
+			return
+		}
+		state, nonce, _ := strings.Cut(c.Value, ".")
+		if r.URL.Query().Get("state") != state {
+			writeError(w, http.StatusBadRequest, "invalid login state")
+			return
+		}
+
+		email, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), nonce)
+		if err != nil {
+			fmt.Printf("Error logging in with %s: %v\n", name, err)
+			writeError(w, http.StatusUnauthorized, "login failed")
+			return
+		}
+
+		var userID int
+		err = db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+		if err != nil {
+			fmt.Printf("Login with %s for unknown user %s\n", name, email)
+			writeError(w, http.StatusForbidden, "no account for "+email)
+			return
+		}
+
+		token, err := createSession(db, r, userID, name)
+		if err != nil {
+			fmt.Printf("Error creating session for %s: %v\n", email, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		setSessionCookie(w, r, token)
+		http.Redirect(w, r, publicURL()+"/", http.StatusFound)
+	}
+}
+
+// handleLogout serves POST /auth/logout.
+func handleLogout(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			_, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(c.Value))
+			if err != nil {
+				fmt.Printf("Error deleting session: %v\n", err)
+			}
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
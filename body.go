@@ -0,0 +1,13 @@
+package main
+
+import (
+	"io"
+	"net/http"
+)
+
+// readBody reads at most limit bytes of the response body, so a huge homepage
+// or an endless stream doesn't eat gigabytes of egress. Whatever is left is
+// never downloaded because the connection is closed with the body.
+func readBody(resp *http.Response, limit int64) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// bulkFilter selects websites by tag, client and status. The filters combine,
+// and an empty filter only matches everything with "all": true. Status is up,
+// degraded, down or paused.
+type bulkFilter struct {
+	All    bool   `json:"all"`
+	Tag    string `json:"tag"`
+	Client int    `json:"client"`
+	Status string `json:"status"`
+}
+
+func (f bulkFilter) empty() bool {
+	return f.Tag == "" && f.Client == 0 && f.Status == ""
+}
+
+func (f bulkFilter) validate() error {
+	switch f.Status {
+	case "", "up", "degraded", "down", "paused":
+		return nil
+	}
+	return fmt.Errorf("unknown status %q, use up, degraded, down or paused", f.Status)
+}
+
+func bulkWebsites(db *sql.DB, f bulkFilter) ([]string, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT websites.website_url FROM websites WHERE TRUE"
+	var args []any
+	if f.Tag != "" {
+		query += " AND EXISTS (SELECT 1 FROM website_tags WHERE website_tags.website_url = websites.website_url AND website_tags.tag = ?)"
+		args = append(args, strings.ToLower(strings.TrimSpace(f.Tag)))
+	}
+	if f.Client != 0 {
+		query += " AND websites.client = ?"
+		args = append(args, f.Client)
+	}
+	switch f.Status {
+	case "up":
+		query += " AND NOT websites.paused AND websites.website_status = 'Up'"
+	case "degraded":
+		query += " AND NOT websites.paused AND websites.website_status LIKE 'Degraded%'"
+	case "down":
+		query += " AND NOT websites.paused AND websites.website_status != 'Up' AND websites.website_status NOT LIKE 'Degraded%' AND websites.website_status NOT LIKE 'Skipped%'"
+	case "paused":
+		query += " AND websites.paused"
+	}
+	query += " ORDER BY websites.website_url"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+type bulkRequest struct {
+	Filter bulkFilter `json:"filter"`
+	// Action is pause, resume, set_severity, set_escalation_policy,
+	// set_template, add_tags or remove_tags.
+	Action   string   `json:"action"`
+	Severity *string  `json:"severity"`
+	Policy   *string  `json:"policy"`
+	Template *string  `json:"template"`
+	Tags     []string `json:"tags"`
+	DryRun   bool     `json:"dry_run"`
+}
+
+type bulkResult struct {
+	Action   string   `json:"action"`
+	DryRun   bool     `json:"dry_run"`
+	Matched  int      `json:"matched"`
+	Changed  int      `json:"changed"`
+	Websites []string `json:"websites"`
+}
+
+// bulkStatements returns the statements that apply the action to one website,
+// each taking its extra argument, if any, and then the URL.
+func bulkStatements(db *sql.DB, req bulkRequest) ([]string, []any, error) {
+	switch req.Action {
+	case "pause":
+		return []string{"UPDATE websites SET paused = TRUE WHERE website_url = ?"}, nil, nil
+	case "resume":
+		return []string{"UPDATE websites SET paused = FALSE WHERE website_url = ?"}, nil, nil
+
+	case "set_severity":
+		var severity *string
+		if req.Severity != nil && strings.TrimSpace(*req.Severity) != "" {
+			s := strings.ToLower(strings.TrimSpace(*req.Severity))
+			if err := validSeverity(s); err != nil {
+				return nil, nil, err
+			}
+			severity = &s
+		}
+		return []string{"UPDATE websites SET severity = ? WHERE website_url = ?"}, []any{severity}, nil
+
+	case "set_escalation_policy":
+		var policyID *int
+		if req.Policy != nil {
+			var id int
+			err := db.QueryRow("SELECT id FROM escalation_policies WHERE name = ?", *req.Policy).Scan(&id)
+			if err == sql.ErrNoRows {
+				return nil, nil, fmt.Errorf("escalation policy %q not found", *req.Policy)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			policyID = &id
+		}
+		return []string{"UPDATE websites SET escalation_policy_id = ? WHERE website_url = ?"}, []any{policyID}, nil
+
+	case "set_template":
+		var templateID *int
+		if req.Template != nil {
+			var id int
+			err := db.QueryRow("SELECT id FROM check_templates WHERE name = ?", *req.Template).Scan(&id)
+			if err == sql.ErrNoRows {
+				return nil, nil, fmt.Errorf("check template %q not found", *req.Template)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			templateID = &id
+		}
+		return []string{"UPDATE websites SET template_id = ? WHERE website_url = ?"}, []any{templateID}, nil
+
+	case "add_tags", "remove_tags":
+		statement := "INSERT IGNORE INTO website_tags (tag, website_url) VALUES (?, ?)"
+		if req.Action == "remove_tags" {
+			statement = "DELETE FROM website_tags WHERE tag = ? AND website_url = ?"
+		}
+		var statements []string
+		var args []any
+		for _, tag := range req.Tags {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				statements = append(statements, statement)
+				args = append(args, tag)
+			}
+		}
+		if len(statements) == 0 {
+			return nil, nil, fmt.Errorf("tags are required")
+		}
+		return statements, args, nil
+	}
+	return nil, nil, fmt.Errorf("unknown action %q, use pause, resume, set_severity, set_escalation_policy, set_template, add_tags or remove_tags", req.Action)
+}
+
+// handleBulkWebsites serves POST /api/websites/bulk with {"filter": {"tag":
+// "shop"}, "action": "pause"} and applies the action to every website the
+// filter matches. With "dry_run": true it only returns the websites it would
+// change.
+func handleBulkWebsites(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req bulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Filter.empty() && !req.Filter.All {
+			writeError(w, http.StatusBadRequest, `filter on tag, client or status, or pass "all": true`)
+			return
+		}
+		if err := req.Filter.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		statements, args, err := bulkStatements(db, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		urls, err := bulkWebsites(db, req.Filter)
+		if err != nil {
+			fmt.Printf("Error fetching websites for bulk %s: %v\n", req.Action, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		result := bulkResult{Action: req.Action, DryRun: req.DryRun, Matched: len(urls), Websites: []string{}}
+		if req.DryRun {
+			result.Websites = urls
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			fmt.Printf("Error starting bulk %s: %v\n", req.Action, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer tx.Rollback()
+
+		for _, url := range urls {
+			var changed bool
+			for i, statement := range statements {
+				stmtArgs := []any{url}
+				if i < len(args) {
+					stmtArgs = []any{args[i], url}
+				}
+				res, err := tx.Exec(statement, stmtArgs...)
+				if err != nil {
+					fmt.Printf("Error applying bulk %s to %s: %v\n", req.Action, url, err)
+					writeError(w, http.StatusInternalServerError, "database error")
+					return
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					changed = true
+				}
+			}
+			if changed {
+				result.Changed++
+				result.Websites = append(result.Websites, url)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			fmt.Printf("Error committing bulk %s: %v\n", req.Action, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		details := map[string]any{"action": req.Action, "filter": req.Filter, "severity": req.Severity, "policy": req.Policy, "template": req.Template, "tags": req.Tags}
+		for _, url := range result.Websites {
+			recordEvent(eventConfig, url, fmt.Sprintf("Bulk %s by %s", req.Action, requestActor(r)), details)
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
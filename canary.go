@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var canaryInterval = 10 * time.Minute
+
+type canaryPair struct {
+	ID              int
+	Name            string
+	PrimaryURL      string
+	SecondaryURL    string
+	CompareStatus   bool
+	JSONFields      []string
+	MaxLatencyRatio float64
+	Diverged        bool
+}
+
+type canarySide struct {
+	status  int
+	latency time.Duration
+	body    []byte
+	err     error
+}
+
+// getCanaryPairs returns the canary pairs, leaving out pairs with a side that
+// is a paused website.
+func getCanaryPairs(db *sql.DB) ([]canaryPair, error) {
+	query := `SELECT id, name, primary_url, secondary_url, compare_status, COALESCE(json_fields, ''), COALESCE(max_latency_ratio, 0), diverged FROM canary_pairs
+		WHERE NOT EXISTS (SELECT 1 FROM websites WHERE websites.paused AND websites.website_url IN (canary_pairs.primary_url, canary_pairs.secondary_url))`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []canaryPair
+	for rows.Next() {
+		var p canaryPair
+		var fields string
+		if err := rows.Scan(&p.ID, &p.Name, &p.PrimaryURL, &p.SecondaryURL, &p.CompareStatus, &fields, &p.MaxLatencyRatio, &p.Diverged); err != nil {
+			return nil, err
+		}
+		for _, f := range strings.Split(fields, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				p.JSONFields = append(p.JSONFields, f)
+			}
+		}
+		pairs = append(pairs, p)
+	}
+
+	return pairs, rows.Err()
+}
+
+func runCanaryChecks(db *sql.DB) error {
+	pairs, err := getCanaryPairs(db)
+	if err != nil {
+		return fmt.Errorf("fetching canary pairs: %v", err)
+	}
+
+	for _, p := range pairs {
+		checkCanaryPair(db, p)
+	}
+	return nil
+}
+
+// checkCanaryPair requests both environments of a pair and alerts when their
+// responses drift apart, and again once they match again. Each side is
+// requested with the settings of its website, and nothing is sent while
+// either side is in maintenance.
+func checkCanaryPair(db *sql.DB, p canaryPair) {
+	primarySettings := getWebsiteSettings(db, p.PrimaryURL)
+	secondarySettings := getWebsiteSettings(db, p.SecondaryURL)
+	primary := fetchCanarySide(p.PrimaryURL, primarySettings)
+	secondary := fetchCanarySide(p.SecondaryURL, secondarySettings)
+
+	differences := compareCanary(p, primary, secondary)
+	diverged := len(differences) > 0
+
+	if diverged != p.Diverged {
+		_, err := db.Exec("UPDATE canary_pairs SET diverged = ?, last_checked = NOW() WHERE id = ?", diverged, p.ID)
+		if err != nil {
+			fmt.Printf("Error updating canary pair %s: %v\n", p.Name, err)
+		}
+
+		if primarySettings.InMaintenance || secondarySettings.InMaintenance {
+			return
+		}
+		if diverged {
+			message := fmt.Sprintf("WARNING: %s (%s vs %s) diverged:\n%s", p.Name, p.PrimaryURL, p.SecondaryURL, strings.Join(differences, "\n"))
+			fmt.Println(message)
+			sendSlackMessage(message)
+		} else {
+			sendSlackMessage(fmt.Sprintf("MONITOR --> %s (%s vs %s) match again", p.Name, p.PrimaryURL, p.SecondaryURL))
+		}
+		return
+	}
+
+	_, err := db.Exec("UPDATE canary_pairs SET last_checked = NOW() WHERE id = ?", p.ID)
+	if err != nil {
+		fmt.Printf("Error updating canary pair %s: %v\n", p.Name, err)
+	}
+}
+
+func fetchCanarySide(url string, settings websiteSettings) canarySide {
+	client := checkClient(settings, nil)
+	if client.Timeout == 0 {
+		client.Timeout = 30 * time.Second
+	}
+
+	start := time.Now()
+	resp, err := client.Get(asciiURL(url))
+	if err != nil {
+		return canarySide{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := readBody(resp, settings.MaxBodyBytes)
+	return canarySide{status: resp.StatusCode, latency: time.Since(start), body: body, err: err}
+}
+
+func compareCanary(p canaryPair, primary, secondary canarySide) []string {
+	var differences []string
+
+	if primary.err != nil || secondary.err != nil {
+		if (primary.err == nil) != (secondary.err == nil) {
+			differences = append(differences, fmt.Sprintf("request error: %v vs %v", primary.err, secondary.err))
+		}
+		return differences
+	}
+
+	if p.CompareStatus && primary.status != secondary.status {
+		differences = append(differences, fmt.Sprintf("status: %d vs %d", primary.status, secondary.status))
+	}
+
+	if len(p.JSONFields) > 0 {
+		var primaryJSON, secondaryJSON any
+		primaryErr := json.Unmarshal(primary.body, &primaryJSON)
+		secondaryErr := json.Unmarshal(secondary.body, &secondaryJSON)
+		if primaryErr != nil || secondaryErr != nil {
+			differences = append(differences, fmt.Sprintf("JSON body: %v vs %v", primaryErr, secondaryErr))
+		} else {
+			for _, field := range p.JSONFields {
+				a, _ := json.Marshal(jsonPath(primaryJSON, field))
+				b, _ := json.Marshal(jsonPath(secondaryJSON, field))
+				if string(a) != string(b) {
+					differences = append(differences, fmt.Sprintf("%s: %s vs %s", field, a, b))
+				}
+			}
+		}
+	}
+
+	if p.MaxLatencyRatio > 0 && primary.latency > 0 && secondary.latency > 0 {
+		ratio := float64(secondary.latency) / float64(primary.latency)
+		if ratio < 1 {
+			ratio = 1 / ratio
+		}
+		if ratio > p.MaxLatencyRatio {
+			differences = append(differences, fmt.Sprintf("latency: %v vs %v (ratio %.1f)", primary.latency.Round(time.Millisecond), secondary.latency.Round(time.Millisecond), ratio))
+		}
+	}
+
+	return differences
+}
+
+// jsonPath looks up a dot separated path such as "data.version" or "items.0.id".
+func jsonPath(v any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			var i int
+			if _, err := fmt.Sscanf(key, "%d", &i); err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
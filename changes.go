@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlHidden     = regexp.MustCompile(`(?is)<(script|style|noscript)\b.*?</(script|style|noscript)>|<!--.*?-->`)
+	htmlBlockTag   = regexp.MustCompile(`(?i)<(br|p|div|li|tr|h[1-6]|section|article|table|ul|ol)\b[^>]*>|</(p|div|li|tr|h[1-6]|section|article|table|ul|ol)>`)
+	htmlTag        = regexp.MustCompile(`<[^>]*>`)
+	horizontalWS   = regexp.MustCompile(`[ \t\r\f\v]+`)
+	maxDiffLines   = 40
+	maxSnapshotLen = 1 << 20
+)
+
+// normalizeContent turns a body into lines of text that only change when the
+// content does. JSON is rewritten with sorted keys, HTML is reduced to its
+// visible text. Matches of ignore, e.g. a build number or CSRF token, are
+// removed first.
+func normalizeContent(body []byte, ignore *regexp.Regexp) string {
+	if ignore != nil {
+		body = ignore.ReplaceAll(body, nil)
+	}
+
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		// Marshalling maps sorts the keys.
+		if out, err := json.MarshalIndent(v, "", "  "); err == nil {
+			return string(out)
+		}
+	}
+
+	text := string(body)
+	if bytes.Contains(bytes.ToLower(body[:min(len(body), 1024)]), []byte("<html")) {
+		text = htmlHidden.ReplaceAllString(text, "")
+		text = htmlBlockTag.ReplaceAllString(text, "\n")
+		text = htmlTag.ReplaceAllString(text, "")
+		text = html.UnescapeString(text)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(horizontalWS.ReplaceAllString(line, " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// diffLines returns the lines removed from a (-) and added in b (+), based on
+// their longest common subsequence, with at most maxDiffLines lines.
+func diffLines(a, b string) string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// Unchanged lines at the start and end don't need the table.
+	start := 0
+	for start < len(x) && start < len(y) && x[start] == y[start] {
+		start++
+	}
+	endX, endY := len(x), len(y)
+	for endX > start && endY > start && x[endX-1] == y[endY-1] {
+		endX--
+		endY--
+	}
+	x, y = x[start:endX], y[start:endY]
+
+	if len(x)*len(y) > 4_000_000 {
+		return fmt.Sprintf("%d lines changed, too many to compare", max(len(x), len(y)))
+	}
+
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+
+	if len(out) > maxDiffLines {
+		more := len(out) - maxDiffLines
+		out = append(out[:maxDiffLines], fmt.Sprintf("... and %d more lines", more))
+	}
+	return strings.Join(out, "\n")
+}
+
+// checkContentChange compares the body with the one of the previous check for
+// websites with track_changes set, and alerts with a diff when it changed.
+func checkContentChange(db *sql.DB, url string, body []byte, settings websiteSettings) {
+	query := `SELECT websites.track_changes, COALESCE(websites.change_ignore_pattern, ''), COALESCE(content_snapshots.content_hash, ''), COALESCE(content_snapshots.content, '')
+		FROM websites LEFT JOIN content_snapshots ON content_snapshots.website_url = websites.website_url
+		WHERE websites.website_url = ?`
+
+	var track bool
+	var pattern, previousHash, previous string
+	err := db.QueryRow(query, url).Scan(&track, &pattern, &previousHash, &previous)
+	if err != nil {
+		fmt.Printf("Error getting content snapshot for %s: %v\n", url, err)
+		return
+	}
+	if !track {
+		return
+	}
+
+	var ignore *regexp.Regexp
+	if pattern != "" {
+		ignore, err = regexp.Compile(pattern)
+		if err != nil {
+			fmt.Printf("Invalid change_ignore_pattern for %s: %v\n", url, err)
+		}
+	}
+
+	content := truncate(normalizeContent(body, ignore), maxSnapshotLen)
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	if hash == previousHash {
+		return
+	}
+
+	query = "INSERT INTO content_snapshots (website_url, content, content_hash, changed_at) VALUES (?, ?, ?, NOW()) ON DUPLICATE KEY UPDATE content = VALUES(content), content_hash = VALUES(content_hash), changed_at = NOW()"
+	if _, err := db.Exec(query, url, content, hash); err != nil {
+		fmt.Printf("Error saving content snapshot for %s: %v\n", url, err)
+		return
+	}
+
+	// The first snapshot is the baseline.
+	if previousHash == "" || settings.InMaintenance {
+		return
+	}
+
+	diff := diffLines(previous, content)
+	message := fmt.Sprintf("The content of %s changed:\n%s", url, diff)
+	fmt.Println("CONTENT CHANGED --> " + url)
+	sendSlackMessage("WARNING: " + message)
+
+	clientEmail, err := getClientEmail(db, url)
+	if err != nil {
+		fmt.Printf("Error getting client email for %s: %v\n", url, err)
+		return
+	}
+	sendEmail(clientEmail, fmt.Sprintf("ALERT!!!: Content changed on %s", url), "Dear user,\n\n"+message+"\n\nIf you didn't expect this change, please check it ASAP")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var channelCheckInterval = 7 * 24 * time.Hour
+
+type channelCheck struct {
+	Channel string `json:"channel"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// operatorEmail receives the channel checks and alerts about the monitor
+// itself (OPERATOR_EMAIL, or SENDER_EMAIL when it is not set).
+func operatorEmail() string {
+	if v := os.Getenv("OPERATOR_EMAIL"); v != "" {
+		return v
+	}
+	return senderEmail
+}
+
+// verifyChannels sends a test message through Slack and email, and checks the
+// credentials of the push providers. Dedup windows are bypassed, so a check
+// never gets swallowed by an earlier one.
+func verifyChannels() []channelCheck {
+	var checks []channelCheck
+	add := func(channel string, err error) {
+		c := channelCheck{Channel: channel, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		checks = append(checks, c)
+	}
+
+	if ok, _ := notifierEnabled("slack"); ok {
+		add("slack", deliverSlack("MONITOR --> Weekly notification check, no action needed"))
+	}
+	if ok, _ := notifierEnabled("email"); ok && operatorEmail() != "" {
+		add("email", deliverEmail(operatorEmail(), "UptimeMonitor notification check", "This is the weekly check of the email channel of UptimeMonitor. No action is needed."))
+	}
+
+	var platforms []string
+	for platform := range pushProviders {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		add(platform, pushProviders[platform].Verify())
+	}
+
+	return checks
+}
+
+// runChannelChecks verifies the channels once every channelCheckInterval,
+// also across restarts, and alerts through the channels that still work when
+// one of them failed.
+func runChannelChecks(db *sql.DB) error {
+	var last sql.NullTime
+	if err := db.QueryRow("SELECT MAX(checked_at) FROM channel_checks").Scan(&last); err != nil {
+		return fmt.Errorf("getting last channel check: %v", err)
+	}
+	if last.Valid && time.Since(last.Time) < channelCheckInterval {
+		return nil
+	}
+
+	checks := verifyChannels()
+	saveChannelChecks(db, checks)
+	reportChannelChecks(checks)
+	return nil
+}
+
+func saveChannelChecks(db *sql.DB, checks []channelCheck) {
+	for _, c := range checks {
+		_, err := db.Exec("INSERT INTO channel_checks (channel, checked_at, ok, error) VALUES (?, NOW(), ?, NULLIF(?, ''))", c.Channel, c.OK, truncate(c.Error, 1024))
+		if err != nil {
+			fmt.Printf("Error saving channel check for %s: %v\n", c.Channel, err)
+		}
+	}
+}
+
+func reportChannelChecks(checks []channelCheck) {
+	var failed []string
+	working := make(map[string]bool)
+	for _, c := range checks {
+		if c.OK {
+			working[c.Channel] = true
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("- %s: %s", c.Channel, c.Error))
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("Notification channels failed their check, alerts on them won't arrive:\n%s", strings.Join(failed, "\n"))
+	fmt.Println("WARNING --> " + message)
+	if working["slack"] {
+		if err := deliverSlack("WARNING --> " + message); err != nil {
+			fmt.Printf("Error sending Slack message: %v\n", err)
+		}
+	}
+	if working["email"] {
+		if err := deliverEmail(operatorEmail(), "ALERT!!!: UptimeMonitor notification channel failed", "Hello,\n\n"+message+"\n\nPlease check the configuration ASAP"); err != nil {
+			fmt.Printf("Error sending email: %v\n", err)
+		}
+	}
+}
+
+// handleVerifyChannels serves POST /api/channels/verify to run the channel
+// checks right away, e.g. after rotating a webhook.
+func handleVerifyChannels(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := verifyChannels()
+		saveChannelChecks(db, checks)
+		reportChannelChecks(checks)
+		writeJSON(w, http.StatusOK, checks)
+	}
+}
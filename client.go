@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// checkClient returns the client a check uses for the website. Debug traces
+// also record the redirect chain.
+func checkClient(settings websiteSettings, trace *checkTrace) *http.Client {
+	client := &http.Client{Timeout: settings.Timeout}
+	if settings.JumpHost != "" || settings.Network != nil {
+		client.Transport = &http.Transport{
+			DialContext:         checkDialer(settings),
+			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   true,
+		}
+	}
+	if trace != nil {
+		client.CheckRedirect = trace.redirect
+	}
+	return client
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// windowStats are the availability and latency of one or more websites in a
+// window. Latencies are of the checks that were up, as in the signals.
+type windowStats struct {
+	From                time.Time   `json:"from"`
+	To                  time.Time   `json:"to"`
+	UptimePercentage    float64     `json:"uptime_percentage"`
+	SLAUptimePercentage float64     `json:"sla_uptime_percentage"`
+	DowntimeSeconds     float64     `json:"downtime_seconds"`
+	Reliability         reliability `json:"reliability"`
+	Checks              int         `json:"checks"`
+	Failures            int         `json:"failures"`
+	LatencyAvgMs        float64     `json:"latency_avg_ms"`
+	LatencyP95Ms        float64     `json:"latency_p95_ms"`
+
+	websites  int
+	scheduled float64
+	latencies []float64
+}
+
+// add counts one website in the window.
+func (s *windowStats) add(db *sql.DB, url string) error {
+	incidents, err := getIncidents(db, url, s.From, s.To)
+	if err != nil {
+		return err
+	}
+	figures, err := measureUptime(db, url, incidents, s.From, s.To)
+	if err != nil {
+		return err
+	}
+	s.Reliability.add(incidents, s.From, s.To)
+
+	query := "SELECT up, response_time FROM check_results WHERE website_url = ? AND checked_at >= ? AND checked_at < ?"
+	rows, err := db.Query(query, url, s.From, s.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var up bool
+		var responseTime float64
+		if err := rows.Scan(&up, &responseTime); err != nil {
+			return err
+		}
+		s.Checks++
+		if !up {
+			s.Failures++
+			continue
+		}
+		s.latencies = append(s.latencies, responseTime*1000)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.websites++
+	s.DowntimeSeconds += figures.DowntimeSeconds
+	s.scheduled += figures.ScheduledDowntimeSeconds
+	window := s.To.Sub(s.From) * time.Duration(s.websites)
+	down := time.Duration(s.DowntimeSeconds * float64(time.Second))
+	s.UptimePercentage = uptimeFor(down, s.From, s.From.Add(window))
+	s.SLAUptimePercentage = uptimeFor(down-time.Duration(s.scheduled*float64(time.Second)), s.From, s.From.Add(window))
+	s.LatencyAvgMs, s.LatencyP95Ms = latencyStats(s.latencies)
+	return nil
+}
+
+// windowChange is the current window minus the previous one, in percentage
+// points for the uptime.
+type windowChange struct {
+	UptimePercentage    float64 `json:"uptime_percentage"`
+	SLAUptimePercentage float64 `json:"sla_uptime_percentage"`
+	DowntimeSeconds     float64 `json:"downtime_seconds"`
+	Incidents           int     `json:"incidents"`
+	LatencyAvgMs        float64 `json:"latency_avg_ms"`
+	LatencyP95Ms        float64 `json:"latency_p95_ms"`
+}
+
+type windowComparison struct {
+	Current  windowStats  `json:"current"`
+	Previous windowStats  `json:"previous"`
+	Change   windowChange `json:"change"`
+}
+
+func compareWindows(db *sql.DB, urls []string, from, to, previousFrom, previousTo time.Time) (windowComparison, error) {
+	c := windowComparison{
+		Current:  windowStats{From: from, To: to, UptimePercentage: 100, SLAUptimePercentage: 100},
+		Previous: windowStats{From: previousFrom, To: previousTo, UptimePercentage: 100, SLAUptimePercentage: 100},
+	}
+	for _, url := range urls {
+		if err := c.Current.add(db, url); err != nil {
+			return c, err
+		}
+		if err := c.Previous.add(db, url); err != nil {
+			return c, err
+		}
+	}
+
+	c.Change = windowChange{
+		UptimePercentage:    c.Current.UptimePercentage - c.Previous.UptimePercentage,
+		SLAUptimePercentage: c.Current.SLAUptimePercentage - c.Previous.SLAUptimePercentage,
+		DowntimeSeconds:     c.Current.DowntimeSeconds - c.Previous.DowntimeSeconds,
+		Incidents:           c.Current.Reliability.Incidents - c.Previous.Reliability.Incidents,
+		LatencyAvgMs:        c.Current.LatencyAvgMs - c.Previous.LatencyAvgMs,
+		LatencyP95Ms:        c.Current.LatencyP95Ms - c.Previous.LatencyP95Ms,
+	}
+	return c, nil
+}
+
+func tagWebsiteURLs(db *sql.DB, tag string) ([]string, error) {
+	rows, err := db.Query("SELECT website_url FROM website_tags WHERE tag = ? ORDER BY website_url", tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// handleCompare serves GET /api/compare?url=...&from=...&to=... and compares
+// the window (the last 7 days by default) with the one before it, or with
+// previous_from and previous_to when they are given. Instead of url, pass tag
+// for the websites with that tag or client=<id> for those of a client; signed
+// in clients get their own websites and only see their own websites with a
+// tag. The totals are over all the websites, the
+// comparison of each website is in websites.
+func handleCompare(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := queryTimeRange(r, 7*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !to.After(from) {
+			writeError(w, http.StatusBadRequest, "to must be after from")
+			return
+		}
+
+		previousFrom, previousTo := from.Add(-to.Sub(from)), from
+		q := r.URL.Query()
+		if q.Get("previous_from") != "" || q.Get("previous_to") != "" {
+			if q.Get("previous_from") == "" || q.Get("previous_to") == "" {
+				writeError(w, http.StatusBadRequest, "pass both previous_from and previous_to")
+				return
+			}
+			if previousFrom, err = parseQueryTime(q.Get("previous_from")); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid previous_from: %v", err))
+				return
+			}
+			if previousTo, err = parseQueryTime(q.Get("previous_to")); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid previous_to: %v", err))
+				return
+			}
+			if !previousTo.After(previousFrom) {
+				writeError(w, http.StatusBadRequest, "previous_to must be after previous_from")
+				return
+			}
+		}
+
+		var urls []string
+		var scope map[string]any
+		switch {
+		case q.Get("url") != "":
+			if !allowedWebsite(db, r, q.Get("url")) {
+				writeError(w, http.StatusNotFound, "website not found")
+				return
+			}
+			urls = []string{q.Get("url")}
+			scope = map[string]any{"url": q.Get("url")}
+		case q.Get("tag") != "":
+			tagged, err := tagWebsiteURLs(db, q.Get("tag"))
+			if err != nil {
+				fmt.Printf("Error fetching websites with tag %s: %v\n", q.Get("tag"), err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			for _, url := range tagged {
+				if allowedWebsite(db, r, url) {
+					urls = append(urls, url)
+				}
+			}
+			scope = map[string]any{"tag": q.Get("tag")}
+		default:
+			clientID, ok := requestUser(r)
+			if !ok {
+				clientID = intQuery(r, "client", 0)
+			}
+			if clientID == 0 {
+				writeError(w, http.StatusBadRequest, "url, tag or client is required")
+				return
+			}
+			if urls, _, err = clientWebsiteURLs(db, clientID); err != nil {
+				fmt.Printf("Error fetching websites of client %d: %v\n", clientID, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			scope = map[string]any{"client": clientID}
+		}
+
+		total, err := compareWindows(db, urls, from, to, previousFrom, previousTo)
+		if err != nil {
+			fmt.Printf("Error comparing windows: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		websites := make(map[string]windowComparison, len(urls))
+		if len(urls) > 1 {
+			for _, url := range urls {
+				if websites[url], err = compareWindows(db, []string{url}, from, to, previousFrom, previousTo); err != nil {
+					fmt.Printf("Error comparing windows of %s: %v\n", url, err)
+					writeError(w, http.StatusInternalServerError, "database error")
+					return
+				}
+			}
+		}
+
+		scope["total"] = total
+		scope["websites"] = websites
+		writeJSON(w, http.StatusOK, scope)
+	}
+}
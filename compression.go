@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// checkCompression requests the website once per encoding a client may ask
+// for and verifies what comes back: the encoding is the one asked for, the
+// body has the length the server announced and it decompresses. A broken
+// compression setting at a CDN usually only hits the clients that negotiate
+// that encoding, so the plain check never sees it.
+func checkCompression(db *sql.DB, url string, settings websiteSettings) {
+	var enabled bool
+	var previous string
+	err := db.QueryRow("SELECT check_compression, COALESCE(compression_problem, '') FROM websites WHERE website_url = ?", url).Scan(&enabled, &previous)
+	if err != nil {
+		fmt.Printf("Error getting compression settings for %s: %v\n", url, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	client := checkClient(settings, nil)
+	var problems []string
+	for _, encoding := range []string{"gzip", "br", "identity"} {
+		if err := verifyEncoding(client, url, encoding, settings.MaxBodyBytes); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", encoding, err))
+		}
+	}
+	problem := truncate(strings.Join(problems, "\n"), 4096)
+	if problem == previous {
+		return
+	}
+
+	_, err = db.Exec("UPDATE websites SET compression_problem = NULLIF(?, '') WHERE website_url = ?", problem, url)
+	if err != nil {
+		fmt.Printf("Error updating compression problem for %s: %v\n", url, err)
+	}
+
+	if settings.InMaintenance {
+		return
+	}
+	if problem == "" {
+		sendSlackMessage(fmt.Sprintf("MONITOR --> Compressed responses of %s are fine again", url))
+		return
+	}
+	if previous != "" {
+		return
+	}
+
+	message := fmt.Sprintf("Responses of %s are broken for some clients:\n%s", url, problem)
+	fmt.Println("COMPRESSION --> " + message)
+	sendSlackMessage("WARNING: " + message)
+}
+
+func verifyEncoding(client *http.Client, url, encoding string, limit int64) error {
+	req, err := http.NewRequest(http.MethodGet, asciiURL(url), nil)
+	if err != nil {
+		return err
+	}
+	// Setting Accept-Encoding ourselves stops the transport from
+	// decompressing gzip, so we get the bytes as sent.
+	req.Header.Set("Accept-Encoding", encoding)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		// The transport fails the read when the body is shorter than
+		// Content-Length.
+		return fmt.Errorf("reading body with Content-Length %d: %v", resp.ContentLength, err)
+	}
+	if int64(len(raw)) > limit {
+		// Too big to verify.
+		return nil
+	}
+	if resp.ContentLength >= 0 && int64(len(raw)) != resp.ContentLength {
+		return fmt.Errorf("Content-Length is %d but the body has %d bytes", resp.ContentLength, len(raw))
+	}
+
+	contentEncoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch contentEncoding {
+	case "", "identity":
+		if encoding != "identity" && looksCompressed(raw) {
+			return fmt.Errorf("body is compressed without a Content-Encoding header")
+		}
+		return nil
+	case encoding:
+	default:
+		return fmt.Errorf("asked for %s but got Content-Encoding %s", encoding, contentEncoding)
+	}
+
+	var reader io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("body doesn't decompress: %v", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(raw))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, limit))
+	if err != nil {
+		return fmt.Errorf("body doesn't decompress: %v", err)
+	}
+	if looksCompressed(body) {
+		return fmt.Errorf("body is compressed twice")
+	}
+	return nil
+}
+
+// looksCompressed reports whether the body starts with the gzip magic bytes.
+// Brotli has no magic bytes to look for.
+func looksCompressed(body []byte) bool {
+	return len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b
+}
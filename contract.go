@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// schemaURL names the schema in errors. It is never fetched.
+const schemaURL = "https://uptimemonitor.invalid/response.json"
+
+var (
+	schemaCacheMu sync.Mutex
+	schemaCache   = make(map[string]*jsonschema.Schema)
+)
+
+// compileResponseSchema compiles a JSON Schema, or the schema at pointer in an
+// OpenAPI document such as "#/components/schemas/Health". OpenAPI documents
+// have to be JSON, $refs within the document are resolved.
+func compileResponseSchema(schema, pointer string) (*jsonschema.Schema, error) {
+	key := pointer + "\n" + schema
+
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+	if sch, ok := schemaCache[key]; ok {
+		return sch, nil
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %v", err)
+	}
+
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(schemaURL, doc); err != nil {
+		return nil, err
+	}
+	if pointer != "" && !strings.HasPrefix(pointer, "#") {
+		pointer = "#" + pointer
+	}
+	sch, err := c.Compile(schemaURL + pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaCache[key] = sch
+	return sch, nil
+}
+
+func validateResponseBody(schema, pointer string, body []byte) error {
+	sch, err := compileResponseSchema(schema, pointer)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %v", err)
+	}
+
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("response is not valid JSON: %v", err)
+	}
+
+	return sch.Validate(inst)
+}
+
+// checkResponseSchema validates the body of a successful check against the
+// schema of the website. A contract violation doesn't make the website down,
+// it is stored and alerted on its own, once when it starts and once when the
+// responses match the schema again.
+func checkResponseSchema(db *sql.DB, url string, body []byte, settings websiteSettings) {
+	query := `SELECT COALESCE(websites.response_schema, check_templates.response_schema, ''),
+		COALESCE(IF(websites.response_schema IS NULL, check_templates.response_schema_pointer, websites.response_schema_pointer), ''), COALESCE(websites.schema_violation, '')
+		FROM websites LEFT JOIN check_templates ON check_templates.id = websites.template_id WHERE websites.website_url = ?`
+
+	var schema, pointer, previous string
+	err := db.QueryRow(query, url).Scan(&schema, &pointer, &previous)
+	if err != nil {
+		fmt.Printf("Error getting response schema for %s: %v\n", url, err)
+		return
+	}
+	if schema == "" {
+		return
+	}
+
+	var violation string
+	if err := validateResponseBody(schema, pointer, body); err != nil {
+		violation = truncate(err.Error(), 4096)
+	}
+	if violation == previous {
+		return
+	}
+
+	_, err = db.Exec("UPDATE websites SET schema_violation = NULLIF(?, '') WHERE website_url = ?", violation, url)
+	if err != nil {
+		fmt.Printf("Error updating schema violation for %s: %v\n", url, err)
+	}
+
+	if settings.InMaintenance {
+		return
+	}
+	if violation == "" {
+		sendSlackMessage(fmt.Sprintf("MONITOR --> Responses of %s match the schema again", url))
+		return
+	}
+	if previous != "" {
+		// Still violating, only the details changed.
+		return
+	}
+
+	message := fmt.Sprintf("The response of %s doesn't match its schema:\n%s", url, violation)
+	fmt.Println("CONTRACT --> " + message)
+	sendSlackMessage("WARNING: " + message)
+
+	clientEmail, err := getClientEmail(db, url)
+	if err != nil {
+		fmt.Printf("Error getting client email for %s: %v\n", url, err)
+		return
+	}
+	sendEmail(clientEmail, fmt.Sprintf("ALERT!!!: API contract violation for %s", url), "Dear user,\n\n"+message+"\n\nThe website is up, but clients relying on this response may break.")
+}
+
+type responseSchemaBody struct {
+	URL       string          `json:"url"`
+	Schema    json.RawMessage `json:"schema"`
+	Pointer   string          `json:"pointer"`
+	Violation *string         `json:"violation,omitempty"`
+}
+
+// handleGetResponseSchema serves GET /api/websites/schema?url=...
+func handleGetResponseSchema(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+
+		var schema, pointer, violation sql.NullString
+		query := "SELECT response_schema, response_schema_pointer, schema_violation FROM websites WHERE website_url = ?"
+		err := db.QueryRow(query, url).Scan(&schema, &pointer, &violation)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error getting response schema for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		res := responseSchemaBody{URL: url, Pointer: pointer.String}
+		if schema.Valid {
+			res.Schema = json.RawMessage(schema.String)
+		}
+		if violation.Valid {
+			res.Violation = &violation.String
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// handleSetResponseSchema serves PUT /api/websites/schema with {"url": ...,
+// "schema": {...}, "pointer": "#/components/schemas/Health"}. A null schema
+// turns validation off.
+func handleSetResponseSchema(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body responseSchemaBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+			writeError(w, http.StatusBadRequest, "url and schema are required")
+			return
+		}
+
+		var schema *string
+		if len(body.Schema) > 0 && string(body.Schema) != "null" {
+			if _, err := compileResponseSchema(string(body.Schema), body.Pointer); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid schema: "+err.Error())
+				return
+			}
+			s := string(body.Schema)
+			schema = &s
+		}
+
+		query := "UPDATE websites SET response_schema = ?, response_schema_pointer = NULLIF(?, ''), schema_violation = NULL WHERE website_url = ?"
+		res, err := db.Exec(query, schema, body.Pointer, body.URL)
+		if err != nil {
+			fmt.Printf("Error setting response schema for %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+
+		recordEvent(eventConfig, body.URL, "Response schema changed by "+requestActor(r), map[string]any{"pointer": body.Pointer, "enabled": schema != nil})
+		writeJSON(w, http.StatusOK, body)
+	}
+}
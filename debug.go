@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// debugBodyBytes is how much of the response body a debug log keeps.
+const debugBodyBytes = 64 << 10
+
+var maxDebugDuration = 24 * time.Hour
+
+// secretHeaders are kept out of debug logs, which any operator can read.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// redactHeaders returns a copy of h with the values of secretHeaders replaced.
+func redactHeaders(h http.Header) http.Header {
+	redacted := h.Clone()
+	for key := range redacted {
+		if secretHeaders[http.CanonicalHeaderKey(key)] {
+			redacted[key] = []string{"[redacted]"}
+		}
+	}
+	return redacted
+}
+
+type traceEvent struct {
+	At     float64 `json:"at_ms"`
+	Event  string  `json:"event"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+type traceHop struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	Status          string      `json:"status,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+}
+
+// checkTrace records the full exchange of a check while debug mode is on for
+// a website: every request and response in the redirect chain, connection
+// timings and the start of the final body.
+type checkTrace struct {
+	mu      sync.Mutex
+	start   time.Time
+	Events  []traceEvent `json:"events"`
+	Hops    []*traceHop  `json:"hops"`
+	Body    string       `json:"body,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	TotalMs float64      `json:"total_ms"`
+}
+
+func (t *checkTrace) event(name, detail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Events = append(t.Events, traceEvent{At: msSince(t.start), Event: name, Detail: detail})
+}
+
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// traceRequest returns a copy of req that reports to a new checkTrace.
+func traceRequest(req *http.Request) (*http.Request, *checkTrace) {
+	t := &checkTrace{start: time.Now()}
+	t.Hops = append(t.Hops, &traceHop{Method: req.Method, URL: req.URL.String(), RequestHeaders: http.Header{}})
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) { t.event("dns_start", info.Host) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			detail := fmt.Sprint(info.Addrs)
+			if info.Err != nil {
+				detail = info.Err.Error()
+			}
+			t.event("dns_done", detail)
+		},
+		ConnectStart: func(network, addr string) { t.event("connect_start", network+" "+addr) },
+		ConnectDone: func(network, addr string, err error) {
+			detail := network + " " + addr
+			if err != nil {
+				detail += ": " + err.Error()
+			}
+			t.event("connect_done", detail)
+		},
+		TLSHandshakeStart: func() { t.event("tls_start", "") },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			detail := tls.VersionName(state.Version) + " " + tls.CipherSuiteName(state.CipherSuite)
+			if err != nil {
+				detail = err.Error()
+			}
+			t.event("tls_done", detail)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.event("got_conn", fmt.Sprintf("reused=%t", info.Reused))
+		},
+		WroteHeaderField: func(key string, value []string) {
+			if secretHeaders[http.CanonicalHeaderKey(key)] {
+				value = []string{"[redacted]"}
+			}
+			t.mu.Lock()
+			t.Hops[len(t.Hops)-1].RequestHeaders[key] = value
+			t.mu.Unlock()
+		},
+		WroteRequest:         func(info httptrace.WroteRequestInfo) { t.event("wrote_request", "") },
+		GotFirstResponseByte: func() { t.event("first_byte", "") },
+	}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+// redirect records a redirect. Limits are up to followRedirects.
+func (t *checkTrace) redirect(req *http.Request, via []*http.Request) error {
+	t.mu.Lock()
+	last := t.Hops[len(t.Hops)-1]
+	if req.Response != nil {
+		last.Status = req.Response.Status
+		last.ResponseHeaders = redactHeaders(req.Response.Header)
+	}
+	t.Hops = append(t.Hops, &traceHop{Method: req.Method, URL: req.URL.String(), RequestHeaders: http.Header{}})
+	t.mu.Unlock()
+	t.event("redirect", req.URL.String())
+	return nil
+}
+
+func (t *checkTrace) finish(resp *http.Response, body []byte, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if resp != nil {
+		last := t.Hops[len(t.Hops)-1]
+		last.Status = resp.Status
+		last.ResponseHeaders = redactHeaders(resp.Header)
+	}
+	if len(body) > debugBodyBytes {
+		body = body[:debugBodyBytes]
+	}
+	t.Body = string(body)
+	if err != nil {
+		t.Error = err.Error()
+	}
+	t.TotalMs = msSince(t.start)
+}
+
+func saveDebugLog(db *sql.DB, url string, t *checkTrace) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		fmt.Printf("Error encoding debug log for %s: %v\n", url, err)
+		return
+	}
+
+	_, err = db.Exec("INSERT INTO check_debug_logs (website_url, checked_at, log) VALUES (?, NOW(), ?)", url, string(data))
+	if err != nil {
+		fmt.Printf("Error saving debug log for %s: %v\n", url, err)
+	}
+
+	_, err = db.Exec("DELETE FROM check_debug_logs WHERE website_url = ? AND checked_at < NOW() - INTERVAL 7 DAY", url)
+	if err != nil {
+		fmt.Printf("Error pruning debug logs for %s: %v\n", url, err)
+	}
+}
+
+// handleSetDebug serves POST /api/websites/debug with {"url": ..., "minutes": ...}.
+// Debug mode switches itself off after the given time, at most maxDebugDuration.
+// Zero minutes switches it off right away.
+func handleSetDebug(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL     string `json:"url"`
+			Minutes int    `json:"minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+			writeError(w, http.StatusBadRequest, "url and minutes are required")
+			return
+		}
+
+		duration := time.Duration(body.Minutes) * time.Minute
+		if duration > maxDebugDuration {
+			duration = maxDebugDuration
+		}
+
+		var until any
+		if duration > 0 {
+			until = time.Now().Add(duration)
+		}
+
+		res, err := db.Exec("UPDATE websites SET debug_until = ? WHERE website_url = ?", until, body.URL)
+		if err != nil {
+			fmt.Printf("Error setting debug mode for %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+
+		recordEvent(eventConfig, body.URL, "Debug mode changed by "+requestActor(r), map[string]any{"debug_until": until})
+		writeJSON(w, http.StatusOK, map[string]any{"url": body.URL, "debug_until": until})
+	}
+}
+
+// handleDebugLogs serves GET /api/websites/debug-logs?url=...&from=...&to=...
+func handleDebugLogs(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+
+		from, to, err := queryTimeRange(r, 24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		query := "SELECT checked_at, log FROM check_debug_logs WHERE website_url = ? AND checked_at BETWEEN ? AND ? ORDER BY checked_at DESC LIMIT 500"
+		rows, err := db.Query(query, url, from, to)
+		if err != nil {
+			fmt.Printf("Error getting debug logs for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer rows.Close()
+
+		type debugLog struct {
+			CheckedAt time.Time       `json:"checked_at"`
+			Log       json.RawMessage `json:"log"`
+		}
+		logs := []debugLog{}
+		for rows.Next() {
+			var l debugLog
+			var data string
+			if err := rows.Scan(&l.CheckedAt, &data); err != nil {
+				fmt.Printf("Error reading debug log for %s: %v\n", url, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			l.Log = json.RawMessage(data)
+			logs = append(logs, l)
+		}
+
+		writeJSON(w, http.StatusOK, logs)
+	}
+}
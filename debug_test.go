@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{
+		"Authorization": {"Bearer secret"},
+		"Cookie":        {"session=secret"},
+		"Set-Cookie":    {"session=secret; HttpOnly", "other=secret"},
+		"Content-Type":  {"text/html"},
+	}
+	want := http.Header{
+		"Authorization": {"[redacted]"},
+		"Cookie":        {"[redacted]"},
+		"Set-Cookie":    {"[redacted]"},
+		"Content-Type":  {"text/html"},
+	}
+
+	if got := redactHeaders(h); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactHeaders = %v, want %v", got, want)
+	}
+	if h.Get("Authorization") != "Bearer secret" {
+		t.Error("redactHeaders changed the original headers")
+	}
+	if redactHeaders(nil) != nil {
+		t.Error("redactHeaders(nil) isn't nil")
+	}
+}
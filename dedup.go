@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertDedupWindow is how long an identical alert isn't delivered again on the
+// same channel (ALERT_DEDUP_WINDOW, e.g. "10m"). Channels can override it with
+// <CHANNEL>_DEDUP_WINDOW, e.g. SLACK_DEDUP_WINDOW.
+var alertDedupWindow time.Duration
+
+var (
+	dedupMu      sync.Mutex
+	dedupWindows = make(map[string]time.Duration)
+	dedupSent    = make(map[string]time.Time)
+)
+
+// Alerts carry the time they were sent, which shouldn't make them unique.
+var alertTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`)
+
+func loadDedupWindows() {
+	if v := os.Getenv("ALERT_DEDUP_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			fmt.Printf("Invalid ALERT_DEDUP_WINDOW %q: %v\n", v, err)
+		} else {
+			alertDedupWindow = d
+		}
+	}
+
+	for _, channel := range []string{"slack", "email", "push", "webpush"} {
+		name := strings.ToUpper(channel) + "_DEDUP_WINDOW"
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				fmt.Printf("Invalid %s %q: %v\n", name, v, err)
+				continue
+			}
+			dedupWindows[channel] = d
+		}
+	}
+}
+
+// shouldDeliver reports whether an alert should be sent, or whether the same
+// text already went to the same recipient within the dedup window.
+func shouldDeliver(channel, recipient, text string) bool {
+	window, ok := dedupWindows[channel]
+	if !ok {
+		window = alertDedupWindow
+	}
+	if window <= 0 {
+		return true
+	}
+
+	sum := sha256.Sum256([]byte(alertTimestamp.ReplaceAllString(text, "")))
+	key := fmt.Sprintf("%s|%s|%x", channel, recipient, sum)
+	now := time.Now()
+
+	dedupMu.Lock()
+	defer dedupMu.Unlock()
+
+	if sent, ok := dedupSent[key]; ok && now.Sub(sent) < window {
+		return false
+	}
+	dedupSent[key] = now
+
+	if len(dedupSent) > 1000 {
+		for k, sent := range dedupSent {
+			if now.Sub(sent) > 24*time.Hour {
+				delete(dedupSent, k)
+			}
+		}
+	}
+
+	return true
+}
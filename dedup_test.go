@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShouldDeliver(t *testing.T) {
+	defer func(window time.Duration, windows map[string]time.Duration) {
+		alertDedupWindow, dedupWindows = window, windows
+	}(alertDedupWindow, dedupWindows)
+	alertDedupWindow = time.Hour
+	dedupWindows = map[string]time.Duration{"email": 0}
+	dedupSent = make(map[string]time.Time)
+
+	tests := []struct {
+		channel, recipient, text string
+		want                     bool
+	}{
+		{"slack", "", "Website https://example.com is down. Time: 2026-10-14 08:00:00", true},
+		{"slack", "", "Website https://example.com is down. Time: 2026-10-14 08:00:00", false},
+		// Only the time differs, so it's the same alert.
+		{"slack", "", "Website https://example.com is down. Time: 2026-10-14 08:05:00", false},
+		{"slack", "", "Website https://example.org is down. Time: 2026-10-14 08:05:00", true},
+		{"push", "device-1", "Website https://example.com is down. Time: 2026-10-14 08:00:00", true},
+		{"push", "device-2", "Website https://example.com is down. Time: 2026-10-14 08:00:00", true},
+		{"push", "device-1", "Website https://example.com is down. Time: 2026-10-14 08:00:00", false},
+		// Email turned dedup off.
+		{"email", "ops@example.com", "Website https://example.com is down.", true},
+		{"email", "ops@example.com", "Website https://example.com is down.", true},
+	}
+
+	for i, tt := range tests {
+		if got := shouldDeliver(tt.channel, tt.recipient, tt.text); got != tt.want {
+			t.Errorf("%d: shouldDeliver(%q, %q, %q) = %t, want %t", i, tt.channel, tt.recipient, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestShouldDeliverAfterWindow(t *testing.T) {
+	defer func(window time.Duration, windows map[string]time.Duration) {
+		alertDedupWindow, dedupWindows = window, windows
+	}(alertDedupWindow, dedupWindows)
+	alertDedupWindow = 10 * time.Millisecond
+	dedupWindows = map[string]time.Duration{}
+	dedupSent = make(map[string]time.Time)
+
+	if !shouldDeliver("slack", "", "Website down") {
+		t.Fatal("first alert not delivered")
+	}
+	if shouldDeliver("slack", "", "Website down") {
+		t.Fatal("duplicate within the window delivered")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !shouldDeliver("slack", "", "Website down") {
+		t.Error("alert after the window not delivered")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// demoAddr is where the demo targets listen. The TLS target on demoTLSAddr
+// uses the self-signed certificate of httptest, so its checks fail on TLS.
+const demoAddr = "127.0.0.1:8089"
+const demoTLSAddr = "127.0.0.1:8449"
+
+var (
+	demoModeMu sync.Mutex
+	demoModes  = map[string]string{"app": "ok", "api": "ok"}
+)
+
+// startDemo starts a local target with controllable failure modes and adds
+// monitors for it, so a new install can show the whole alerting pipeline
+// without any real website. Switch a target with
+//
+//	curl -X POST 'http://127.0.0.1:8089/demo/mode?target=app&mode=500'
+//
+// where mode is one of ok, slow, 500, down or flaky.
+func startDemo(db *sql.DB) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /demo/mode", handleDemoMode)
+	mux.HandleFunc("/demo/{target}", handleDemoTarget)
+
+	listener, err := net.Listen("tcp", demoAddr)
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, mux)
+
+	tlsTarget := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "You should never see this, the certificate is self-signed")
+	}))
+	tlsTarget.Listener.Close()
+	tlsTarget.Listener, err = net.Listen("tcp", demoTLSAddr)
+	if err != nil {
+		return err
+	}
+	tlsTarget.StartTLS()
+
+	urls := []string{
+		"http://" + demoAddr + "/demo/app",
+		"http://" + demoAddr + "/demo/api",
+		tlsTarget.URL + "/",
+	}
+	for _, url := range urls {
+		_, err := db.Exec("INSERT INTO websites (website_url) SELECT ? FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM websites WHERE website_url = ?)", url, url)
+		if err != nil {
+			return fmt.Errorf("adding demo monitor %s: %v", url, err)
+		}
+	}
+
+	fmt.Println("DEMO --> Demo targets started:")
+	for _, url := range urls {
+		fmt.Println("DEMO -->   " + url)
+	}
+	fmt.Println("DEMO --> Break a target with: curl -X POST 'http://" + demoAddr + "/demo/mode?target=app&mode=500'")
+	fmt.Println("DEMO --> Modes: ok, slow, 500, down, flaky")
+	return nil
+}
+
+func handleDemoMode(w http.ResponseWriter, r *http.Request) {
+	target, mode := r.URL.Query().Get("target"), r.URL.Query().Get("mode")
+
+	switch mode {
+	case "ok", "slow", "500", "down", "flaky":
+	default:
+		http.Error(w, "mode must be ok, slow, 500, down or flaky", http.StatusBadRequest)
+		return
+	}
+
+	demoModeMu.Lock()
+	defer demoModeMu.Unlock()
+	if _, ok := demoModes[target]; !ok {
+		http.Error(w, "unknown target", http.StatusNotFound)
+		return
+	}
+	demoModes[target] = mode
+	fmt.Printf("DEMO --> %s is now %s\n", target, mode)
+	fmt.Fprintf(w, "%s is now %s\n", target, mode)
+}
+
+func handleDemoTarget(w http.ResponseWriter, r *http.Request) {
+	demoModeMu.Lock()
+	mode, ok := demoModes[r.PathValue("target")]
+	demoModeMu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if mode == "flaky" {
+		mode = "ok"
+		if time.Now().Unix()/60%2 == 0 {
+			mode = "500"
+		}
+	}
+
+	switch mode {
+	case "slow":
+		time.Sleep(8 * time.Second)
+	case "500":
+		http.Error(w, "demo failure", http.StatusInternalServerError)
+		return
+	case "down":
+		// Drop the connection without a response, like a crashed backend.
+		if hj, ok := w.(http.Hijacker); ok {
+			conn, _, err := hj.Hijack()
+			if err == nil {
+				conn.Close()
+				return
+			}
+		}
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "<html><body><h1>UptimeMonitor demo</h1></body></html>")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func getWebsiteDependencies(db *sql.DB) (map[string]string, error) {
+	query := "SELECT website_url, depends_on FROM websites WHERE depends_on IS NOT NULL AND depends_on != ''"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := make(map[string]string)
+	for rows.Next() {
+		var url, parent string
+		if err := rows.Scan(&url, &parent); err != nil {
+			return nil, err
+		}
+		deps[url] = parent
+	}
+
+	return deps, rows.Err()
+}
+
+// checkWebsites checks the websites of one cycle. Websites that depend on
+// another website (e.g. the deep API checks behind a load balancer) are checked
+// after it and skipped when it is down, so a big outage doesn't produce an
+// alert for every dependent check. Up to checkConcurrency checks run at the
+// same time, a dependent check waits for its parent.
+func checkWebsites(db *sql.DB, websites []string) {
+	deps, err := getWebsiteDependencies(db)
+	if err != nil {
+		fmt.Printf("Error fetching website dependencies: %v\n", err)
+		deps = nil
+	}
+
+	ordered := orderByDependency(websites, deps)
+	position := make(map[string]int, len(ordered))
+	done := make(map[string]chan struct{}, len(ordered))
+	for i, url := range ordered {
+		position[url] = i
+		done[url] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]bool)
+	slots := make(chan struct{}, checkConcurrency)
+	var wg sync.WaitGroup
+
+	for i, url := range ordered {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			defer close(done[url])
+
+			parent, hasParent := deps[url]
+			// Only wait for parents earlier in the order, a dependency loop
+			// would wait forever otherwise.
+			if p, ok := position[parent]; hasParent && ok && p < i {
+				<-done[parent]
+			}
+
+			if hasParent {
+				mu.Lock()
+				up, checked := results[parent]
+				mu.Unlock()
+				if !checked {
+					up = dependencyUp(db, parent)
+				}
+				if !up {
+					updateWebsiteStatus(db, url, fmt.Sprintf("Skipped (depends on %s which is down)", parent), 0)
+					fmt.Printf("Skipped %s, depends on %s which is down\n", url, parent)
+					mu.Lock()
+					results[url] = false
+					mu.Unlock()
+					return
+				}
+			}
+
+			slots <- struct{}{}
+			start := time.Now()
+			up := checkWebsite(url, db)
+			checkScheduler.finished(url, time.Since(start))
+			<-slots
+
+			mu.Lock()
+			results[url] = up
+			mu.Unlock()
+		}(i, url)
+	}
+
+	wg.Wait()
+}
+
+// dependencyUp returns the last stored status of a parent that wasn't checked
+// in this cycle.
+func dependencyUp(db *sql.DB, parent string) bool {
+
+	var status string
+	err := db.QueryRow("SELECT website_status FROM websites WHERE website_url = ?", parent).Scan(&status)
+	if err != nil {
+		fmt.Printf("Error getting status of %s: %v\n", parent, err)
+		return true
+	}
+	return statusUp(status)
+}
+
+// orderByDependency returns the websites with every website after the website
+// it depends on. Dependency loops are broken where they are found.
+func orderByDependency(websites []string, deps map[string]string) []string {
+	inBatch := make(map[string]bool, len(websites))
+	for _, url := range websites {
+		inBatch[url] = true
+	}
+
+	ordered := make([]string, 0, len(websites))
+	state := make(map[string]int) // 1 = visiting, 2 = done
+
+	var visit func(url string)
+	visit = func(url string) {
+		switch state[url] {
+		case 1:
+			fmt.Printf("Dependency loop found at %s\n", url)
+			return
+		case 2:
+			return
+		}
+		state[url] = 1
+		if parent, ok := deps[url]; ok && inBatch[parent] {
+			visit(parent)
+		}
+		state[url] = 2
+		ordered = append(ordered, url)
+	}
+
+	for _, url := range websites {
+		visit(url)
+	}
+
+	return ordered
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	dkimDomain   string
+	dkimSelector string
+	dkimKey      *rsa.PrivateKey
+)
+
+// dkimSignedHeaders are the headers covered by the signature, in order.
+var dkimSignedHeaders = []string{"from", "to", "subject", "date", "message-id", "reply-to"}
+
+var whitespaceRun = regexp.MustCompile(`[ \t]+`)
+
+// loadDKIM reads DKIM_DOMAIN, DKIM_SELECTOR and the PEM key at
+// DKIM_PRIVATE_KEY_PATH. Alerts are sent unsigned when they are not set.
+func loadDKIM() error {
+	dkimDomain = os.Getenv("DKIM_DOMAIN")
+	dkimSelector = os.Getenv("DKIM_SELECTOR")
+	keyPath := os.Getenv("DKIM_PRIVATE_KEY_PATH")
+	if dkimDomain == "" || dkimSelector == "" || keyPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("no PEM block found in DKIM key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		dkimKey = key
+		return nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("DKIM key is not an RSA key")
+	}
+	dkimKey = key
+	return nil
+}
+
+// dkimSign prepends a DKIM-Signature header (rsa-sha256, relaxed/relaxed) to
+// a message with CRLF line endings.
+func dkimSign(msg []byte) ([]byte, error) {
+	headerEnd := bytes.Index(msg, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("message has no header/body separator")
+	}
+	headers := splitHeaders(string(msg[:headerEnd+2]))
+	body := string(msg[headerEnd+4:])
+
+	bodyHash := sha256.Sum256([]byte(relaxedBody(body)))
+
+	var signedNames []string
+	var signed strings.Builder
+	for _, name := range dkimSignedHeaders {
+		for _, h := range headers {
+			if strings.EqualFold(headerName(h), name) {
+				signed.WriteString(relaxedHeader(h) + "\r\n")
+				signedNames = append(signedNames, name)
+				break
+			}
+		}
+	}
+
+	sig := fmt.Sprintf("DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		dkimDomain, dkimSelector, time.Now().Unix(), strings.Join(signedNames, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	signed.WriteString(relaxedHeader(sig))
+
+	hash := sha256.Sum256([]byte(signed.String()))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, dkimKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(sig+base64.StdEncoding.EncodeToString(signature)+"\r\n"), msg...), nil
+}
+
+// splitHeaders splits a header block into its headers, keeping folded
+// continuation lines with the header they belong to.
+func splitHeaders(block string) []string {
+	var headers []string
+	for _, line := range strings.Split(strings.TrimSuffix(block, "\r\n"), "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(headers) > 0 {
+			headers[len(headers)-1] += "\r\n" + line
+			continue
+		}
+		headers = append(headers, line)
+	}
+	return headers
+}
+
+func headerName(h string) string {
+	name, _, _ := strings.Cut(h, ":")
+	return strings.TrimSpace(name)
+}
+
+func relaxedHeader(h string) string {
+	name, value, _ := strings.Cut(h, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = whitespaceRun.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value)
+}
+
+func relaxedBody(body string) string {
+	lines := strings.Split(body, "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(whitespaceRun.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
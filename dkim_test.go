@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitHeaders(t *testing.T) {
+	block := "From: monitor@example.com\r\nSubject: Website\r\n down\r\n\tagain\r\nTo: ops@example.com\r\n"
+	want := []string{"From: monitor@example.com", "Subject: Website\r\n down\r\n\tagain", "To: ops@example.com"}
+
+	if got := splitHeaders(block); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitHeaders = %q, want %q", got, want)
+	}
+}
+
+func TestRelaxedHeader(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"Subject: Website down", "subject:Website down"},
+		{"SUBJECT :  Website   down  ", "subject:Website down"},
+		{"Subject: Website\r\n down\r\n\tagain", "subject:Website down again"},
+		{"X-Empty:", "x-empty:"},
+	}
+
+	for _, tt := range tests {
+		if got := relaxedHeader(tt.header); got != tt.want {
+			t.Errorf("relaxedHeader(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRelaxedBody(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{"", ""},
+		{"\r\n\r\n", ""},
+		{"Hello  world \r\n", "Hello world\r\n"},
+		{"Hello\t \tworld", "Hello world\r\n"},
+		{"Line one\r\n\r\nLine two\r\n\r\n\r\n", "Line one\r\n\r\nLine two\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := relaxedBody(tt.body); got != tt.want {
+			t.Errorf("relaxedBody(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// doubleEncoded matches UTF-8 text that was decoded as Latin-1 or
+// Windows-1252 and encoded again, e.g. "Ã©" for "é" and "â€™" for "’".
+var doubleEncoded = regexp.MustCompile(`Ã[\x{A0}-\x{BF}]|â€`)
+
+// checkEncoding verifies that the body decodes in the charset the response
+// declares. After a server migration a changed default charset turns every
+// accent into mojibake while the website is technically up.
+func checkEncoding(db *sql.DB, url, contentType string, body []byte, truncated bool, settings websiteSettings) {
+	var enabled bool
+	var previous string
+	err := db.QueryRow("SELECT check_encoding, COALESCE(encoding_problem, '') FROM websites WHERE website_url = ?", url).Scan(&enabled, &previous)
+	if err != nil {
+		fmt.Printf("Error getting encoding settings for %s: %v\n", url, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	problem := encodingProblem(contentType, body, truncated)
+	if problem == previous {
+		return
+	}
+
+	_, err = db.Exec("UPDATE websites SET encoding_problem = NULLIF(?, '') WHERE website_url = ?", problem, url)
+	if err != nil {
+		fmt.Printf("Error updating encoding problem for %s: %v\n", url, err)
+	}
+
+	if settings.InMaintenance {
+		return
+	}
+	if problem == "" {
+		sendSlackMessage(fmt.Sprintf("MONITOR --> The text of %s decodes correctly again", url))
+		return
+	}
+	if previous != "" {
+		return
+	}
+
+	message := fmt.Sprintf("The text of %s is garbled: %s", url, problem)
+	fmt.Println("ENCODING --> " + message)
+	sendSlackMessage("WARNING: " + message)
+}
+
+// encodingProblem returns what is wrong with the charset of the body, or ""
+// when it decodes cleanly. Only text responses are checked.
+func encodingProblem(contentType string, body []byte, truncated bool) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !textMediaType(mediaType) {
+		return ""
+	}
+	if truncated {
+		// The last character may have been cut in half.
+		for i := 0; i < utf8.UTFMax-1 && len(body) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(body); r != utf8.RuneError || size != 1 {
+				break
+			}
+			body = body[:len(body)-1]
+		}
+	}
+
+	declared := strings.ToLower(params["charset"])
+	if mediaType == "text/html" {
+		meta := metaCharset(body)
+		if declared == "" {
+			declared = meta
+		} else if meta != "" && !sameCharset(meta, declared) {
+			return fmt.Sprintf("Content-Type says %s but the page says %s", declared, meta)
+		}
+	}
+	if declared == "" || strings.HasSuffix(mediaType, "json") {
+		// JSON is always UTF-8, and so is what browsers assume for most
+		// undeclared text nowadays.
+		declared = "utf-8"
+	}
+
+	enc, name := charset.Lookup(declared)
+	if enc == nil {
+		return fmt.Sprintf("unknown charset %q", declared)
+	}
+
+	text := body
+	if name == "utf-8" {
+		if !utf8.Valid(body) {
+			return "body isn't valid UTF-8 " + invalidUTF8Context(body)
+		}
+	} else {
+		if utf8.Valid(body) && hasMultibyte(body) {
+			return fmt.Sprintf("body is UTF-8 but declared as %s", declared)
+		}
+		text, err = enc.NewDecoder().Bytes(body)
+		if err != nil {
+			return fmt.Sprintf("body doesn't decode as %s: %v", declared, err)
+		}
+		if bytes.ContainsRune(text, utf8.RuneError) {
+			return fmt.Sprintf("body has characters that don't exist in %s", declared)
+		}
+	}
+
+	if m := doubleEncoded.Find(text); m != nil {
+		return fmt.Sprintf("body contains UTF-8 decoded twice (%q)", m)
+	}
+	return ""
+}
+
+func textMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		strings.HasSuffix(mediaType, "javascript")
+}
+
+var metaCharsetTag = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([a-z0-9_:.-]+)`)
+
+// metaCharset returns the charset of a <meta> tag in the start of the page.
+func metaCharset(body []byte) string {
+	if m := metaCharsetTag.FindSubmatch(body[:min(len(body), 1024)]); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	return ""
+}
+
+func sameCharset(a, b string) bool {
+	_, x := charset.Lookup(a)
+	_, y := charset.Lookup(b)
+	return x != "" && x == y
+}
+
+func hasMultibyte(body []byte) bool {
+	for _, b := range body {
+		if b >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidUTF8Context shows the bytes around the first invalid sequence.
+func invalidUTF8Context(body []byte) string {
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRune(body[i:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Sprintf("at byte %d: %q", i, body[max(0, i-20):min(len(body), i+20)])
+		}
+		i += size
+	}
+	return ""
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var escalationChannels = map[string]bool{"slack": true, "email": true, "push": true, "webpush": true}
+
+// escalationPolicy says who hears about an incident and when. Every step
+// fires once its delay after the start of the incident has passed. With a
+// repeat count the steps run again that many times, every repeat interval,
+// until the incident is resolved.
+type escalationPolicy struct {
+	ID                    int              `json:"id"`
+	Name                  string           `json:"name"`
+	RepeatCount           int              `json:"repeat_count"`
+	RepeatIntervalSeconds int              `json:"repeat_interval_seconds"`
+	Steps                 []escalationStep `json:"steps"`
+}
+
+type escalationStep struct {
+	DelaySeconds int    `json:"delay_seconds"`
+	Channel      string `json:"channel"` // slack, email, push or webpush
+	// Target is the email address for email and push, the client of the
+	// website when empty. Slack and webpush ignore it.
+	Target string `json:"target,omitempty"`
+}
+
+func getEscalationPolicies(db *sql.DB) ([]escalationPolicy, error) {
+	rows, err := db.Query("SELECT id, name, repeat_count, repeat_interval_seconds FROM escalation_policies ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	policies := []escalationPolicy{}
+	for rows.Next() {
+		p := escalationPolicy{Steps: []escalationStep{}}
+		if err := rows.Scan(&p.ID, &p.Name, &p.RepeatCount, &p.RepeatIntervalSeconds); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*escalationPolicy)
+	for i := range policies {
+		byID[policies[i].ID] = &policies[i]
+	}
+
+	rows, err = db.Query("SELECT policy_id, delay_seconds, channel, COALESCE(target, '') FROM escalation_steps ORDER BY policy_id, position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var policyID int
+		var s escalationStep
+		if err := rows.Scan(&policyID, &s.DelaySeconds, &s.Channel, &s.Target); err != nil {
+			return nil, err
+		}
+		if p, ok := byID[policyID]; ok {
+			p.Steps = append(p.Steps, s)
+		}
+	}
+
+	return policies, rows.Err()
+}
+
+// runEscalations fires the due steps for all open incidents. A fired step is
+// recorded in incident_escalations first, so it goes out once even with
+// several monitors running.
+func runEscalations(db *sql.DB, now time.Time) error {
+	policies, err := getEscalationPolicies(db)
+	if err != nil {
+		return fmt.Errorf("fetching escalation policies: %v", err)
+	}
+	byID := make(map[int]escalationPolicy)
+	for _, p := range policies {
+		byID[p.ID] = p
+	}
+
+	query := `SELECT incidents.id, incidents.website_url, incidents.started_at, incidents.status, COALESCE(websites.escalation_policy_id, check_templates.escalation_policy_id)
+		FROM incidents JOIN websites ON websites.website_url = incidents.website_url
+		LEFT JOIN check_templates ON check_templates.id = websites.template_id
+		WHERE incidents.ended_at IS NULL AND NOT websites.paused AND COALESCE(websites.escalation_policy_id, check_templates.escalation_policy_id) IS NOT NULL`
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("fetching open incidents for escalation: %v", err)
+	}
+	type openIncident struct {
+		incident
+		policyID int
+	}
+	var open []openIncident
+	for rows.Next() {
+		var inc openIncident
+		if err := rows.Scan(&inc.ID, &inc.URL, &inc.StartedAt, &inc.Status, &inc.policyID); err != nil {
+			rows.Close()
+			return fmt.Errorf("reading open incident: %v", err)
+		}
+		open = append(open, inc)
+	}
+	rows.Close()
+
+	for _, inc := range open {
+		policy, ok := byID[inc.policyID]
+		if !ok || getWebsiteSettings(db, inc.URL).InMaintenance {
+			continue
+		}
+		escalateIncident(db, inc.incident, policy, now)
+	}
+	return nil
+}
+
+func escalateIncident(db *sql.DB, inc incident, policy escalationPolicy, now time.Time) {
+	for round := 0; round <= policy.RepeatCount; round++ {
+		if round > 0 && policy.RepeatIntervalSeconds <= 0 {
+			break
+		}
+		roundStart := inc.StartedAt.Add(time.Duration(round*policy.RepeatIntervalSeconds) * time.Second)
+
+		for i, step := range policy.Steps {
+			if now.Before(roundStart.Add(time.Duration(step.DelaySeconds) * time.Second)) {
+				continue
+			}
+
+			res, err := db.Exec("INSERT IGNORE INTO incident_escalations (incident_id, round, position, sent_at) VALUES (?, ?, ?, NOW())", inc.ID, round, i)
+			if err != nil {
+				fmt.Printf("Error recording escalation of incident %d: %v\n", inc.ID, err)
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+
+			label := fmt.Sprintf("%s, step %d of %d", policy.Name, i+1, len(policy.Steps))
+			if round > 0 {
+				label += fmt.Sprintf(", repeat %d", round)
+			}
+			message := fmt.Sprintf("ESCALATION (%s): Website %s has been down for %s. Status: %s", label, inc.URL, formatDuration(now.Sub(inc.StartedAt)), inc.Status)
+			fmt.Println(message)
+			sendEscalation(db, inc.URL, step, message)
+		}
+	}
+}
+
+func sendEscalation(db *sql.DB, url string, step escalationStep, message string) {
+	title := fmt.Sprintf("%s is still down", url)
+
+	switch step.Channel {
+	case "slack":
+		sendSlackMessage(message)
+	case "webpush":
+		notifyWatchers(db, url, title, message)
+	case "email", "push":
+		to := step.Target
+		if to == "" {
+			var err error
+			to, err = getClientEmail(db, url)
+			if err != nil {
+				fmt.Printf("Error getting client email for %s: %v\n", url, err)
+				return
+			}
+		}
+		if step.Channel == "email" {
+			sendEmail(to, "ESCALATION: "+title, "Dear user,\n\n"+message+"\n\nPlease check it ASAP")
+		} else {
+			sendPush(db, to, title, message, url)
+		}
+	}
+}
+
+// handleEscalationPolicies serves GET /api/escalation-policies.
+func handleEscalationPolicies(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policies, err := getEscalationPolicies(db)
+		if err != nil {
+			fmt.Printf("Error fetching escalation policies: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		writeJSON(w, http.StatusOK, policies)
+	}
+}
+
+// handleSetEscalationPolicy serves PUT /api/escalation-policies/{name}, which
+// creates the policy or replaces all of it, e.g.
+//
+//	{"repeat_count": 2, "repeat_interval_seconds": 3600, "steps": [
+//	  {"delay_seconds": 0, "channel": "slack"},
+//	  {"delay_seconds": 900, "channel": "email", "target": "oncall@example.com"}]}
+func handleSetEscalationPolicy(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy := escalationPolicy{Name: r.PathValue("name")}
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		policy.Name = r.PathValue("name")
+
+		if len(policy.Steps) == 0 {
+			writeError(w, http.StatusBadRequest, "a policy needs at least one step")
+			return
+		}
+		for _, s := range policy.Steps {
+			if !escalationChannels[s.Channel] {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown channel %q, use slack, email, push or webpush", s.Channel))
+				return
+			}
+			if s.DelaySeconds < 0 {
+				writeError(w, http.StatusBadRequest, "delay_seconds can't be negative")
+				return
+			}
+		}
+		if policy.RepeatCount < 0 || (policy.RepeatCount > 0 && policy.RepeatIntervalSeconds <= 0) {
+			writeError(w, http.StatusBadRequest, "repeating needs a positive repeat_interval_seconds")
+			return
+		}
+
+		if err := saveEscalationPolicy(db, &policy); err != nil {
+			fmt.Printf("Error saving escalation policy %s: %v\n", policy.Name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		recordEvent(eventConfig, "", "Escalation policy "+policy.Name+" changed by "+requestActor(r), policy)
+		writeJSON(w, http.StatusOK, policy)
+	}
+}
+
+func saveEscalationPolicy(db *sql.DB, policy *escalationPolicy) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveEscalationPolicyTx(tx, policy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveEscalationPolicyTx(tx *sql.Tx, policy *escalationPolicy) error {
+	query := "INSERT INTO escalation_policies (name, repeat_count, repeat_interval_seconds) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE repeat_count = VALUES(repeat_count), repeat_interval_seconds = VALUES(repeat_interval_seconds)"
+	if _, err := tx.Exec(query, policy.Name, policy.RepeatCount, policy.RepeatIntervalSeconds); err != nil {
+		return err
+	}
+	if err := tx.QueryRow("SELECT id FROM escalation_policies WHERE name = ?", policy.Name).Scan(&policy.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM escalation_steps WHERE policy_id = ?", policy.ID); err != nil {
+		return err
+	}
+	for i, s := range policy.Steps {
+		_, err := tx.Exec("INSERT INTO escalation_steps (policy_id, position, delay_seconds, channel, target) VALUES (?, ?, ?, ?, NULLIF(?, ''))", policy.ID, i, s.DelaySeconds, s.Channel, s.Target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleDeleteEscalationPolicy serves DELETE /api/escalation-policies/{name}.
+// Websites and templates using it fall back to no escalation.
+func handleDeleteEscalationPolicy(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		tx, err := db.Begin()
+		if err != nil {
+			fmt.Printf("Error deleting escalation policy %s: %v\n", name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer tx.Rollback()
+
+		var id int
+		if err := tx.QueryRow("SELECT id FROM escalation_policies WHERE name = ?", name).Scan(&id); err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "escalation policy not found")
+			return
+		} else if err != nil {
+			fmt.Printf("Error deleting escalation policy %s: %v\n", name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		for _, query := range []string{
+			"UPDATE websites SET escalation_policy_id = NULL WHERE escalation_policy_id = ?",
+			"UPDATE check_templates SET escalation_policy_id = NULL WHERE escalation_policy_id = ?",
+			"DELETE FROM escalation_steps WHERE policy_id = ?",
+			"DELETE FROM escalation_policies WHERE id = ?",
+		} {
+			if _, err := tx.Exec(query, id); err != nil {
+				fmt.Printf("Error deleting escalation policy %s: %v\n", name, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			fmt.Printf("Error deleting escalation policy %s: %v\n", name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		recordEvent(eventConfig, "", "Escalation policy "+name+" removed by "+requestActor(r), nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleSetWebsiteEscalation serves PUT /api/websites/escalation-policy with
+// {"url": "...", "policy": "on-call"}, or "policy": null to remove it.
+func handleSetWebsiteEscalation(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL    string  `json:"url"`
+			Policy *string `json:"policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+
+		var policyID *int
+		if body.Policy != nil {
+			var id int
+			err := db.QueryRow("SELECT id FROM escalation_policies WHERE name = ?", *body.Policy).Scan(&id)
+			if err == sql.ErrNoRows {
+				writeError(w, http.StatusNotFound, "escalation policy not found")
+				return
+			}
+			if err != nil {
+				fmt.Printf("Error getting escalation policy %s: %v\n", *body.Policy, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			policyID = &id
+		}
+
+		res, err := db.Exec("UPDATE websites SET escalation_policy_id = ? WHERE website_url = ?", policyID, body.URL)
+		if err != nil {
+			fmt.Printf("Error setting escalation policy for %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// Also 0 when the policy didn't change.
+			var exists bool
+			err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM websites WHERE website_url = ?)", body.URL).Scan(&exists)
+			if err == nil && !exists {
+				writeError(w, http.StatusNotFound, "website not found")
+				return
+			}
+		}
+
+		recordEvent(eventConfig, body.URL, "Escalation policy changed by "+requestActor(r), map[string]any{"policy": body.Policy})
+		writeJSON(w, http.StatusOK, body)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types. Checks and incident transitions come from the checker,
+// notifications from the alert channels and config changes from the API.
+const (
+	eventCheck        = "check"
+	eventIncident     = "incident"
+	eventNotification = "notification"
+	eventConfig       = "config"
+)
+
+type event struct {
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Type       string          `json:"type"`
+	URL        *string         `json:"url"`
+	Message    string          `json:"message"`
+	Details    json.RawMessage `json:"details,omitempty"`
+}
+
+// pendingEvents is written by startEventLog, so recording an event never
+// waits on the database. Events are dropped when it falls far behind.
+var pendingEvents = make(chan event, 1000)
+
+// recordEvent adds an event to the event log. url may be empty for events
+// that don't belong to one website.
+func recordEvent(eventType, url, message string, details any) {
+	e := event{OccurredAt: time.Now(), Type: eventType, Message: truncate(message, 1024)}
+	if url != "" {
+		e.URL = &url
+	}
+	if details != nil {
+		if data, err := json.Marshal(details); err == nil {
+			e.Details = data
+		}
+	}
+
+	exportSyslog(e)
+
+	select {
+	case pendingEvents <- e:
+	default:
+		fmt.Printf("Event log is full, dropped %s event: %s\n", eventType, message)
+	}
+}
+
+func startEventLog(db *sql.DB) {
+	go func() {
+		for e := range pendingEvents {
+			var details any
+			if e.Details != nil {
+				details = string(e.Details)
+			}
+			_, err := db.Exec("INSERT INTO events (occurred_at, type, website_url, message, details) VALUES (?, ?, ?, ?, ?)", e.OccurredAt, e.Type, e.URL, e.Message, details)
+			if err != nil {
+				fmt.Printf("Error saving %s event: %v\n", e.Type, err)
+			}
+		}
+	}()
+}
+
+func pruneEvents(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM events WHERE occurred_at < ?", time.Now().Add(-checkResultsRetention))
+	if err != nil {
+		return fmt.Errorf("pruning events: %v", err)
+	}
+	return nil
+}
+
+// requestActor names who made an API request, for config events.
+func requestActor(r *http.Request) string {
+	if userID, ok := requestUser(r); ok {
+		return fmt.Sprintf("user %d", userID)
+	}
+	return "api token"
+}
+
+// handleEvents serves GET /api/events?url=...&type=check,incident&from=...&to=...
+// with the newest events first. Pass next_cursor of a page as cursor to get
+// the next one. Signed in users only get the events of their own websites.
+func handleEvents(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := queryTimeRange(r, 7*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		limit := intQuery(r, "limit", 100)
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+
+		query := "SELECT id, occurred_at, type, website_url, message, details FROM events WHERE occurred_at BETWEEN ? AND ?"
+		args := []any{from, to}
+
+		if url := r.URL.Query().Get("url"); url != "" {
+			query += " AND website_url = ?"
+			args = append(args, url)
+		}
+		if userID, ok := requestUser(r); ok {
+			query += " AND website_url IN (SELECT website_url FROM websites WHERE client = ?)"
+			args = append(args, userID)
+		}
+		if v := r.URL.Query().Get("type"); v != "" {
+			types := strings.Split(v, ",")
+			query += " AND type IN (?" + strings.Repeat(", ?", len(types)-1) + ")"
+			for _, t := range types {
+				args = append(args, strings.TrimSpace(t))
+			}
+		}
+		if v := r.URL.Query().Get("cursor"); v != "" {
+			cursor, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+			query += " AND id < ?"
+			args = append(args, cursor)
+		}
+
+		query += " ORDER BY id DESC LIMIT ?"
+		args = append(args, limit+1)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			fmt.Printf("Error getting events: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer rows.Close()
+
+		events := []event{}
+		for rows.Next() {
+			var e event
+			var url, details sql.NullString
+			if err := rows.Scan(&e.ID, &e.OccurredAt, &e.Type, &url, &e.Message, &details); err != nil {
+				fmt.Printf("Error reading event: %v\n", err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			if url.Valid {
+				e.URL = &url.String
+			}
+			if details.Valid {
+				e.Details = json.RawMessage(details.String)
+			}
+			events = append(events, e)
+		}
+
+		var nextCursor *string
+		if len(events) > limit {
+			events = events[:limit]
+			c := strconv.FormatInt(events[limit-1].ID, 10)
+			nextCursor = &c
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"events":      events,
+			"next_cursor": nextCursor,
+		})
+	}
+}
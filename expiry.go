@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// expiringWindow is what counts as expiring soon, both for the jump alert and
+// as the default of the expiring report.
+var expiringWindow = 30 * 24 * time.Hour
+
+// expiringJump is how much the number of expiring certificates or domains has
+// to grow since the previous day to alert.
+var expiringJump = 5
+
+type expiringItem struct {
+	Kind      string    `json:"kind"` // certificate or domain
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Client    *string   `json:"client"`
+	ExpiresAt time.Time `json:"expires_at"`
+	DaysLeft  int       `json:"days_left"`
+}
+
+// getExpiring returns the certificates and domains expiring before until,
+// soonest first. A domain shared by several websites is listed once. With
+// clientID set only the websites of that client are included. Paused websites
+// are left out.
+func getExpiring(db *sql.DB, now, until time.Time, clientID int) ([]expiringItem, error) {
+	query := `SELECT websites.website_url, users.email, websites.ssl_expires_at, websites.domain_expiry_date
+		FROM websites LEFT JOIN users ON users.id = websites.client
+		WHERE (websites.ssl_expires_at < ? OR websites.domain_expiry_date < ?) AND NOT websites.paused AND (? = 0 OR websites.client = ?)`
+
+	rows, err := db.Query(query, until, until, clientID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []expiringItem
+	domains := make(map[string]bool)
+	for rows.Next() {
+		var url string
+		var client sql.NullString
+		var sslExpiry, domainExpiry sql.NullTime
+		if err := rows.Scan(&url, &client, &sslExpiry, &domainExpiry); err != nil {
+			return nil, err
+		}
+		item := expiringItem{URL: url}
+		if client.Valid {
+			item.Client = &client.String
+		}
+
+		if sslExpiry.Valid && sslExpiry.Time.Before(until) {
+			cert := item
+			cert.Kind, cert.Name, cert.ExpiresAt = "certificate", url, sslExpiry.Time
+			items = append(items, cert)
+		}
+		if domainExpiry.Valid && domainExpiry.Time.Before(until) {
+			domain, err := registeredDomain(url)
+			if err != nil || domains[domain] {
+				continue
+			}
+			domains[domain] = true
+			item.Kind, item.Name, item.ExpiresAt = "domain", domain, domainExpiry.Time
+			items = append(items, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		items[i].DaysLeft = int(items[i].ExpiresAt.Sub(now).Hours() / 24)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ExpiresAt.Before(items[j].ExpiresAt) })
+	return items, nil
+}
+
+// runExpiringTrend counts what expires within expiringWindow once a day and
+// alerts when the count jumps compared to the day before, e.g. after
+// onboarding a client whose certificates are all about to expire.
+func runExpiringTrend(db *sql.DB, now time.Time) error {
+	items, err := getExpiring(db, now, now.Add(expiringWindow), 0)
+	if err != nil {
+		return fmt.Errorf("getting expiring certificates and domains: %v", err)
+	}
+	counts := map[string]int{}
+	for _, item := range items {
+		counts[item.Kind]++
+	}
+
+	var prevCertificates, prevDomains int
+	err = db.QueryRow("SELECT certificates, domains FROM expiring_counts WHERE day < ? ORDER BY day DESC LIMIT 1", now.Format("2006-01-02")).Scan(&prevCertificates, &prevDomains)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("getting previous expiring counts: %v", err)
+	}
+	first := err == sql.ErrNoRows
+
+	query := "INSERT INTO expiring_counts (day, certificates, domains) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE certificates = VALUES(certificates), domains = VALUES(domains)"
+	res, err := db.Exec(query, now.Format("2006-01-02"), counts["certificate"], counts["domain"])
+	if err != nil {
+		return fmt.Errorf("saving expiring counts: %v", err)
+	}
+	// Only the first run of the day, as an insert, alerts.
+	if n, _ := res.RowsAffected(); n != 1 || first {
+		return nil
+	}
+
+	for _, c := range []struct {
+		kind            string
+		count, previous int
+	}{{"certificates", counts["certificate"], prevCertificates}, {"domains", counts["domain"], prevDomains}} {
+		if c.count-c.previous >= expiringJump {
+			message := fmt.Sprintf("WARNING: %d %s expire within %d days, up from %d yesterday. See /api/expiring for the list.", c.count, c.kind, int(expiringWindow.Hours()/24), c.previous)
+			fmt.Println(message)
+			sendSlackMessage(message)
+		}
+	}
+	return nil
+}
+
+// handleExpiring serves GET /api/expiring?days=30, all certificates and
+// domains expiring in the coming days for planning renewals.
+func handleExpiring(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days := intQuery(r, "days", int(expiringWindow.Hours()/24))
+		if days <= 0 || days > 3650 {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and 3650")
+			return
+		}
+
+		clientID, _ := requestUser(r)
+		now := time.Now()
+		items, err := getExpiring(db, now, now.AddDate(0, 0, days), clientID)
+		if err != nil {
+			fmt.Printf("Error getting expiring certificates and domains: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if items == nil {
+			items = []expiringItem{}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"days": days, "expiring": items})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+const forecastWeeks = 12
+
+type reliabilityForecast struct {
+	Uptime         float64 // expected uptime percentage over the next 30 days
+	UptimeTrend    string
+	LatencyTrend   string
+	LatencyPerWeek float64 // change of the average response time per week, in seconds
+}
+
+// forecastReliability fits a line through the weekly uptime and average
+// response time of the last forecastWeeks weeks and extrapolates it over the
+// next 30 days. It's a rough indication of where a website is heading, not a
+// promise.
+func forecastReliability(db *sql.DB, url string, now time.Time) (reliabilityForecast, error) {
+	start := now.AddDate(0, 0, -7*forecastWeeks)
+
+	incidents, err := getIncidents(db, url, start, now)
+	if err != nil {
+		return reliabilityForecast{}, err
+	}
+
+	latencies, err := weeklyLatency(db, url, start)
+	if err != nil {
+		return reliabilityForecast{}, err
+	}
+
+	uptimes := make([]float64, forecastWeeks)
+	for week := range uptimes {
+		from := start.AddDate(0, 0, 7*week)
+		uptimes[week] = uptimePercentage(incidents, from, from.AddDate(0, 0, 7))
+	}
+
+	uptimeMean, uptimeSlope := linearFit(uptimes)
+	latencyMean, latencySlope := linearFit(latencies)
+
+	// Weeks are numbered 0 to forecastWeeks-1, so the middle of the next 30
+	// days lies this many weeks after the middle of the fitted weeks.
+	ahead := float64(forecastWeeks+1)/2 + 30.0/14
+	forecast := reliabilityForecast{
+		Uptime:         math.Max(0, math.Min(100, uptimeMean+uptimeSlope*ahead)),
+		UptimeTrend:    trend(uptimeSlope, 0.05),
+		LatencyTrend:   trend(-latencySlope, 0.02*latencyMean),
+		LatencyPerWeek: latencySlope,
+	}
+
+	return forecast, nil
+}
+
+// weeklyLatency returns the average response time per week since start. Weeks
+// without measurements are left out.
+func weeklyLatency(db *sql.DB, url string, start time.Time) ([]float64, error) {
+	query := "SELECT FLOOR(TIMESTAMPDIFF(DAY, ?, checked_at) / 7) AS week, AVG(response_time) FROM response_times WHERE website_url = ? AND checked_at >= ? GROUP BY week ORDER BY week"
+
+	rows, err := db.Query(query, start, url, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var latencies []float64
+	for rows.Next() {
+		var week int
+		var avg float64
+		if err := rows.Scan(&week, &avg); err != nil {
+			return nil, err
+		}
+		latencies = append(latencies, avg)
+	}
+
+	return latencies, rows.Err()
+}
+
+// linearFit returns the mean and the least squares slope per step of values.
+func linearFit(values []float64) (float64, float64) {
+	n := float64(len(values))
+	if n == 0 {
+		return 0, 0
+	}
+
+	var sumX, sumY float64
+	for i, v := range values {
+		sumX += float64(i)
+		sumY += v
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX float64
+	for i, v := range values {
+		cov += (float64(i) - meanX) * (v - meanY)
+		varX += (float64(i) - meanX) * (float64(i) - meanX)
+	}
+	if varX == 0 {
+		return meanY, 0
+	}
+
+	return meanY, cov / varX
+}
+
+// trend describes a slope where positive is better. Slopes within threshold of
+// zero count as stable.
+func trend(slope, threshold float64) string {
+	switch {
+	case slope > threshold:
+		return "improving"
+	case slope < -threshold:
+		return "worsening"
+	default:
+		return "stable"
+	}
+}
+
+func (f reliabilityForecast) String() string {
+	return fmt.Sprintf("Expected uptime next 30 days: %.2f%%\n   Availability trend: %s\n   Response time trend: %s (%+.0f ms per week)",
+		f.Uptime, f.UptimeTrend, f.LatencyTrend, f.LatencyPerWeek*1000)
+}
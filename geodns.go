@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+var geoDNSInterval = 10 * time.Minute
+
+// geoPool is the set of addresses a geo-DNS website should resolve to from a
+// region, e.g. the EU load balancers for probes in eu-west. MaxConnect flags
+// addresses that resolve into the pool but are still far away.
+type geoPool struct {
+	Region     string
+	Networks   []*net.IPNet
+	MaxConnect time.Duration
+}
+
+func (p geoPool) contains(ip net.IP) bool {
+	for _, n := range p.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks reads a comma separated list of CIDRs and single addresses.
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+func getGeoPools(db *sql.DB) (map[string][]geoPool, error) {
+	query := "SELECT geo_dns_pools.website_url, geo_dns_pools.region, geo_dns_pools.networks, COALESCE(geo_dns_pools.max_connect_ms, 0) FROM geo_dns_pools JOIN websites ON websites.website_url = geo_dns_pools.website_url WHERE NOT websites.paused"
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pools := make(map[string][]geoPool)
+	for rows.Next() {
+		var url, networks string
+		var maxConnect int
+		var p geoPool
+		if err := rows.Scan(&url, &p.Region, &networks, &maxConnect); err != nil {
+			return nil, err
+		}
+		p.Networks, err = parseNetworks(networks)
+		if err != nil {
+			fmt.Printf("Invalid geo-DNS pool %s for %s: %v\n", p.Region, url, err)
+			continue
+		}
+		p.MaxConnect = time.Duration(maxConnect) * time.Millisecond
+		pools[url] = append(pools[url], p)
+	}
+
+	return pools, rows.Err()
+}
+
+// runGeoDNSChecks resolves every geo-DNS website from the region of this
+// monitor and checks the addresses against the pool of the region.
+func runGeoDNSChecks(db *sql.DB) error {
+	pools, err := getGeoPools(db)
+	if err != nil {
+		return fmt.Errorf("fetching geo-DNS pools: %v", err)
+	}
+
+	for url, sitePools := range pools {
+		for _, pool := range sitePools {
+			if pool.Region == probeRegion {
+				problem := checkGeoDNS(db, url, pool, sitePools)
+				saveGeoDNSStatus(db, url, problem)
+			}
+		}
+	}
+	return nil
+}
+
+// checkGeoDNS returns what is wrong with the addresses the website resolves
+// to, or "" when they are all in the pool.
+func checkGeoDNS(db *sql.DB, url string, pool geoPool, pools []geoPool) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %v", err)
+	}
+	host, port := asciiHost(u.Hostname()), u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	settings := getWebsiteSettings(db, url)
+	resolver := net.DefaultResolver
+	if settings.Network != nil {
+		if r := settings.Network.dialer().Resolver; r != nil {
+			resolver = r
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Sprintf("can't resolve %s: %v", host, err)
+	}
+
+	var problems []string
+	for _, addr := range addrs {
+		if !pool.contains(addr.IP) {
+			where := "which isn't in any pool"
+			for _, other := range pools {
+				if other.Region != pool.Region && other.contains(addr.IP) {
+					where = "which is in the " + other.Region + " pool"
+					break
+				}
+			}
+			problems = append(problems, fmt.Sprintf("%s resolves to %s %s", host, addr.IP, where))
+			continue
+		}
+
+		if pool.MaxConnect > 0 {
+			dial := checkDialer(settings)
+			start := time.Now()
+			conn, err := dial(ctx, "tcp", net.JoinHostPort(addr.IP.String(), port))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("can't connect to %s: %v", addr.IP, err))
+				continue
+			}
+			latency := time.Since(start)
+			conn.Close()
+			if latency > pool.MaxConnect {
+				problems = append(problems, fmt.Sprintf("connecting to %s takes %v, more than %v", addr.IP, latency.Round(time.Millisecond), pool.MaxConnect))
+			}
+		}
+	}
+
+	return strings.Join(problems, "\n")
+}
+
+// saveGeoDNSStatus alerts once when the routing of the region goes wrong and
+// once when it is right again.
+func saveGeoDNSStatus(db *sql.DB, url, problem string) {
+	var previous sql.NullString
+	err := db.QueryRow("SELECT problem FROM geo_dns_status WHERE website_url = ? AND region = ?", url, probeRegion).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Printf("Error getting geo-DNS status for %s: %v\n", url, err)
+		return
+	}
+	wasWrong := previous.Valid && previous.String != ""
+
+	query := "INSERT INTO geo_dns_status (website_url, region, problem, checked_at) VALUES (?, ?, NULLIF(?, ''), NOW()) ON DUPLICATE KEY UPDATE problem = VALUES(problem), checked_at = NOW()"
+	if _, err := db.Exec(query, url, probeRegion, problem); err != nil {
+		fmt.Printf("Error saving geo-DNS status for %s: %v\n", url, err)
+	}
+
+	if settings := getWebsiteSettings(db, url); settings.InMaintenance {
+		return
+	}
+	switch {
+	case problem != "" && !wasWrong:
+		message := fmt.Sprintf("WARNING: Users of %s in %s are routed to the wrong servers:\n%s", url, probeRegion, problem)
+		fmt.Println(message)
+		sendSlackMessage(message)
+	case problem == "" && wasWrong:
+		sendSlackMessage(fmt.Sprintf("MONITOR --> %s resolves to the %s pool again", url, probeRegion))
+	}
+}
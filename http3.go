@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+var http3Timeout = 15 * time.Second
+
+// checkHTTP3 requests the website over HTTP/3 and records the result next to
+// the regular check, so QUIC failures show up even while the TCP check is
+// fine. UDP can't go through an SSH jump host and the QUIC client doesn't use
+// network profiles, so websites with either are skipped.
+func checkHTTP3(db *sql.DB, url string, settings websiteSettings) {
+	var enabled bool
+	var previous sql.NullBool
+	err := db.QueryRow("SELECT check_http3, http3_up FROM websites WHERE website_url = ?", url).Scan(&enabled, &previous)
+	if err != nil {
+		fmt.Printf("Error getting HTTP/3 settings for %s: %v\n", url, err)
+		return
+	}
+	if !enabled || settings.JumpHost != "" || settings.Network != nil {
+		return
+	}
+
+	status, responseTime := "Up", time.Duration(0)
+	elapsed, err := requestHTTP3(url, settings.MaxBodyBytes)
+	if err != nil {
+		status = "Down (" + err.Error() + ")"
+	} else {
+		responseTime = elapsed
+	}
+	up := err == nil
+
+	query := "UPDATE websites SET http3_up = ?, http3_status = ?, http3_response_time = ?, http3_checked_at = NOW() WHERE website_url = ?"
+	if _, err := db.Exec(query, up, truncate(status, 255), responseTime.Seconds(), url); err != nil {
+		fmt.Printf("Error saving HTTP/3 status for %s: %v\n", url, err)
+	}
+
+	if !previous.Valid || previous.Bool == up || settings.InMaintenance {
+		return
+	}
+	if up {
+		sendSlackMessage(fmt.Sprintf("MONITOR --> %s works over HTTP/3 again", url))
+		return
+	}
+	message := fmt.Sprintf("WARNING: %s fails over HTTP/3 (QUIC), clients preferring QUIC may not reach it. Status: %s", url, status)
+	fmt.Println(message)
+	sendSlackMessage(message)
+}
+
+func requestHTTP3(url string, limit int64) (time.Duration, error) {
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{NextProtos: []string{http3.NextProtoH3}}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+
+	ctx, cancel := context.WithTimeout(context.Background(), http3Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asciiURL(url), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, limit)); err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Status Code: %d", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
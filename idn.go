@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net"
+	neturl "net/url"
+
+	"golang.org/x/net/idna"
+)
+
+// asciiHost converts an internationalized host name such as bücher.example to
+// its punycode form (xn--bcher-kva.example), which is what DNS, TLS SNI,
+// certificates and WHOIS servers use.
+func asciiHost(host string) string {
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return host
+	}
+	return ascii
+}
+
+// asciiURL returns the URL with its host in punycode.
+func asciiURL(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	host := asciiHost(u.Hostname())
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+	return u.String()
+}
+
+// tlsAddress returns the punycode host name and the host:port to connect to
+// for the TLS check of a website.
+func tlsAddress(rawURL string) (string, string, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	host := asciiHost(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	return host, net.JoinHostPort(host, port), nil
+}
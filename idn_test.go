@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestAsciiHost(t *testing.T) {
+	tests := []struct {
+		host, want string
+	}{
+		{"example.com", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"shop.bücher.example", "shop.xn--bcher-kva.example"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"127.0.0.1", "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := asciiHost(tt.host); got != tt.want {
+			t.Errorf("asciiHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestAsciiURL(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://example.com/path?q=1", "https://example.com/path?q=1"},
+		{"https://bücher.example/", "https://xn--bcher-kva.example/"},
+		{"http://bücher.example:8080/a", "http://xn--bcher-kva.example:8080/a"},
+		{"://bad", "://bad"},
+	}
+
+	for _, tt := range tests {
+		if got := asciiURL(tt.url); got != tt.want {
+			t.Errorf("asciiURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTLSAddress(t *testing.T) {
+	tests := []struct {
+		url, host, addr string
+	}{
+		{"https://example.com", "example.com", "example.com:443"},
+		{"https://bücher.example:8443/", "xn--bcher-kva.example", "xn--bcher-kva.example:8443"},
+	}
+
+	for _, tt := range tests {
+		host, addr, err := tlsAddress(tt.url)
+		if err != nil || host != tt.host || addr != tt.addr {
+			t.Errorf("tlsAddress(%q) = %q, %q, %v, want %q, %q", tt.url, host, addr, err, tt.host, tt.addr)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type incident struct {
+	ID         int
+	URL        string
+	StartedAt  time.Time
+	EndedAt    sql.NullTime
+	Status     string
+	RootCause  sql.NullString
+	Postmortem sql.NullString
+}
+
+// trackIncident opens an incident when a website goes down and closes it when
+// the website is up again. Skipped checks don't change anything.
+func trackIncident(db *sql.DB, url, status string) {
+	if strings.HasPrefix(status, "Skipped") {
+		return
+	}
+
+	if statusUp(status) {
+		res, err := db.Exec("UPDATE incidents SET ended_at = NOW() WHERE website_url = ? AND ended_at IS NULL", url)
+		if err != nil {
+			fmt.Printf("Error closing incident for %s: %v\n", url, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			recordEvent(eventIncident, url, "Incident resolved", map[string]any{"status": status})
+			notifyWatchers(db, url, fmt.Sprintf("%s is up again", url), "The incident is resolved")
+			chartIncidentAlert(db, url, status, false)
+		}
+		return
+	}
+
+	var open int
+	err := db.QueryRow("SELECT COUNT(*) FROM incidents WHERE website_url = ? AND ended_at IS NULL", url).Scan(&open)
+	if err != nil {
+		fmt.Printf("Error getting open incident for %s: %v\n", url, err)
+		return
+	}
+	if open > 0 {
+		return
+	}
+
+	_, err = db.Exec("INSERT INTO incidents (website_url, started_at, status) VALUES (?, NOW(), ?)", url, status)
+	if err != nil {
+		fmt.Printf("Error opening incident for %s: %v\n", url, err)
+		return
+	}
+	recordEvent(eventIncident, url, "Incident opened", map[string]any{"status": status})
+	notifyWatchers(db, url, fmt.Sprintf("%s is down", url), status)
+	chartIncidentAlert(db, url, status, true)
+	go requestConfirmation(db, url)
+}
+
+// getIncidents returns the incidents of a website that overlap the window.
+func getIncidents(db *sql.DB, url string, from, to time.Time) ([]incident, error) {
+	query := "SELECT id, website_url, started_at, ended_at, status, root_cause, postmortem FROM incidents WHERE website_url = ? AND started_at < ? AND (ended_at IS NULL OR ended_at > ?) ORDER BY started_at"
+
+	rows, err := db.Query(query, url, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var incidents []incident
+	for rows.Next() {
+		var inc incident
+		if err := rows.Scan(&inc.ID, &inc.URL, &inc.StartedAt, &inc.EndedAt, &inc.Status, &inc.RootCause, &inc.Postmortem); err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, inc)
+	}
+
+	return incidents, rows.Err()
+}
+
+// downtime returns how much of the window the incidents cover.
+func downtime(incidents []incident, from, to time.Time) time.Duration {
+	var total time.Duration
+	for _, inc := range incidents {
+		start := inc.StartedAt
+		end := to
+		if inc.EndedAt.Valid {
+			end = inc.EndedAt.Time
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+func uptimePercentage(incidents []incident, from, to time.Time) float64 {
+	return uptimeFor(downtime(incidents, from, to), from, to)
+}
+
+func uptimeFor(down time.Duration, from, to time.Time) float64 {
+	window := to.Sub(from)
+	if window <= 0 {
+		return 100
+	}
+	return 100 * (1 - float64(down)/float64(window))
+}
+
+// scheduledDowntime returns how much of the downtime of the incidents falls in
+// the maintenance windows. Overlapping windows count once.
+func scheduledDowntime(incidents []incident, windows []maintenanceWindow, from, to time.Time) time.Duration {
+	sort.Slice(windows, func(i, j int) bool { return windows[i].StartsAt.Before(windows[j].StartsAt) })
+	var merged []maintenanceWindow
+	for _, mw := range windows {
+		if n := len(merged); n > 0 && !mw.StartsAt.After(merged[n-1].EndsAt) {
+			if mw.EndsAt.After(merged[n-1].EndsAt) {
+				merged[n-1].EndsAt = mw.EndsAt
+			}
+			continue
+		}
+		merged = append(merged, mw)
+	}
+
+	var total time.Duration
+	for _, mw := range merged {
+		start, end := mw.StartsAt, mw.EndsAt
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			total += downtime(incidents, start, end)
+		}
+	}
+	return total
+}
+
+// uptimeFigures are the raw uptime of a website and the SLA uptime, which
+// counts downtime during maintenance windows as scheduled and not as down
+// unless sla_exclude_maintenance is turned off for the website.
+type uptimeFigures struct {
+	UptimePercentage         float64 `json:"uptime_percentage"`
+	SLAUptimePercentage      float64 `json:"sla_uptime_percentage"`
+	DowntimeSeconds          float64 `json:"downtime_seconds"`
+	ScheduledDowntimeSeconds float64 `json:"scheduled_downtime_seconds"`
+}
+
+func measureUptime(db *sql.DB, url string, incidents []incident, from, to time.Time) (uptimeFigures, error) {
+	down := downtime(incidents, from, to)
+	figures := uptimeFigures{
+		UptimePercentage:    uptimeFor(down, from, to),
+		SLAUptimePercentage: uptimeFor(down, from, to),
+		DowntimeSeconds:     down.Seconds(),
+	}
+	if len(incidents) == 0 {
+		return figures, nil
+	}
+
+	var exclude bool
+	if err := db.QueryRow("SELECT sla_exclude_maintenance FROM websites WHERE website_url = ?", url).Scan(&exclude); err != nil {
+		return figures, err
+	}
+	if !exclude {
+		return figures, nil
+	}
+
+	windows, err := getWebsiteMaintenance(db, url, from, to)
+	if err != nil {
+		return figures, err
+	}
+	scheduled := scheduledDowntime(incidents, windows, from, to)
+	figures.ScheduledDowntimeSeconds = scheduled.Seconds()
+	figures.SLAUptimePercentage = uptimeFor(down-scheduled, from, to)
+	return figures, nil
+}
+
+type incidentRemediation struct {
+	Action  string    `json:"action"`
+	Target  string    `json:"target,omitempty"`
+	RanAt   time.Time `json:"ran_at"`
+	Success bool      `json:"success"`
+	Output  string    `json:"output"`
+}
+
+type incidentResponse struct {
+	ID            int                    `json:"id"`
+	URL           string                 `json:"url"`
+	StartedAt     time.Time              `json:"started_at"`
+	EndedAt       *time.Time             `json:"ended_at"`
+	Status        string                 `json:"status"`
+	RootCause     *string                `json:"root_cause"`
+	Postmortem    *string                `json:"postmortem"`
+	Remediations  []incidentRemediation  `json:"remediations"`
+	Confirmations []incidentConfirmation `json:"confirmations"`
+}
+
+func getIncidentRemediations(db *sql.DB, incidentID int) ([]incidentRemediation, error) {
+	query := "SELECT action, target, ran_at, success, output FROM incident_remediations WHERE incident_id = ? ORDER BY ran_at"
+
+	rows, err := db.Query(query, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	remediations := []incidentRemediation{}
+	for rows.Next() {
+		var r incidentRemediation
+		if err := rows.Scan(&r.Action, &r.Target, &r.RanAt, &r.Success, &r.Output); err != nil {
+			return nil, err
+		}
+		remediations = append(remediations, r)
+	}
+
+	return remediations, rows.Err()
+}
+
+// handleIncidents serves GET /api/incidents?url=...&from=...&to=...
+func handleIncidents(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+		if !allowedWebsite(db, r, url) {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+
+		from, to, err := queryTimeRange(r, 30*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		incidents, err := getIncidents(db, url, from, to)
+		if err != nil {
+			fmt.Printf("Error getting incidents for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		result := []incidentResponse{}
+		for _, inc := range incidents {
+			res := incidentResponse{ID: inc.ID, URL: inc.URL, StartedAt: inc.StartedAt, Status: inc.Status}
+			if inc.EndedAt.Valid {
+				res.EndedAt = &inc.EndedAt.Time
+			}
+			if inc.RootCause.Valid {
+				res.RootCause = &inc.RootCause.String
+			}
+			if inc.Postmortem.Valid {
+				res.Postmortem = &inc.Postmortem.String
+			}
+			res.Remediations, err = getIncidentRemediations(db, inc.ID)
+			if err != nil {
+				fmt.Printf("Error getting remediations for incident %d: %v\n", inc.ID, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			// Targets are hosts and services of the operator, clients only
+			// see what was done.
+			if _, ok := requestUser(r); ok {
+				for i := range res.Remediations {
+					res.Remediations[i].Target = ""
+				}
+			}
+			res.Confirmations, err = getIncidentConfirmations(db, inc.ID)
+			if err != nil {
+				fmt.Printf("Error getting confirmations for incident %d: %v\n", inc.ID, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			result = append(result, res)
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobSchedule is either "@every <duration>", one of @hourly, @daily and
+// @weekly, or a cron expression with minute, hour, day of month, month and
+// day of week fields, e.g. "30 3 * * 1-5". Fields take *, lists, ranges and
+// steps like */15.
+type jobSchedule struct {
+	every time.Duration
+	cron  [5]map[int]bool // nil means *
+}
+
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func parseSchedule(spec string) (jobSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Minute {
+			return jobSchedule{}, fmt.Errorf("invalid interval %q, use at least 1m", rest)
+		}
+		return jobSchedule{every: d}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return jobSchedule{}, fmt.Errorf("invalid schedule %q, expected 5 cron fields or @every", spec)
+	}
+
+	var s jobSchedule
+	for i, field := range fields {
+		if field == "*" {
+			continue
+		}
+		values, err := parseCronField(field, cronRanges[i][0], cronRanges[i][1], i == 4)
+		if err != nil {
+			return jobSchedule{}, fmt.Errorf("invalid cron field %q: %v", field, err)
+		}
+		s.cron[i] = values
+	}
+	return s, nil
+}
+
+func parseCronField(field string, lo, hi int, dayOfWeek bool) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", s)
+			}
+			part, step = base, n
+		}
+
+		from, to := lo, hi
+		if part != "*" {
+			a, b, isRange := strings.Cut(part, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return nil, fmt.Errorf("invalid value %q", a)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return nil, fmt.Errorf("invalid value %q", b)
+				}
+			} else if step > 1 {
+				to = hi
+			}
+		}
+		// Both 0 and 7 are Sunday.
+		max := hi
+		if dayOfWeek {
+			max = 7
+		}
+		if from < lo || to > max || from > to {
+			return nil, fmt.Errorf("%d-%d is outside %d-%d", from, to, lo, max)
+		}
+		for v := from; v <= to; v += step {
+			if dayOfWeek && v == 7 {
+				values[0] = true
+				continue
+			}
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// next returns the first time after t the schedule fires.
+func (s jobSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	match := func(i, v int) bool { return s.cron[i] == nil || s.cron[i][v] }
+	dayMatches := func(t time.Time) bool {
+		dom, dow := match(2, t.Day()), match(4, int(t.Weekday()))
+		// Like cron, a job restricted on both fields runs when either matches.
+		if s.cron[2] != nil && s.cron[4] != nil {
+			return dom || dow
+		}
+		return dom && dow
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !match(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !match(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !match(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return limit
+}
+
+type job struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+
+	Running      bool       `json:"running"`
+	LastStarted  *time.Time `json:"last_started"`
+	LastFinished *time.Time `json:"last_finished"`
+	LastDuration float64    `json:"last_duration_seconds"`
+	LastError    string     `json:"last_error,omitempty"`
+	Skipped      int        `json:"skipped_overlaps"`
+	NextRun      time.Time  `json:"next_run"`
+
+	schedule jobSchedule
+	run      func() error
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = make(map[string]*job)
+)
+
+// registerJob adds a periodic job. JOB_<NAME>_SCHEDULE overrides the default
+// schedule, with dashes in the name as underscores.
+func registerJob(name, spec string, run func() error) {
+	envName := "JOB_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_SCHEDULE"
+	if v := os.Getenv(envName); v != "" {
+		if _, err := parseSchedule(v); err != nil {
+			fmt.Printf("Invalid %s, using %q: %v\n", envName, spec, err)
+		} else {
+			spec = v
+		}
+	}
+
+	schedule, err := parseSchedule(spec)
+	if err != nil {
+		fmt.Printf("Error scheduling job %s: %v\n", name, err)
+		return
+	}
+
+	jobsMu.Lock()
+	jobs[name] = &job{Name: name, Schedule: spec, schedule: schedule, run: run}
+	jobsMu.Unlock()
+}
+
+// startJobs plans the registered jobs and runs them when they are due. Jobs
+// on an interval continue from their last run before a restart, so a weekly
+// job doesn't run on every deploy.
+func startJobs(db *sql.DB) {
+	now := time.Now()
+
+	lastRuns := make(map[string]time.Time)
+	rows, err := db.Query("SELECT name, last_started_at FROM job_runs")
+	if err != nil {
+		fmt.Printf("Error getting last job runs: %v\n", err)
+	} else {
+		for rows.Next() {
+			var name string
+			var started time.Time
+			if err := rows.Scan(&name, &started); err == nil {
+				lastRuns[name] = started
+			}
+		}
+		rows.Close()
+	}
+
+	jobsMu.Lock()
+	for _, j := range jobs {
+		j.NextRun = now
+		if last, ok := lastRuns[j.Name]; ok {
+			j.LastStarted = &last
+			if j.schedule.every > 0 {
+				if next := j.schedule.next(last); next.After(now) {
+					j.NextRun = next
+				}
+			} else {
+				j.NextRun = j.schedule.next(now)
+			}
+		}
+	}
+	jobsMu.Unlock()
+
+	go func() {
+		for {
+			now := time.Now()
+			jobsMu.Lock()
+			for _, j := range jobs {
+				if !j.NextRun.After(now) {
+					j.NextRun = j.schedule.next(now)
+					go runJob(db, j)
+				}
+			}
+			jobsMu.Unlock()
+			time.Sleep(15 * time.Second)
+		}
+	}()
+}
+
+// runJob runs a job unless its previous run is still busy.
+func runJob(db *sql.DB, j *job) {
+	jobsMu.Lock()
+	if j.Running {
+		j.Skipped++
+		jobsMu.Unlock()
+		fmt.Printf("Skipped job %s, the previous run is still busy\n", j.Name)
+		return
+	}
+	started := time.Now()
+	j.Running = true
+	j.LastStarted = &started
+	jobsMu.Unlock()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return j.run()
+	}()
+
+	finished := time.Now()
+	jobsMu.Lock()
+	j.Running = false
+	j.LastFinished = &finished
+	j.LastDuration = finished.Sub(started).Seconds()
+	j.LastError = ""
+	if err != nil {
+		j.LastError = err.Error()
+	}
+	jobsMu.Unlock()
+
+	if err != nil {
+		fmt.Printf("Job %s failed: %v\n", j.Name, err)
+	}
+
+	query := "INSERT INTO job_runs (name, last_started_at, last_finished_at, last_error) VALUES (?, ?, ?, NULLIF(?, '')) ON DUPLICATE KEY UPDATE last_started_at = VALUES(last_started_at), last_finished_at = VALUES(last_finished_at), last_error = VALUES(last_error)"
+	if _, dbErr := db.Exec(query, j.Name, started, finished, truncate(j.LastError, 1024)); dbErr != nil {
+		fmt.Printf("Error saving run of job %s: %v\n", j.Name, dbErr)
+	}
+}
+
+// handleJobs serves GET /api/jobs with the schedule and last run of every job.
+func handleJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobsMu.Lock()
+		list := make([]job, 0, len(jobs))
+		for _, j := range jobs {
+			list = append(list, *j)
+		}
+		jobsMu.Unlock()
+
+		sort.Slice(list, func(i, k int) bool { return list[i].Name < list[k].Name })
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+// handleRunJob serves POST /api/jobs/{name}/run to run a job right away.
+func handleRunJob(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobsMu.Lock()
+		j, ok := jobs[r.PathValue("name")]
+		running := ok && j.Running
+		jobsMu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		if running {
+			writeError(w, http.StatusConflict, "job is already running")
+			return
+		}
+
+		recordEvent(eventConfig, "", "Job "+j.Name+" started by "+requestActor(r), nil)
+		go runJob(db, j)
+		writeJSON(w, http.StatusAccepted, map[string]string{"name": j.Name, "status": "started"})
+	}
+}
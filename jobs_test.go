@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field     string
+		lo, hi    int
+		dayOfWeek bool
+		want      []int
+	}{
+		{"5", 0, 59, false, []int{5}},
+		{"1,15,30", 0, 59, false, []int{1, 15, 30}},
+		{"10-14", 0, 59, false, []int{10, 11, 12, 13, 14}},
+		{"*/15", 0, 59, false, []int{0, 15, 30, 45}},
+		{"10-20/5", 0, 59, false, []int{10, 15, 20}},
+		{"50/5", 0, 59, false, []int{50, 55}},
+		{"1-3,20-22", 0, 23, false, []int{1, 2, 3, 20, 21, 22}},
+		{"31", 1, 31, false, []int{31}},
+		{"1-5", 0, 6, true, []int{1, 2, 3, 4, 5}},
+		{"7", 0, 6, true, []int{0}},
+		{"0,7", 0, 6, true, []int{0}},
+		{"5-7", 0, 6, true, []int{0, 5, 6}},
+		{"2-7/2", 0, 6, true, []int{2, 4, 6}},
+		{"1-7/3", 0, 6, true, []int{0, 1, 4}},
+		{"*/2", 0, 6, true, []int{0, 2, 4, 6}},
+	}
+
+	for _, tt := range tests {
+		values, err := parseCronField(tt.field, tt.lo, tt.hi, tt.dayOfWeek)
+		if err != nil {
+			t.Errorf("parseCronField(%q) error: %v", tt.field, err)
+			continue
+		}
+		var got []int
+		for v := range values {
+			got = append(got, v)
+		}
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCronField(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"@every 30s",
+		"@every soon",
+		"@monthly",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	}
+
+	for _, spec := range tests {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("parseSchedule(%q) accepted an invalid schedule", spec)
+		}
+	}
+}
+
+func TestJobScheduleNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2026, 10, 14, 8, 20, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 5m", from.Add(5 * time.Minute)},
+		{"@every 2h", from.Add(2 * time.Hour)},
+		{"@hourly", time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 14, 8, 30, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2026, 10, 15, 3, 30, 0, 0, time.UTC)},
+		{"0 9,17 * * *", time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"0 8-10 * * *", time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"30 3 * * 1-5", time.Date(2026, 10, 15, 3, 30, 0, 0, time.UTC)},
+		{"0 0 * * 6,7", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 2-7/2", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Restricted on both day fields, either one matching is enough.
+		{"0 0 20 * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 0", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		// Restricted on one, the other field being * doesn't widen it.
+		{"0 0 20 * *", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5", time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("parseSchedule(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got := s.next(from); !got.Equal(tt.want) {
+			t.Errorf("%q next after %s = %s, want %s", tt.spec, from, got, tt.want)
+		}
+	}
+}
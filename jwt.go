@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// signJWT returns a compact JWS of the claims, RS256 for RSA keys and ES256
+// for P-256 keys.
+func signJWT(key crypto.Signer, header map[string]any, claims any) (string, error) {
+	h := map[string]any{"typ": "JWT"}
+	for k, v := range header {
+		h[k] = v
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		h["alg"] = "RS256"
+	case *ecdsa.PrivateKey:
+		if k.Curve.Params().BitSize != 256 {
+			return "", errors.New("only P-256 ECDSA keys are supported")
+		}
+		h["alg"] = "ES256"
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	sig, err := jwsSignature(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// jwsSignature signs with SHA-256. ECDSA signatures are the fixed size r||s
+// JWS expects, not ASN.1.
+func jwsSignature(key crypto.Signer, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+// verifyJWT checks a compact JWS signed by signJWT with the public key of key
+// and returns its claims.
+func verifyJWT(key crypto.Signer, token string) (json.RawMessage, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a compact JWS")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 || !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, errors.New("invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("invalid payload encoding")
+	}
+	return claims, nil
+}
+
+// publicJWK returns the public key as a JWK, with a kid derived from the key.
+func publicJWK(key crypto.Signer) (map[string]string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	jwk := map[string]string{"kid": base64.RawURLEncoding.EncodeToString(sum[:12]), "use": "sig"}
+
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"], jwk["alg"] = "RSA", "RS256"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		jwk["kty"], jwk["alg"], jwk["crv"] = "EC", "ES256", "P-256"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(x)
+		jwk["y"] = base64.RawURLEncoding.EncodeToString(y)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+	return jwk, nil
+}
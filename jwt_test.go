@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSignVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"rsa", rsaKey, "RS256"},
+		{"ecdsa", ecKey, "ES256"},
+	}
+
+	for _, tt := range tests {
+		token, err := signJWT(tt.key, map[string]any{"kid": "test"}, map[string]any{"url": "https://example.com", "uptime": 99.9})
+		if err != nil {
+			t.Fatalf("%s: signJWT: %v", tt.name, err)
+		}
+
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			t.Fatalf("%s: %d parts, want 3", tt.name, len(parts))
+		}
+		headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		var header map[string]string
+		if err := json.Unmarshal(headerJSON, &header); err != nil || header["alg"] != tt.alg || header["kid"] != "test" || header["typ"] != "JWT" {
+			t.Errorf("%s: header %s", tt.name, headerJSON)
+		}
+
+		claims, err := verifyJWT(tt.key, token)
+		if err != nil {
+			t.Errorf("%s: verifyJWT: %v", tt.name, err)
+		} else if string(claims) != `{"uptime":99.9,"url":"https://example.com"}` {
+			t.Errorf("%s: claims %s", tt.name, claims)
+		}
+
+		tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"uptime":100,"url":"https://example.com"}`)) + "." + parts[2]
+		if _, err := verifyJWT(tt.key, tampered); err == nil {
+			t.Errorf("%s: tampered claims verified", tt.name)
+		}
+		if _, err := verifyJWT(otherKey, token); err == nil {
+			t.Errorf("%s: verified with another key", tt.name)
+		}
+	}
+
+	for _, token := range []string{"", "a.b", "a.b.c.d", "a.b.!!!"} {
+		if _, err := verifyJWT(ecKey, token); err == nil {
+			t.Errorf("verifyJWT(%q) succeeded", token)
+		}
+	}
+}
+
+func TestSignJWTUnsupportedCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signJWT(key, nil, map[string]any{}); err == nil {
+		t.Error("signJWT with a P-384 key succeeded")
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
-	"crypto/tls"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/mail"
 	"net/smtp"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,39 +19,104 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// loadEnv reads .env when there is one. Without it the settings come from
+// the environment, as in containers.
 func loadEnv() {
 	err := godotenv.Load()
-	if err != nil {
-		fmt.Printf(err)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error loading .env: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 
-var checkedURLs = make(map[string]bool)
-var resetInterval = 5 * time.Minute
+var checkInterval = 600 * time.Second
 
 func main() {
-	loadEnv()
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "onboard" {
+		os.Exit(runOnboard())
+	}
+	demoMode := len(os.Args) > 1 && os.Args[1] == "demo"
 
-	const slackWebhookURL := os.Getenv("SLACK_WEBHOOK_URL")
+	loadEnv()
+	if err := loadCheckOutput(); err != nil {
+		fmt.Printf("Error setting up check output, results are not written to stdout: %v\n", err)
+	}
 
-	smtpServer := os.Getenv("SMTP_SERVER")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpUsername := os.Getenv("SMTP_USERNAME")
-	smtpPassword := os.Getenv("SMTP_PASSWORD")
-	senderEmail := os.Getenv("SENDER_EMAIL")
+	configureNotifiers()
 
 	dbUsername := os.Getenv("DB_USERNAME")
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
 	dbServer := os.Getenv("DB_SERVER")
 	dbPort := os.Getenv("DB_PORT")
+	if v := os.Getenv("CHECK_JITTER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f >= 1 {
+			fmt.Printf("Invalid CHECK_JITTER %q, using default of %g\n", v, checkJitter)
+		} else {
+			checkJitter = f
+		}
+	}
+	if v := os.Getenv("PROBE_REGION"); v != "" {
+		probeRegion = v
+	}
+	if v := os.Getenv("CHECK_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fmt.Printf("Invalid CHECK_CONCURRENCY %q, using default of %d\n", v, checkConcurrency)
+		} else {
+			checkConcurrency = n
+		}
+	}
+	if v := os.Getenv("MAX_REDIRECTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fmt.Printf("Invalid MAX_REDIRECTS %q, using default of %d\n", v, maxRedirects)
+		} else {
+			maxRedirects = n
+		}
+	}
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			fmt.Printf("Invalid MAX_BODY_BYTES %q, using default of %d\n", v, maxBodyBytes)
+		} else {
+			maxBodyBytes = n
+		}
+	}
+	if v := os.Getenv("NOTIFY_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fmt.Printf("Invalid NOTIFY_RETRIES %q, using default of %d\n", v, notifyRetries)
+		} else {
+			notifyRetries = n
+		}
+	}
+	loadDedupWindows()
+	if err := loadDKIM(); err != nil {
+		fmt.Printf("Error loading DKIM key, emails will be sent unsigned: %v\n", err)
+	}
+	if err := loadPush(); err != nil {
+		fmt.Printf("Error setting up push notifications: %v\n", err)
+	}
+	if err := loadVAPID(); err != nil {
+		fmt.Printf("Error loading VAPID key, web push is disabled: %v\n", err)
+	}
+	if err := loadSLAKey(); err != nil {
+		fmt.Printf("Error loading SLA signing key, public SLA statements are disabled: %v\n", err)
+	}
+	if err := loadSyslog(); err != nil {
+		fmt.Printf("Error setting up syslog, events are not exported: %v\n", err)
+	}
 	//currentTime := time.Now()
 
 	//timeString := currentTime.Format("2006-01-02 15:04:05")
 	sendSlackMessage("MONITOR --> Starting script..")
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", dbUsername, dbPassword, dbServer, dbPort, dbName))
+	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&loc=Local", dbUsername, dbPassword, dbServer, dbPort, dbName))
 	if err != nil {
 		fmt.Printf("Error connecting to the database: %v\n", err)
 		sendSlackMessage("WARNING --> Database connection error")
@@ -53,55 +124,50 @@ func main() {
 	}
 	defer db.Close()
 	fmt.Println("Database connected")
-	sendSlackMessage("MONITOR --> Database connected \nMONITOR --> Script started")
-	websites, err := getWebsiteURLs(db)
-	if err != nil {
-		fmt.Printf("Error fetching website URLs: %v\n", err)
+	readDB := db
+	if dsn := os.Getenv("DB_READ_DSN"); dsn != "" {
+		replica, err := openReadReplica(dsn)
+		if err != nil {
+			fmt.Printf("Error connecting to the read replica, reading from the primary: %v\n", err)
+			sendSlackMessage("WARNING --> Read replica connection error, reading from the primary")
+		} else {
+			defer replica.Close()
+			readDB = replica
+			fmt.Println("Read replica connected")
+		}
 	}
-
-	for _, url := range websites {
-		checkWebsite(url, db)
+	if err := migrateDB(db); err != nil {
+		fmt.Printf("Error migrating the database: %v\n", err)
+		sendSlackMessage("WARNING --> Database migration error")
+		return
 	}
-
-	//sendSlackMessage(fmt.Sprintf("MONITOR --> Checked all websites. TIME: %s", timeString))
-
-	interval := 600 * time.Second
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	go func() {
-		for {
-			time.Sleep(resetInterval)
-			resetCheckedURLs()
-			//sendSlackMessage("MONITOR --> Reset URL MAP ")
-		}
-	}()
-
-	for {
-		select {
-		case <-ticker.C:
-			websites, err := getWebsiteURLs(db)
-			if err != nil {
-				fmt.Printf("Error fetching website URLs: %v\n", err)
-				continue
-			}
-			//sendSlackMessage(fmt.Sprintf("MONITOR --> Checked all websites. TIME: %s", timeString))
-			//printMemoryUsage()
-
-			for _, url := range websites {
-				if !checkedURLs[url] {
-					checkWebsite(url, db)
-					checkedURLs[url] = true
-				}
-			}
+	startEventLog(db)
+	startNotificationLog(db)
+	sendSlackMessage("MONITOR --> Database connected \nMONITOR --> Script started")
+	if demoMode {
+		if err := startDemo(db); err != nil {
+			fmt.Printf("Error starting demo: %v\n", err)
+			return
 		}
+		checkInterval = 30 * time.Second
 	}
-}
-
-func resetCheckedURLs() {
-	// Clear the checkedURLs map
-	checkedURLs = make(map[string]bool)
+	startAPI(db, readDB)
+
+	registerJob("sitemap", fmt.Sprintf("@every %v", sitemapInterval), func() error { return runSitemapChecks(db) })
+	registerJob("monthly-reports", "@hourly", func() error { return runMonthlyReports(db, readDB, time.Now()) })
+	registerJob("quarterly-reviews", "@hourly", func() error { return runQuarterlyReviews(db, readDB, time.Now()) })
+	registerJob("prune", "@daily", func() error { return errors.Join(pruneCheckResults(db), pruneEvents(db), pruneNotifications(db)) })
+	registerJob("canary", fmt.Sprintf("@every %v", canaryInterval), func() error { return runCanaryChecks(db) })
+	registerJob("whois", fmt.Sprintf("@every %v", whoisInterval), func() error { return runWhoisChecks(db) })
+	registerJob("regions", fmt.Sprintf("@every %v", regionInterval), func() error { return runRegionChecks(db) })
+	registerJob("geo-dns", fmt.Sprintf("@every %v", geoDNSInterval), func() error { return runGeoDNSChecks(db) })
+	registerJob("expiring-trend", "0 8 * * *", func() error { return runExpiringTrend(db, time.Now()) })
+	registerJob("escalations", "@every 1m", func() error { return runEscalations(db, time.Now()) })
+	registerJob("confirmations", "@every 1m", func() error { return runConfirmations(db) })
+	registerJob("channel-checks", "@hourly", func() error { return runChannelChecks(db) })
+	startJobs(db)
+
+	runScheduler(db)
 }
 
 func printMemoryUsage() {
@@ -113,25 +179,44 @@ func printMemoryUsage() {
 }
 
 func sendSlackMessage(message string) {
+	if ok, reason := notifierEnabled("slack"); !ok {
+		fmt.Printf("Slack is disabled, not sending: %s\n", message)
+		recordSkippedNotification("slack", "", message, "disabled: "+reason)
+		return
+	}
+	if !shouldDeliver("slack", slackWebhookURL, message) {
+		fmt.Printf("Skipped duplicate Slack message: %s\n", message)
+		recordSkippedNotification("slack", "", message, "duplicate")
+		return
+	}
+
+	attempts, err := retryDelivery(func() error { return deliverSlack(message) })
+	if err != nil {
+		fmt.Printf("Error sending Slack message: %v\n", err)
+	}
+	recordNotification("slack", "", message, attempts, err)
+}
+
+func deliverSlack(message string) error {
 	message = strings.ReplaceAll(message, `"`, `\"`)
 	payload := `{"text": "` + message + `"}`
 
 	resp, err := http.Post(slackWebhookURL, "application/json", strings.NewReader(payload))
 	if err != nil {
-		fmt.Printf("Error sending Slack message: %v\n", err)
-		return
+		return err
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Slack API returned non-OK status: %s\n", resp.Status)
-		return
+		return fmt.Errorf("Slack API returned non-OK status: %s", resp.Status)
 	}
+	return nil
 }
 
+// getWebsiteURLs returns the websites that aren't paused.
 func getWebsiteURLs(db *sql.DB) ([]string, error) {
-	query := "SELECT website_url FROM websites"
+	query := "SELECT website_url FROM websites WHERE NOT paused"
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -158,6 +243,15 @@ func updateWebsiteStatus(db *sql.DB, url string, status string, responseTime tim
 	if err != nil {
 		fmt.Printf("Error updating website status for %s: %v\n", url, err)
 	}
+	trackIncident(db, url, status)
+	saveCheckResult(db, url, status, responseTime)
+	countFailure(db, url, status)
+}
+
+// statusUp reports whether a status counts as up. Degraded websites respond,
+// they don't open incidents or count as failures.
+func statusUp(status string) bool {
+	return status == "Up" || strings.HasPrefix(status, "Degraded")
 }
 
 func saveRespTime(db *sql.DB, url string, responseTime time.Duration) {
@@ -168,107 +262,280 @@ func saveRespTime(db *sql.DB, url string, responseTime time.Duration) {
 	}
 }
 
-func checkSSL(db *sql.DB, url string) {
-	strippedURL := strings.TrimPrefix(url, "https://")
-	conn, err := tls.Dial("tcp", strippedURL+":443", nil)
+// checkSSL records the certificate of the website. It returns an error when
+// the TLS handshake fails or the certificate doesn't match the hostname.
+func checkSSL(db *sql.DB, url string, settings websiteSettings) error {
+	host, addr, err := tlsAddress(url)
+	if err != nil {
+		return fmt.Errorf("invalid website URL: %v", err)
+	}
+	conn, err := dialTLS(settings, addr)
 	if err != nil {
-		panic("Server doesn't support SSL certificate err: " + err.Error())
+		return fmt.Errorf("server doesn't support SSL: %v", err)
 	}
+	defer conn.Close()
 
-	err = conn.VerifyHostname(strippedURL)
+	err = conn.VerifyHostname(host)
 	if err != nil {
-		panic("Hostname doesn't match with certificate: " + err.Error())
+		return fmt.Errorf("hostname doesn't match with certificate: %v", err)
 	}
-	expiry := conn.ConnectionState().PeerCertificates[0].NotAfter
+	cert := conn.ConnectionState().PeerCertificates[0]
+	expiry := cert.NotAfter
 
-	issuer := conn.ConnectionState().PeerCertificates[0].Issuer.String()
+	issuer := cert.Issuer.String()
 	expiredssl := expiry.Format(time.RFC850)
 
-	query := "UPDATE websites SET ssl_issuer = ?, ssl_expired_date = ? WHERE website_url = ?"
-	_, err = db.Exec(query, issuer, expiredssl, url)
+	checkIssuerPolicy(db, url, cert, settings)
+
+	query := "UPDATE websites SET ssl_issuer = ?, ssl_issuer_org = ?, ssl_expired_date = ?, ssl_expires_at = ? WHERE website_url = ?"
+	_, err = db.Exec(query, issuer, issuerOrganization(cert), expiredssl, expiry, url)
 	if err != nil {
 		fmt.Printf("Error updating website ssl info for %s: %v\n", url, err)
 	}
+	return nil
 }
 
 func sendEmail(to, subject, body string) {
-	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpServer)
-	msg := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s", to, subject, body)
+	if ok, reason := notifierEnabled("email"); !ok {
+		fmt.Printf("Email is disabled, not sending to %s: %s\n", to, subject)
+		recordSkippedNotification("email", to, subject, "disabled: "+reason)
+		return
+	}
+	if !shouldDeliver("email", to, subject+"\n"+body) {
+		fmt.Printf("Skipped duplicate email to %s: %s\n", to, subject)
+		recordSkippedNotification("email", to, subject, "duplicate")
+		return
+	}
 
-	err := smtp.SendMail(fmt.Sprintf("%s:%d", smtpServer, smtpPort), auth, senderEmail, []string{to}, []byte(msg))
+	attempts, err := retryDelivery(func() error { return deliverEmail(to, subject, body) })
 	if err != nil {
 		fmt.Printf("Error sending email: %v\n", err)
 	}
+	recordNotification("email", to, subject, attempts, err)
+}
+
+func deliverEmail(to, subject, body string) error {
+	var auth smtp.Auth
+	if smtpUsername != "" {
+		auth = smtp.PlainAuth("", smtpUsername, smtpPassword, smtpServer)
+	}
+	msg := buildEmail(to, subject, body)
+
+	if dkimKey != nil {
+		signed, err := dkimSign(msg)
+		if err != nil {
+			fmt.Printf("Error signing email: %v\n", err)
+		} else {
+			msg = signed
+		}
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%s", smtpServer, smtpPort), auth, senderEmail, []string{to}, msg)
+}
+
+func buildEmail(to, subject, body string) []byte {
+	domain := senderEmail[strings.LastIndex(senderEmail, "@")+1:]
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	from := senderEmail
+	if name := os.Getenv("SENDER_NAME"); name != "" {
+		from = (&mail.Address{Name: name, Address: senderEmail}).String()
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	if replyTo := os.Getenv("REPLY_TO_EMAIL"); replyTo != "" {
+		fmt.Fprintf(&msg, "Reply-To: %s\r\n", replyTo)
+	}
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return []byte(msg.String())
 }
 
-func checkWebsite(url string, db *sql.DB) {
+// checkWebsite checks a website once and reports whether it is up.
+func checkWebsite(url string, db *sql.DB) bool {
+	settings := getWebsiteSettings(db, url)
+	if strings.HasPrefix(url, "https://") {
+		checkHTTP3(db, url, settings)
+	}
+
+	base, err := http.NewRequest(http.MethodGet, asciiURL(url), nil)
+	if err != nil {
+		fmt.Printf("Invalid website URL %s: %v\n", url, err)
+		return false
+	}
+
+	// prepare gives every attempt its own request, trace, client and redirect
+	// chain, so a retry doesn't see the redirects of the first request as a loop.
+	var req *http.Request
+	var trace *checkTrace
+	var client *http.Client
+	var chain *redirectChain
+	var body []byte
+	prepare := func() {
+		req, trace = base.Clone(base.Context()), nil
+		if settings.Debug {
+			req, trace = traceRequest(req)
+		}
+		client = checkClient(settings, trace)
+		chain = followRedirects(client, req.URL.String(), settings.MaxRedirects)
+	}
+
+	prepare()
 	startTime := time.Now()
-	resp, err := http.Get(url)
+	resp, err := client.Do(req)
+	if settings.WarmUp {
+		if reason := coldStart(settings, resp, err, time.Since(startTime)); reason != "" {
+			fmt.Printf("Retrying %s, the first request after an idle period %s\n", url, reason)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			prepare()
+			startTime = time.Now()
+			resp, err = client.Do(req)
+		}
+	}
 	currentTime := time.Now()
 
+	chain.finish(resp)
+	saveRedirectChain(db, url, chain)
+
+	if trace != nil {
+		defer func() {
+			trace.finish(resp, body, err)
+			saveDebugLog(db, url, trace)
+		}()
+	}
+
 	timeString := currentTime.Format("2006-01-02 15:04:05")
 
 	if err != nil {
+		recordStatusCode(db, url, 0)
 		if strings.Contains(err.Error(), "net/http: TLS handshake timeout") {
 			updateWebsiteStatus(db, url, err.Error(), 0)
 			fmt.Println("WEBSITE DOWN --> Error: " + err.Error())
 			fmt.Println("Current time:", timeString)
-			if err != nil {
-				sendSlackMessage(fmt.Sprintf("WARNING: Website %s could be down, please check. Status: %s \n Time: %s", url, err.Error(), timeString))
+			if err != nil && !settings.InMaintenance {
+				sendSlackMessage(withProviderStatus(db, url, fmt.Sprintf("WARNING: Website %s could be down, please check. Status: %s \n Time: %s", url, err.Error(), timeString)))
 			}
-			return
+			return false
 		} else if strings.Contains(err.Error(), "no such host") {
 			updateWebsiteStatus(db, url, err.Error(), 0)
 			fmt.Println("WEBSITE DOWN --> Error: " + err.Error())
 			fmt.Println("Current time:", timeString)
-			if err != nil {
-				sendSlackMessage(fmt.Sprintf("WARNING: Website %s could be down. Status: %s \n Time: %s", url, err.Error(), timeString))
+			if err != nil && !settings.InMaintenance {
+				sendSlackMessage(withProviderStatus(db, url, fmt.Sprintf("WARNING: Website %s could be down. Status: %s \n Time: %s", url, err.Error(), timeString)))
 			}
-			sendEmailToClient(db, url, err.Error())
-			return
+			if !settings.InMaintenance {
+				queueClientAlert(db, url, err.Error())
+			}
+			return false
 		} else {
 			updateWebsiteStatus(db, url, err.Error(), 0)
 			fmt.Println("WEBSITE DOWN --> Error: " + err.Error())
 			fmt.Println("Current time:", timeString)
 
-			sendEmailToClient(db, url, err.Error())
-			if err != nil {
-				sendSlackMessage(fmt.Sprintf("ATTENTION: Website %s is down. Status: %s \n Time: %s", url, err.Error(), timeString))
+			if !settings.InMaintenance {
+				queueClientAlert(db, url, err.Error())
 			}
-			return
+			if err != nil && !settings.InMaintenance {
+				sendSlackMessage(withProviderStatus(db, url, fmt.Sprintf("ATTENTION: Website %s is down. Status: %s \n Time: %s", url, err.Error(), timeString)))
+			}
+			return false
 		}
 	}
 
 	defer resp.Body.Close()
+	recordStatusCode(db, url, resp.StatusCode)
+	rememberProvider(db, url, resp.Header)
+
+	body, readErr := readBody(resp, settings.MaxBodyBytes)
+	if readErr != nil {
+		fmt.Printf("Error reading body for %s: %v\n", url, readErr)
+	}
 
 	responseTime := time.Since(startTime)
 
+	if chain.stopped() {
+		status := "Degraded (" + chain.problem() + ")"
+		reportDegraded(db, url, status, settings, timeString)
+		updateWebsiteStatus(db, url, status, responseTime)
+		return true
+	}
+
 	if resp.StatusCode == http.StatusOK {
-		updateWebsiteStatus(db, url, "Up", responseTime)
+		steps, err := getWebsiteSteps(db, url)
+		if err != nil {
+			fmt.Printf("Error fetching steps for %s: %v\n", url, err)
+		} else if len(steps) > 0 {
+			if err := runSteps(db, url, steps, settings); err != nil {
+				status := "Down (" + err.Error() + ")"
+				updateWebsiteStatus(db, url, status, 0)
+				fmt.Printf("Website %s failed a step: %v\n", url, err)
+
+				if !settings.InMaintenance {
+					queueClientAlert(db, url, status)
+					sendSlackMessage(withProviderStatus(db, url, fmt.Sprintf("WARNING: Website %s is down. Status: %s \n Time: %s", url, status, timeString)))
+				}
+				return false
+			}
+		}
+
+		status := "Up"
+		if problem := chain.problem(); problem != "" {
+			status = "Degraded (" + problem + ")"
+			reportDegraded(db, url, status, settings, timeString)
+		}
+		updateWebsiteStatus(db, url, status, responseTime)
 		saveRespTime(db, url, responseTime)
 		//sendSlackMessage(fmt.Sprintf("Website %s is up!\n", url))
 		//fmt.Println("RESPONSE TIME: ", responseTime)
 		//fmt.Println("Current time:", timeString)
-		checkSSL(db, url)
-		// whoisDomain(url)
+		checkResponseSchema(db, url, body, settings)
+		checkContentChange(db, url, body, settings)
+		checkCompression(db, url, settings)
+		checkEncoding(db, url, resp.Header.Get("Content-Type"), body, int64(len(body)) >= settings.MaxBodyBytes, settings)
+		checkSEO(db, url, resp.Header, body, settings)
+		if strings.HasPrefix(url, "https://") {
+			if err := checkSSL(db, url, settings); err != nil {
+				fmt.Printf("Error checking SSL certificate for %s: %v\n", url, err)
+				recordEvent(eventCheck, url, "SSL check failed: "+err.Error(), nil)
+			}
+		}
+		return true
 
 	} else {
 		updateWebsiteStatus(db, url, fmt.Sprintf("Down (Status Code: %d)", resp.StatusCode), 0)
 		fmt.Printf("Website %s is down. Status code: %d\n", url, resp.StatusCode)
 
-		sendEmailToClient(db, url, fmt.Sprintf("Down (Status Code: %d)", resp.StatusCode))
-		if err != nil {
-			sendSlackMessage(fmt.Sprintf("WARNING: Website %s is down. Status: %s \n Time: %s", url, err.Error(), timeString))
+		if !settings.InMaintenance {
+			queueClientAlert(db, url, fmt.Sprintf("Down (Status Code: %d)", resp.StatusCode))
 		}
 	}
+
+	return false
 }
 
-func sendEmailToClient(db *sql.DB, url, status string) {
+func getClientEmail(db *sql.DB, url string) (string, error) {
 	clientEmailQuery := "SELECT email FROM users WHERE id = (SELECT client FROM websites WHERE website_url = ?)"
 	row := db.QueryRow(clientEmailQuery, url)
 
 	var clientEmail string
 	err := row.Scan(&clientEmail)
+	return clientEmail, err
+}
+
+func sendEmailToClient(db *sql.DB, url, status string) {
+	clientEmail, err := getClientEmail(db, url)
 	if err != nil {
 		fmt.Printf("Error getting client email for %s: %v\n", url, err)
 		return
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maintenanceWindow is planned work on a website, or on all websites when URL
+// is nil. Checks keep running during the window but alerts are held back.
+type maintenanceWindow struct {
+	ID       int       `json:"id"`
+	URL      *string   `json:"url"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Reason   string    `json:"reason"`
+}
+
+// getMaintenanceWindows returns the windows that haven't ended yet at now.
+func getMaintenanceWindows(db *sql.DB, now time.Time) ([]maintenanceWindow, error) {
+	query := "SELECT id, website_url, starts_at, ends_at, COALESCE(reason, '') FROM maintenance_windows WHERE ends_at > ? ORDER BY starts_at"
+
+	rows, err := db.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []maintenanceWindow{}
+	for rows.Next() {
+		var mw maintenanceWindow
+		var url sql.NullString
+		if err := rows.Scan(&mw.ID, &url, &mw.StartsAt, &mw.EndsAt, &mw.Reason); err != nil {
+			return nil, err
+		}
+		if url.Valid {
+			mw.URL = &url.String
+		}
+		windows = append(windows, mw)
+	}
+
+	return windows, rows.Err()
+}
+
+// getWebsiteMaintenance returns the maintenance windows of a website, its own
+// and the global ones, that overlap the period.
+func getWebsiteMaintenance(db *sql.DB, url string, from, to time.Time) ([]maintenanceWindow, error) {
+	query := "SELECT id, website_url, starts_at, ends_at, COALESCE(reason, '') FROM maintenance_windows WHERE (website_url = ? OR website_url IS NULL) AND starts_at < ? AND ends_at > ? ORDER BY starts_at"
+
+	rows, err := db.Query(query, url, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []maintenanceWindow
+	for rows.Next() {
+		var mw maintenanceWindow
+		var url sql.NullString
+		if err := rows.Scan(&mw.ID, &url, &mw.StartsAt, &mw.EndsAt, &mw.Reason); err != nil {
+			return nil, err
+		}
+		if url.Valid {
+			mw.URL = &url.String
+		}
+		windows = append(windows, mw)
+	}
+
+	return windows, rows.Err()
+}
+
+// handleMaintenanceWindows serves GET /api/maintenance.
+func handleMaintenanceWindows(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		windows, err := getMaintenanceWindows(db, time.Now())
+		if err != nil {
+			fmt.Printf("Error getting maintenance windows: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		writeJSON(w, http.StatusOK, windows)
+	}
+}
+
+// handleCreateMaintenanceWindow serves POST /api/maintenance. Leave url out
+// for a window that covers all websites.
+func handleCreateMaintenanceWindow(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mw maintenanceWindow
+		if err := json.NewDecoder(r.Body).Decode(&mw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !mw.EndsAt.After(mw.StartsAt) {
+			writeError(w, http.StatusBadRequest, "ends_at must be after starts_at")
+			return
+		}
+
+		res, err := db.Exec("INSERT INTO maintenance_windows (website_url, starts_at, ends_at, reason) VALUES (?, ?, ?, ?)", mw.URL, mw.StartsAt, mw.EndsAt, mw.Reason)
+		if err != nil {
+			fmt.Printf("Error creating maintenance window: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		id, _ := res.LastInsertId()
+		mw.ID = int(id)
+
+		var url string
+		if mw.URL != nil {
+			url = *mw.URL
+		}
+		recordEvent(eventConfig, url, "Maintenance window added by "+requestActor(r), mw)
+
+		writeJSON(w, http.StatusCreated, mw)
+	}
+}
+
+// handleDeleteMaintenanceWindow serves DELETE /api/maintenance/{id}.
+func handleDeleteMaintenanceWindow(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := db.Exec("DELETE FROM maintenance_windows WHERE id = ?", r.PathValue("id"))
+		if err != nil {
+			fmt.Printf("Error deleting maintenance window: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeError(w, http.StatusNotFound, "maintenance window not found")
+			return
+		}
+		recordEvent(eventConfig, "", "Maintenance window "+r.PathValue("id")+" removed by "+requestActor(r), nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// monitorKeys returns the two keys duplicate monitors are found by. Monitors
+// with the same normalized URL check the same thing: scheme and host are
+// case-insensitive, the host is compared in punycode, default ports, a trailing
+// slash, the order of query parameters and the fragment don't matter. Monitors
+// with the same host and path, ignoring the scheme, www., the port and the
+// query, most likely overlap and are worth a warning.
+func monitorKeys(rawURL string) (string, string, error) {
+	u, err := neturl.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != "http" && scheme != "https") || u.Hostname() == "" {
+		return "", "", fmt.Errorf("%q is not a full http:// or https:// URL", rawURL)
+	}
+
+	host := strings.ToLower(asciiHost(u.Hostname()))
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	path := strings.TrimRight(u.EscapedPath(), "/")
+
+	exact := scheme + "://" + host
+	if port != "" {
+		exact += ":" + port
+	}
+	exact += path + "/"
+	if q := u.Query(); len(q) > 0 {
+		exact += "?" + q.Encode()
+	}
+
+	near := strings.TrimPrefix(host, "www.") + path + "/"
+	return exact, near, nil
+}
+
+// websiteDuplicates returns the monitor with the same normalized URL as
+// rawURL, if there is one, and the monitors that only share its host and path.
+func websiteDuplicates(db *sql.DB, rawURL string) (string, []string, error) {
+	exact, near, err := monitorKeys(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rows, err := db.Query("SELECT website_url FROM websites ORDER BY website_url")
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var same string
+	var overlapping []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return "", nil, err
+		}
+		e, n, err := monitorKeys(url)
+		if err != nil {
+			continue
+		}
+		switch {
+		case e == exact && same == "":
+			same = url
+		case n == near:
+			overlapping = append(overlapping, url)
+		}
+	}
+	return same, overlapping, rows.Err()
+}
+
+type newWebsite struct {
+	URL                  string `json:"url"`
+	Client               *int   `json:"client"`
+	CheckIntervalSeconds *int   `json:"check_interval_seconds"`
+}
+
+type addedWebsite struct {
+	URL        string   `json:"url"`
+	Result     string   `json:"result"` // added, merged or rejected
+	MergedInto string   `json:"merged_into,omitempty"`
+	Overlaps   []string `json:"overlaps,omitempty"`
+	Warning    string   `json:"warning,omitempty"`
+}
+
+// addWebsite adds a monitor unless it duplicates one. onDuplicate says what to
+// do with duplicates:
+//
+//   - merge (the default) keeps the existing monitor with the same normalized
+//     URL, only filling in its client and interval when it has none, and adds
+//     monitors that merely overlap with a warning,
+//   - warn adds the monitor in both cases and only warns,
+//   - reject adds nothing when there is a duplicate or an overlap.
+func addWebsite(db *sql.DB, w newWebsite, onDuplicate, actor string) (addedWebsite, error) {
+	w.URL = strings.TrimSpace(w.URL)
+	result := addedWebsite{URL: w.URL}
+
+	same, overlapping, err := websiteDuplicates(db, w.URL)
+	if err != nil {
+		return result, err
+	}
+	if same != "" {
+		overlapping = append([]string{same}, overlapping...)
+	}
+	result.Overlaps = overlapping
+
+	switch {
+	case onDuplicate == "reject" && len(overlapping) > 0:
+		result.Result = "rejected"
+		result.Warning = fmt.Sprintf("%s overlaps with %s", w.URL, strings.Join(overlapping, ", "))
+		return result, nil
+
+	case onDuplicate == "merge" && same != "":
+		query := "UPDATE websites SET client = COALESCE(client, ?), check_interval_seconds = COALESCE(check_interval_seconds, ?) WHERE website_url = ?"
+		if _, err := db.Exec(query, w.Client, w.CheckIntervalSeconds, same); err != nil {
+			return result, err
+		}
+		result.Result = "merged"
+		result.MergedInto = same
+		result.Overlaps = result.Overlaps[1:]
+		recordEvent(eventConfig, same, fmt.Sprintf("Duplicate %s merged into this website by %s", w.URL, actor), nil)
+		return result, nil
+	}
+
+	query := "INSERT INTO websites (website_url, client, check_interval_seconds) VALUES (?, ?, ?)"
+	if _, err := db.Exec(query, w.URL, w.Client, w.CheckIntervalSeconds); err != nil {
+		return result, err
+	}
+	result.Result = "added"
+	if len(overlapping) > 0 {
+		result.Warning = fmt.Sprintf("%s overlaps with %s, their alerts will likely fire together", w.URL, strings.Join(overlapping, ", "))
+	}
+	recordEvent(eventConfig, w.URL, "Website added by "+actor, map[string]any{"overlaps": overlapping})
+	return result, nil
+}
+
+func validNewWebsite(w newWebsite) error {
+	if _, _, err := monitorKeys(w.URL); err != nil {
+		return err
+	}
+	if w.CheckIntervalSeconds != nil && *w.CheckIntervalSeconds < 10 {
+		return fmt.Errorf("check_interval_seconds of %s must be at least 10", w.URL)
+	}
+	return nil
+}
+
+func validOnDuplicate(v string) (string, error) {
+	switch v {
+	case "":
+		return "merge", nil
+	case "merge", "warn", "reject":
+		return v, nil
+	}
+	return "", fmt.Errorf("on_duplicate must be merge, warn or reject")
+}
+
+// handleAddWebsite serves POST /api/websites with {"url": ..., "client": 3,
+// "check_interval_seconds": 300, "on_duplicate": "merge"}.
+func handleAddWebsite(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			newWebsite
+			OnDuplicate string `json:"on_duplicate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := validNewWebsite(body.newWebsite); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		onDuplicate, err := validOnDuplicate(body.OnDuplicate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		result, err := addWebsite(db, body.newWebsite, onDuplicate, requestActor(r))
+		if err != nil {
+			fmt.Printf("Error adding website %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		switch result.Result {
+		case "added":
+			writeJSON(w, http.StatusCreated, result)
+		case "rejected":
+			writeJSON(w, http.StatusConflict, result)
+		default:
+			writeJSON(w, http.StatusOK, result)
+		}
+	}
+}
+
+// handleImportWebsites serves POST /api/websites/import with
+// {"on_duplicate": "merge", "websites": [{"url": ...}, ...]}. The websites are
+// added one after the other, so duplicates within the import are found too.
+func handleImportWebsites(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			OnDuplicate string       `json:"on_duplicate"`
+			Websites    []newWebsite `json:"websites"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Websites) == 0 {
+			writeError(w, http.StatusBadRequest, "websites are required")
+			return
+		}
+		onDuplicate, err := validOnDuplicate(body.OnDuplicate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, website := range body.Websites {
+			if err := validNewWebsite(website); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		results := []addedWebsite{}
+		counts := make(map[string]int)
+		for _, website := range body.Websites {
+			result, err := addWebsite(db, website, onDuplicate, requestActor(r))
+			if err != nil {
+				fmt.Printf("Error importing website %s: %v\n", website.URL, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			results = append(results, result)
+			counts[result.Result]++
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"added":    counts["added"],
+			"merged":   counts["merged"],
+			"rejected": counts["rejected"],
+			"websites": results,
+		})
+	}
+}
+
+type duplicateGroup struct {
+	Kind     string   `json:"kind"` // duplicate or overlap
+	Key      string   `json:"key"`
+	Websites []string `json:"websites"`
+}
+
+// findDuplicateWebsites groups the monitors that already exist by normalized
+// URL and by host and path, for cleaning up duplicates added before this
+// check existed.
+func findDuplicateWebsites(db *sql.DB) ([]duplicateGroup, error) {
+	rows, err := db.Query("SELECT website_url FROM websites ORDER BY website_url")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exact := make(map[string][]string)
+	near := make(map[string][]string)
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		e, n, err := monitorKeys(url)
+		if err != nil {
+			continue
+		}
+		exact[e] = append(exact[e], url)
+		near[n] = append(near[n], url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	groups := []duplicateGroup{}
+	for key, urls := range exact {
+		if len(urls) > 1 {
+			groups = append(groups, duplicateGroup{Kind: "duplicate", Key: key, Websites: urls})
+		}
+	}
+	for key, urls := range near {
+		if len(urls) < 2 {
+			continue
+		}
+		// Leave out overlaps that are just one group of duplicates.
+		if e, _, _ := monitorKeys(urls[0]); len(exact[e]) == len(urls) {
+			continue
+		}
+		groups = append(groups, duplicateGroup{Kind: "overlap", Key: key, Websites: urls})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Kind != groups[j].Kind {
+			return groups[i].Kind < groups[j].Kind
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups, nil
+}
+
+// handleDuplicateWebsites serves GET /api/websites/duplicates.
+func handleDuplicateWebsites(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groups, err := findDuplicateWebsites(db)
+		if err != nil {
+			fmt.Printf("Error finding duplicate websites: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		writeJSON(w, http.StatusOK, groups)
+	}
+}
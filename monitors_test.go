@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestMonitorKeys(t *testing.T) {
+	tests := []struct {
+		url, exact, near string
+	}{
+		{"https://example.com", "https://example.com/", "example.com/"},
+		{"HTTPS://Example.COM:443/", "https://example.com/", "example.com/"},
+		{"http://www.example.com:80/shop/", "http://www.example.com/shop/", "example.com/shop/"},
+		{"https://example.com:8443/shop", "https://example.com:8443/shop/", "example.com/shop/"},
+		{"https://example.com/?b=2&a=1#top", "https://example.com/?a=1&b=2", "example.com/"},
+		{"https://bücher.example/", "https://xn--bcher-kva.example/", "xn--bcher-kva.example/"},
+	}
+
+	for _, tt := range tests {
+		exact, near, err := monitorKeys(tt.url)
+		if err != nil || exact != tt.exact || near != tt.near {
+			t.Errorf("monitorKeys(%q) = %q, %q, %v, want %q, %q", tt.url, exact, near, err, tt.exact, tt.near)
+		}
+	}
+
+	for _, url := range []string{"", "example.com", "ftp://example.com", "https://"} {
+		if _, _, err := monitorKeys(url); err == nil {
+			t.Errorf("monitorKeys(%q) succeeded", url)
+		}
+	}
+}
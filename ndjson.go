@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// With CHECK_OUTPUT=ndjson every check result is also written to stdout as
+// one JSON object per line, for piping the monitor into vector, fluent-bit or
+// jq. The log messages move to stderr so stdout carries nothing else.
+var pendingResults chan checkOutput
+
+type checkOutput struct {
+	CheckedAt    time.Time `json:"checked_at"`
+	URL          string    `json:"url"`
+	Region       string    `json:"region"`
+	Up           bool      `json:"up"`
+	Status       string    `json:"status"`
+	ResponseTime float64   `json:"response_time"`
+}
+
+func loadCheckOutput() error {
+	switch v := os.Getenv("CHECK_OUTPUT"); v {
+	case "":
+		return nil
+	case "ndjson":
+	default:
+		return fmt.Errorf("invalid CHECK_OUTPUT %q, the only output is ndjson", v)
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	os.Stdout = os.Stderr
+	pendingResults = make(chan checkOutput, 1000)
+	go func() {
+		for result := range pendingResults {
+			if err := out.Encode(result); err != nil {
+				fmt.Printf("Error writing check result of %s to stdout: %v\n", result.URL, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// emitCheckResult queues a check result for stdout without blocking the check
+// when the reader on the other end of the pipe falls behind.
+func emitCheckResult(url, status string, responseTime time.Duration) {
+	if pendingResults == nil {
+		return
+	}
+	result := checkOutput{CheckedAt: time.Now(), URL: url, Region: probeRegion, Up: statusUp(status), Status: status, ResponseTime: responseTime.Seconds()}
+	select {
+	case pendingResults <- result:
+	default:
+		fmt.Printf("Check output queue is full, dropped the result of %s\n", url)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// networkProfile describes how checks of a website reach the network, for
+// sites that are only reachable over a VPN such as wg0. The interface and
+// routing mark are only supported on Linux.
+type networkProfile struct {
+	Name          string
+	Interface     string
+	SourceAddress string
+	RoutingMark   int
+	DNSServer     string
+}
+
+// dialer returns a dialer that binds to the interface, source address and
+// routing mark of the profile and resolves names through its DNS server.
+func (p *networkProfile) dialer() *net.Dialer {
+	d := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: p.control,
+	}
+
+	if p.SourceAddress != "" {
+		d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(p.SourceAddress)}
+	}
+
+	if p.DNSServer != "" {
+		server := p.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolverDialer := &net.Dialer{Timeout: 5 * time.Second, Control: p.control}
+		if p.SourceAddress != "" {
+			resolverDialer.LocalAddr = &net.UDPAddr{IP: net.ParseIP(p.SourceAddress)}
+		}
+		d.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return resolverDialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"syscall"
+)
+
+// control applies the interface binding (SO_BINDTODEVICE, needs CAP_NET_RAW)
+// and routing mark (SO_MARK, needs CAP_NET_ADMIN) of the profile. The mark
+// selects a routing table through an `ip rule add fwmark` rule.
+func (p *networkProfile) control(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if p.Interface != "" {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, p.Interface)
+			if sockErr != nil {
+				return
+			}
+		}
+		if p.RoutingMark != 0 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, p.RoutingMark)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func (p *networkProfile) control(network, address string, c syscall.RawConn) error {
+	if p.Interface != "" || p.RoutingMark != 0 {
+		return errors.New("network profile interfaces and routing marks are only supported on Linux")
+	}
+	return nil
+}
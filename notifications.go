@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifyRetries is how often a failed delivery is attempted, including the
+// first try. It can be overridden with NOTIFY_RETRIES.
+var notifyRetries = 3
+
+// notificationRetention is how long the notification audit trail is kept.
+// It outlives the event log, disputes about a missed alert often come weeks
+// later.
+var notificationRetention = 365 * 24 * time.Hour
+
+type notificationAttempt struct {
+	ID          int64     `json:"id"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	Channel     string    `json:"channel"`
+	Recipient   *string   `json:"recipient"`
+	Summary     string    `json:"summary"`
+	Result      string    `json:"result"` // delivered, failed or skipped
+	Attempts    int       `json:"attempts"`
+	Error       *string   `json:"error"`
+}
+
+var pendingNotifications = make(chan notificationAttempt, 1000)
+
+// retryDelivery calls send until it succeeds or notifyRetries attempts
+// failed, waiting a little longer after every failure. It returns the number
+// of attempts.
+func retryDelivery(send func() error) (int, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = send()
+		if err == nil || attempt >= notifyRetries {
+			return attempt, err
+		}
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+}
+
+// recordNotification adds a delivery to the event log and the notification
+// audit trail.
+func recordNotification(channel, recipient, message string, attempts int, err error) {
+	details := map[string]any{"channel": channel, "delivered": err == nil, "attempts": attempts}
+	if recipient != "" {
+		details["recipient"] = recipient
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	recordEvent(eventNotification, "", message, details)
+
+	result := "delivered"
+	if err != nil {
+		result = "failed"
+	}
+	auditNotification(channel, recipient, message, result, attempts, err)
+}
+
+// recordSkippedNotification records a notification that wasn't sent, e.g.
+// because the same alert went out moments ago.
+func recordSkippedNotification(channel, recipient, message, reason string) {
+	auditNotification(channel, recipient, message, "skipped", 0, fmt.Errorf("%s", reason))
+}
+
+func auditNotification(channel, recipient, message, result string, attempts int, err error) {
+	n := notificationAttempt{AttemptedAt: time.Now(), Channel: channel, Summary: notificationSummary(message), Result: result, Attempts: attempts}
+	if recipient != "" {
+		n.Recipient = &recipient
+	}
+	if err != nil {
+		e := truncate(err.Error(), 1024)
+		n.Error = &e
+	}
+
+	select {
+	case pendingNotifications <- n:
+	default:
+		fmt.Printf("Notification log is full, dropped %s notification: %s\n", channel, n.Summary)
+	}
+}
+
+// notificationSummary is the first line of a message, which names the
+// website and what happened for all our alerts.
+func notificationSummary(message string) string {
+	message = strings.TrimSpace(message)
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		message = strings.TrimSpace(message[:i])
+	}
+	return truncate(message, 255)
+}
+
+func startNotificationLog(db *sql.DB) {
+	go func() {
+		for n := range pendingNotifications {
+			query := "INSERT INTO notification_attempts (attempted_at, channel, recipient, summary, result, attempts, error) VALUES (?, ?, ?, ?, ?, ?, ?)"
+			_, err := db.Exec(query, n.AttemptedAt, n.Channel, n.Recipient, n.Summary, n.Result, n.Attempts, n.Error)
+			if err != nil {
+				fmt.Printf("Error saving %s notification: %v\n", n.Channel, err)
+			}
+		}
+	}()
+}
+
+func pruneNotifications(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM notification_attempts WHERE attempted_at < ?", time.Now().Add(-notificationRetention))
+	if err != nil {
+		return fmt.Errorf("pruning notifications: %v", err)
+	}
+	return nil
+}
+
+// handleNotifications serves GET /api/notifications?channel=...&recipient=...&result=failed&q=...&from=...&to=...
+// with the newest attempts first, paginated like /api/events.
+func handleNotifications(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := queryTimeRange(r, 30*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		limit := intQuery(r, "limit", 100)
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+
+		query := "SELECT id, attempted_at, channel, recipient, summary, result, attempts, error FROM notification_attempts WHERE attempted_at BETWEEN ? AND ?"
+		args := []any{from, to}
+
+		for _, column := range []string{"channel", "recipient", "result"} {
+			if v := r.URL.Query().Get(column); v != "" {
+				query += " AND " + column + " = ?"
+				args = append(args, v)
+			}
+		}
+		if v := r.URL.Query().Get("q"); v != "" {
+			query += " AND summary LIKE ?"
+			args = append(args, "%"+v+"%")
+		}
+		if v := r.URL.Query().Get("cursor"); v != "" {
+			cursor, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+			query += " AND id < ?"
+			args = append(args, cursor)
+		}
+
+		query += " ORDER BY id DESC LIMIT ?"
+		args = append(args, limit+1)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			fmt.Printf("Error getting notifications: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer rows.Close()
+
+		notifications := []notificationAttempt{}
+		for rows.Next() {
+			var n notificationAttempt
+			var recipient, errorText sql.NullString
+			if err := rows.Scan(&n.ID, &n.AttemptedAt, &n.Channel, &recipient, &n.Summary, &n.Result, &n.Attempts, &errorText); err != nil {
+				fmt.Printf("Error reading notification: %v\n", err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			if recipient.Valid {
+				n.Recipient = &recipient.String
+			}
+			if errorText.Valid {
+				n.Error = &errorText.String
+			}
+			notifications = append(notifications, n)
+		}
+
+		var nextCursor *string
+		if len(notifications) > limit {
+			notifications = notifications[:limit]
+			c := strconv.FormatInt(notifications[limit-1].ID, 10)
+			nextCursor = &c
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"notifications": notifications,
+			"next_cursor":   nextCursor,
+		})
+	}
+}
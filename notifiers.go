@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Notifier settings, read from the environment by configureNotifiers.
+var (
+	slackWebhookURL string
+	smtpServer      string
+	smtpPort        string
+	smtpUsername    string
+	smtpPassword    string
+	senderEmail     string
+)
+
+type notifierStatus struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+var (
+	notifiersMu sync.Mutex
+	notifiers   = make(map[string]notifierStatus)
+)
+
+// configureNotifiers reads the Slack and SMTP settings and disables the
+// channels whose settings are missing or invalid, with a warning, instead of
+// failing every delivery later on. The monitor keeps checking either way.
+func configureNotifiers() {
+	slackWebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+	smtpServer = os.Getenv("SMTP_SERVER")
+	smtpPort = os.Getenv("SMTP_PORT")
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	senderEmail = os.Getenv("SENDER_EMAIL")
+
+	setNotifier("slack", slackProblem())
+	setNotifier("email", smtpProblem())
+}
+
+func slackProblem() string {
+	if slackWebhookURL == "" {
+		return "SLACK_WEBHOOK_URL is not set"
+	}
+	u, err := neturl.Parse(slackWebhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "SLACK_WEBHOOK_URL is not an https URL"
+	}
+	return ""
+}
+
+func smtpProblem() string {
+	switch {
+	case smtpServer == "":
+		return "SMTP_SERVER is not set"
+	case smtpPort == "":
+		return "SMTP_PORT is not set"
+	case senderEmail == "":
+		return "SENDER_EMAIL is not set"
+	}
+	if port, err := strconv.Atoi(smtpPort); err != nil || port <= 0 || port > 65535 {
+		return fmt.Sprintf("SMTP_PORT %q is not a port number", smtpPort)
+	}
+	if _, err := mail.ParseAddress(senderEmail); err != nil {
+		return fmt.Sprintf("SENDER_EMAIL %q is not an email address", senderEmail)
+	}
+	if (smtpUsername == "") != (smtpPassword == "") {
+		return "SMTP_USERNAME and SMTP_PASSWORD must be set together"
+	}
+	return ""
+}
+
+func setNotifier(channel, problem string) {
+	if problem != "" {
+		fmt.Printf("WARNING: %s notifications are disabled: %s\n", channel, problem)
+	}
+	notifiersMu.Lock()
+	notifiers[channel] = notifierStatus{Enabled: problem == "", Reason: problem}
+	notifiersMu.Unlock()
+}
+
+// notifierEnabled returns whether a channel can deliver, and why not.
+func notifierEnabled(channel string) (bool, string) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	status, ok := notifiers[channel]
+	if !ok {
+		return false, "not configured"
+	}
+	return status.Enabled, status.Reason
+}
+
+// handleHealth serves GET /health for load balancers and uptime checks of the
+// monitor itself. It fails only when the database is unreachable; disabled
+// notification channels make it report degraded.
+func handleHealth(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channels := make(map[string]notifierStatus)
+		notifiersMu.Lock()
+		for channel, status := range notifiers {
+			channels[channel] = status
+		}
+		notifiersMu.Unlock()
+		channels["push"] = notifierStatus{Enabled: len(pushProviders) > 0}
+		channels["webpush"] = notifierStatus{Enabled: vapidKey != nil}
+		for _, channel := range []string{"push", "webpush"} {
+			if !channels[channel].Enabled {
+				channels[channel] = notifierStatus{Reason: "not configured"}
+			}
+		}
+
+		status, code := "ok", http.StatusOK
+		if !channels["slack"].Enabled || !channels["email"].Enabled {
+			status = "degraded"
+		}
+		database := "ok"
+		if err := db.PingContext(r.Context()); err != nil {
+			status, code, database = "down", http.StatusServiceUnavailable, err.Error()
+		}
+
+		writeJSON(w, code, map[string]any{
+			"status":    status,
+			"database":  database,
+			"notifiers": channels,
+		})
+	}
+}
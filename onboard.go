@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+var statusPageSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+type onboardContact struct {
+	name, email, role string
+}
+
+type onboardWebsite struct {
+	url      string
+	interval int
+}
+
+// onboarding collects everything about a new client first and writes it in
+// one transaction at the end, so quitting halfway leaves nothing behind.
+type onboarding struct {
+	in *bufio.Reader
+
+	email        string
+	existingID   int
+	passwordHash string
+	contacts     []onboardContact
+	websites     []onboardWebsite
+	policy       string
+	newPolicy    bool
+	slug         string
+}
+
+// runOnboard is `uptimemonitor onboard`, which asks for the client user, its
+// contacts, websites, notification routing and status page, testing every
+// website right away. It returns the exit code.
+func runOnboard() int {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error loading .env: %v\n", err)
+		return 1
+	}
+
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&loc=Local", os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_SERVER"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+	db, err := sql.Open("mysql", dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		fmt.Printf("Error connecting to the database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	if err := migrateDB(db); err != nil {
+		fmt.Printf("Error migrating the database: %v\n", err)
+		return 1
+	}
+
+	o := &onboarding{in: bufio.NewReader(os.Stdin)}
+	steps := []func(*sql.DB) error{o.askClient, o.askContacts, o.askWebsites, o.askRouting, o.askStatusPage}
+	for _, step := range steps {
+		if err := step(db); err != nil {
+			if err == io.EOF {
+				fmt.Println("\nOnboarding cancelled, nothing was saved")
+			} else {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return 1
+		}
+	}
+
+	o.summary()
+	if !o.confirm("Create all of this?", true) {
+		fmt.Println("Onboarding cancelled, nothing was saved")
+		return 1
+	}
+	if err := o.save(db); err != nil {
+		fmt.Printf("Error saving the client: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Client %s is onboarded with %d websites\n", o.email, len(o.websites))
+	if o.slug != "" {
+		fmt.Printf("Status page: /public/status/%s\n", o.slug)
+	}
+	return 0
+}
+
+func (o *onboarding) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", prompt, def)
+	} else {
+		fmt.Printf("%s: ", prompt)
+	}
+	line, err := o.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", io.EOF
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (o *onboarding) confirm(prompt string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := o.ask(prompt+" ("+hint+")", "")
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func (o *onboarding) askClient(db *sql.DB) error {
+	fmt.Println("== Client")
+	for {
+		email, err := o.ask("Client email", "")
+		if err != nil {
+			return err
+		}
+		if _, err := mail.ParseAddress(email); err != nil {
+			fmt.Println("  That is not an email address")
+			continue
+		}
+		o.email = email
+		break
+	}
+
+	err := db.QueryRow("SELECT id FROM users WHERE email = ?", o.email).Scan(&o.existingID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if o.existingID != 0 && !o.confirm(fmt.Sprintf("  %s already exists (user %d), add to it?", o.email, o.existingID), true) {
+		return io.EOF
+	}
+
+	fmt.Println("  A password lets the client sign in to the dashboard, leave it empty for single sign-on only")
+	password, err := o.password("Dashboard password")
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		o.passwordHash = string(hash)
+	}
+	return nil
+}
+
+// password reads a line without echoing it when stdin is a terminal.
+func (o *onboarding) password(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return o.ask(prompt, "")
+	}
+	fmt.Printf("%s: ", prompt)
+	data, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (o *onboarding) askContacts(db *sql.DB) error {
+	fmt.Println("== Contacts (leave the name empty when done)")
+	for {
+		name, err := o.ask("Contact name", "")
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return nil
+		}
+		email, err := o.ask("  Email", "")
+		if err != nil {
+			return err
+		}
+		if _, err := mail.ParseAddress(email); err != nil {
+			fmt.Println("  That is not an email address, contact skipped")
+			continue
+		}
+		role, err := o.ask("  Role", "technical")
+		if err != nil {
+			return err
+		}
+		o.contacts = append(o.contacts, onboardContact{name: name, email: email, role: role})
+	}
+}
+
+func (o *onboarding) askWebsites(db *sql.DB) error {
+	fmt.Println("== Websites (leave the URL empty when done)")
+	for {
+		url, err := o.ask("Website URL", "")
+		if err != nil {
+			return err
+		}
+		if url == "" {
+			if len(o.websites) == 0 {
+				fmt.Println("  Add at least one website")
+				continue
+			}
+			return nil
+		}
+		if _, _, err := monitorKeys(url); err != nil {
+			fmt.Println("  Use a full http:// or https:// URL")
+			continue
+		}
+
+		same, overlapping, err := websiteDuplicates(db, url)
+		if err != nil {
+			return err
+		}
+		exact, _, _ := monitorKeys(url)
+		for _, w := range o.websites {
+			if e, _, _ := monitorKeys(w.url); e == exact {
+				same = w.url
+			}
+		}
+		if same != "" {
+			var owner sql.NullString
+			db.QueryRow("SELECT users.email FROM websites LEFT JOIN users ON users.id = websites.client WHERE websites.website_url = ?", same).Scan(&owner)
+			fmt.Printf("  %s is already monitored as %s (client %s), skipped\n", url, same, owner.String)
+			continue
+		}
+		if len(overlapping) > 0 {
+			fmt.Printf("  %s overlaps with %s\n", url, strings.Join(overlapping, ", "))
+			if !o.confirm("  Add it anyway?", false) {
+				continue
+			}
+		}
+
+		fmt.Printf("  Testing %s... ", url)
+		if result, err := testCheck(url); err != nil {
+			fmt.Printf("FAILED: %v\n", err)
+			if !o.confirm("  Add it anyway?", false) {
+				continue
+			}
+		} else {
+			fmt.Println(result)
+		}
+
+		interval, err := o.ask("  Check interval in seconds", strconv.Itoa(int(checkInterval.Seconds())))
+		if err != nil {
+			return err
+		}
+		seconds, err := strconv.Atoi(interval)
+		if err != nil || seconds < 10 {
+			fmt.Println("  Invalid interval, using the default")
+			seconds = int(checkInterval.Seconds())
+		}
+		o.websites = append(o.websites, onboardWebsite{url: url, interval: seconds})
+	}
+}
+
+// testCheck requests a website once the way a check does and describes the
+// result.
+func testCheck(url string) (string, error) {
+	client := checkClient(websiteSettings{MaxBodyBytes: maxBodyBytes}, nil)
+	client.Timeout = 30 * time.Second
+
+	start := time.Now()
+	resp, err := client.Get(asciiURL(url))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	readBody(resp, maxBodyBytes)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d after %v", resp.StatusCode, elapsed)
+	}
+	result := fmt.Sprintf("OK, %d in %v", resp.StatusCode, elapsed)
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result += fmt.Sprintf(", certificate valid until %s", resp.TLS.PeerCertificates[0].NotAfter.Format("2006-01-02"))
+	}
+	return result, nil
+}
+
+func (o *onboarding) askRouting(db *sql.DB) error {
+	fmt.Println("== Notification routing")
+	policies, err := getEscalationPolicies(db)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, p := range policies {
+		names = append(names, p.Name)
+	}
+	if len(names) > 0 {
+		fmt.Printf("  Existing escalation policies: %s\n", strings.Join(names, ", "))
+	}
+	fmt.Println("  \"new\" creates a policy alerting Slack right away and the client and contacts by email after 15 minutes")
+
+	for {
+		answer, err := o.ask("Escalation policy (empty for none)", "new")
+		if err != nil {
+			return err
+		}
+		if answer == "" || answer == "new" {
+			o.policy, o.newPolicy = "", answer == "new"
+			if o.newPolicy {
+				o.policy = o.email
+			}
+			return nil
+		}
+		for _, name := range names {
+			if name == answer {
+				o.policy = answer
+				return nil
+			}
+		}
+		fmt.Println("  There is no policy with that name")
+	}
+}
+
+func (o *onboarding) askStatusPage(db *sql.DB) error {
+	fmt.Println("== Status page")
+	def := ""
+	if at := strings.LastIndex(o.email, "@"); at >= 0 {
+		def = strings.ReplaceAll(strings.SplitN(o.email[at+1:], ".", 2)[0], "_", "-")
+	}
+	for {
+		slug, err := o.ask("Public status page name (\"-\" for none)", def)
+		if err != nil {
+			return err
+		}
+		if slug == "-" || slug == "" {
+			return nil
+		}
+		slug = strings.ToLower(slug)
+		if !statusPageSlug.MatchString(slug) {
+			fmt.Println("  Use lowercase letters, digits and dashes")
+			continue
+		}
+		var owner int
+		err = db.QueryRow("SELECT id FROM users WHERE status_page_slug = ?", slug).Scan(&owner)
+		if err == nil && owner != o.existingID {
+			fmt.Println("  That name is taken")
+			continue
+		} else if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		o.slug = slug
+		return nil
+	}
+}
+
+func (o *onboarding) summary() {
+	fmt.Println("== Summary")
+	if o.existingID != 0 {
+		fmt.Printf("Client:      %s (existing user %d)\n", o.email, o.existingID)
+	} else {
+		fmt.Printf("Client:      %s (new)\n", o.email)
+	}
+	fmt.Printf("Password:    %v\n", o.passwordHash != "")
+	for _, c := range o.contacts {
+		fmt.Printf("Contact:     %s <%s>, %s\n", c.name, c.email, c.role)
+	}
+	for _, w := range o.websites {
+		fmt.Printf("Website:     %s every %ds\n", w.url, w.interval)
+	}
+	switch {
+	case o.newPolicy:
+		fmt.Printf("Escalation:  new policy %s\n", o.policy)
+	case o.policy != "":
+		fmt.Printf("Escalation:  %s\n", o.policy)
+	default:
+		fmt.Println("Escalation:  none")
+	}
+	if o.slug != "" {
+		fmt.Printf("Status page: /public/status/%s\n", o.slug)
+	}
+}
+
+func (o *onboarding) save(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	clientID := o.existingID
+	if clientID == 0 {
+		res, err := tx.Exec("INSERT INTO users (email) VALUES (?)", o.email)
+		if err != nil {
+			return err
+		}
+		id, _ := res.LastInsertId()
+		clientID = int(id)
+	}
+	if o.passwordHash != "" {
+		if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", o.passwordHash, clientID); err != nil {
+			return err
+		}
+	}
+	if o.slug != "" {
+		if _, err := tx.Exec("UPDATE users SET status_page_slug = ? WHERE id = ?", o.slug, clientID); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range o.contacts {
+		if _, err := tx.Exec("INSERT INTO client_contacts (client, name, email, role) VALUES (?, ?, ?, ?)", clientID, c.name, c.email, c.role); err != nil {
+			return err
+		}
+	}
+
+	var policyID *int
+	if o.newPolicy {
+		policy := escalationPolicy{Name: o.policy, Steps: []escalationStep{{DelaySeconds: 0, Channel: "slack"}, {DelaySeconds: 900, Channel: "email"}}}
+		for _, c := range o.contacts {
+			policy.Steps = append(policy.Steps, escalationStep{DelaySeconds: 900, Channel: "email", Target: c.email})
+		}
+		if err := saveEscalationPolicyTx(tx, &policy); err != nil {
+			return err
+		}
+		policyID = &policy.ID
+	} else if o.policy != "" {
+		var id int
+		if err := tx.QueryRow("SELECT id FROM escalation_policies WHERE name = ?", o.policy).Scan(&id); err != nil {
+			return err
+		}
+		policyID = &id
+	}
+
+	for _, w := range o.websites {
+		_, err := tx.Exec("INSERT INTO websites (website_url, client, check_interval_seconds, escalation_policy_id) VALUES (?, ?, ?, ?)", w.url, clientID, w.interval, policyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	recordEvent(eventConfig, "", fmt.Sprintf("Client %s onboarded with %d websites", o.email, len(o.websites)), nil)
+	return nil
+}
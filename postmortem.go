@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rootCauseLabel = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// handleSetPostmortem serves PUT /api/incidents/{id}/postmortem with
+// {"notes": ..., "root_cause": "deploy"}. Only closed incidents get a
+// postmortem. Root causes are short labels such as deploy, dns, certificate,
+// capacity or third-party, so reviews can group on them.
+func handleSetPostmortem(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		var body struct {
+			Notes     string `json:"notes"`
+			RootCause string `json:"root_cause"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		body.RootCause = strings.ToLower(strings.TrimSpace(body.RootCause))
+		if body.RootCause != "" && !rootCauseLabel.MatchString(body.RootCause) {
+			writeError(w, http.StatusBadRequest, "root_cause must be a short label of letters, digits, - and _")
+			return
+		}
+
+		var url string
+		var ended sql.NullTime
+		err = db.QueryRow("SELECT website_url, ended_at FROM incidents WHERE id = ?", id).Scan(&url, &ended)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "incident not found")
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error getting incident %d: %v\n", id, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if !ended.Valid {
+			writeError(w, http.StatusConflict, "the incident is still open")
+			return
+		}
+
+		query := "UPDATE incidents SET postmortem = NULLIF(?, ''), root_cause = NULLIF(?, ''), postmortem_updated_at = NOW() WHERE id = ?"
+		if _, err := db.Exec(query, body.Notes, body.RootCause, id); err != nil {
+			fmt.Printf("Error saving postmortem of incident %d: %v\n", id, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		recordEvent(eventConfig, url, fmt.Sprintf("Postmortem of incident %d updated by %s", id, requestActor(r)), map[string]any{"root_cause": body.RootCause})
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "url": url, "root_cause": body.RootCause, "notes": body.Notes})
+	}
+}
+
+type causeSummary struct {
+	RootCause       string  `json:"root_cause"`
+	Incidents       int     `json:"incidents"`
+	DowntimeSeconds float64 `json:"downtime_seconds"`
+}
+
+type websiteReview struct {
+	URL string `json:"url"`
+	uptimeFigures
+	Incidents int `json:"incidents"`
+}
+
+type quarterlyReview struct {
+	Quarter             string          `json:"quarter"`
+	From                time.Time       `json:"from"`
+	To                  time.Time       `json:"to"`
+	Websites            []websiteReview `json:"websites"`
+	DowntimeSeconds     float64         `json:"downtime_seconds"`
+	Reliability         reliability     `json:"reliability"`
+	TopCauses           []causeSummary  `json:"top_causes"`
+	IncidentsWithoutRCA int             `json:"incidents_without_root_cause"`
+}
+
+// quarterStart returns the first day of the quarter t is in.
+func quarterStart(t time.Time) time.Time {
+	return time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+func quarterName(start time.Time) string {
+	return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+}
+
+// parseQuarter reads "2026-Q3".
+func parseQuarter(v string) (time.Time, error) {
+	var year, q int
+	if _, err := fmt.Sscanf(v, "%d-Q%d", &year, &q); err != nil || q < 1 || q > 4 {
+		return time.Time{}, fmt.Errorf("invalid quarter %q, use e.g. 2026-Q3", v)
+	}
+	return time.Date(year, time.Month((q-1)*3+1), 1, 0, 0, 0, 0, time.Local), nil
+}
+
+// buildQuarterlyReview sums up the incidents of the websites in the quarter.
+// Incidents still open at the end of the quarter count until then.
+func buildQuarterlyReview(db *sql.DB, urls []string, start time.Time) (quarterlyReview, error) {
+	from, to := start, start.AddDate(0, 3, 0)
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+
+	review := quarterlyReview{Quarter: quarterName(start), From: from, To: to, Websites: []websiteReview{}, TopCauses: []causeSummary{}}
+	causes := make(map[string]*causeSummary)
+
+	for _, url := range urls {
+		incidents, err := getIncidents(db, url, from, to)
+		if err != nil {
+			return review, err
+		}
+
+		figures, err := measureUptime(db, url, incidents, from, to)
+		if err != nil {
+			return review, err
+		}
+		review.Websites = append(review.Websites, websiteReview{URL: url, uptimeFigures: figures, Incidents: len(incidents)})
+		review.DowntimeSeconds += figures.DowntimeSeconds
+		review.Reliability.add(incidents, from, to)
+
+		for _, inc := range incidents {
+			if !inc.RootCause.Valid {
+				review.IncidentsWithoutRCA++
+				continue
+			}
+			c, ok := causes[inc.RootCause.String]
+			if !ok {
+				c = &causeSummary{RootCause: inc.RootCause.String}
+				causes[inc.RootCause.String] = c
+			}
+			c.Incidents++
+			c.DowntimeSeconds += downtime([]incident{inc}, from, to).Seconds()
+		}
+	}
+
+	for _, c := range causes {
+		review.TopCauses = append(review.TopCauses, *c)
+	}
+	sort.Slice(review.TopCauses, func(i, j int) bool {
+		if review.TopCauses[i].Incidents != review.TopCauses[j].Incidents {
+			return review.TopCauses[i].Incidents > review.TopCauses[j].Incidents
+		}
+		return review.TopCauses[i].DowntimeSeconds > review.TopCauses[j].DowntimeSeconds
+	})
+
+	return review, nil
+}
+
+func clientWebsiteURLs(db *sql.DB, clientID int) ([]string, string, error) {
+	websites, err := getClientWebsites(db)
+	if err != nil {
+		return nil, "", err
+	}
+	var urls []string
+	var email string
+	for _, w := range websites {
+		if w.clientID == clientID {
+			urls = append(urls, w.url)
+			email = w.email
+		}
+	}
+	return urls, email, nil
+}
+
+// handleQuarterlyReview serves GET /api/reviews/quarterly?quarter=2026-Q3 for
+// the websites of the signed in client. With the API token, pass client=<id>.
+func handleQuarterlyReview(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, ok := requestUser(r)
+		if !ok {
+			clientID = intQuery(r, "client", 0)
+			if clientID == 0 {
+				writeError(w, http.StatusBadRequest, "client is required")
+				return
+			}
+		}
+
+		start := quarterStart(time.Now())
+		if v := r.URL.Query().Get("quarter"); v != "" {
+			var err error
+			if start, err = parseQuarter(v); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		urls, _, err := clientWebsiteURLs(db, clientID)
+		if err != nil {
+			fmt.Printf("Error fetching websites of client %d: %v\n", clientID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		review, err := buildQuarterlyReview(db, urls, start)
+		if err != nil {
+			fmt.Printf("Error building quarterly review for client %d: %v\n", clientID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		writeJSON(w, http.StatusOK, review)
+	}
+}
+
+// runQuarterlyReviews emails each client the review of the previous quarter,
+// once per quarter, like runMonthlyReports.
+func runQuarterlyReviews(db, readDB *sql.DB, now time.Time) error {
+	start := quarterStart(now).AddDate(0, -3, 0)
+
+	var sent int
+	err := db.QueryRow("SELECT COUNT(*) FROM quarterly_reviews WHERE quarter = ?", quarterName(start)).Scan(&sent)
+	if err != nil {
+		return fmt.Errorf("checking quarterly reviews: %v", err)
+	}
+	if sent > 0 {
+		return nil
+	}
+
+	websites, err := getClientWebsites(readDB)
+	if err != nil {
+		return fmt.Errorf("fetching websites for quarterly reviews: %v", err)
+	}
+	byClient := make(map[string][]string)
+	var order []string
+	for _, w := range websites {
+		if _, ok := byClient[w.email]; !ok {
+			order = append(order, w.email)
+		}
+		byClient[w.email] = append(byClient[w.email], w.url)
+	}
+
+	for _, email := range order {
+		review, err := buildQuarterlyReview(readDB, byClient[email], start)
+		if err != nil {
+			fmt.Printf("Error building quarterly review for %s: %v\n", email, err)
+			continue
+		}
+		sendEmail(email, fmt.Sprintf("Quarterly reliability review %s", review.Quarter), quarterlyReviewText(review))
+	}
+
+	_, err = db.Exec("INSERT INTO quarterly_reviews (quarter, sent_at) VALUES (?, NOW())", quarterName(start))
+	if err != nil {
+		return fmt.Errorf("saving quarterly review run: %v", err)
+	}
+	sendSlackMessage(fmt.Sprintf("MONITOR --> Sent quarterly reviews for %s to %d clients", quarterName(start), len(order)))
+	return nil
+}
+
+func quarterlyReviewText(review quarterlyReview) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dear user,\n\nHere is the reliability review of your websites for %s.\n\n", review.Quarter)
+
+	fmt.Fprintf(&b, "Incidents: %d\n", review.Reliability.Incidents)
+	fmt.Fprintf(&b, "Total downtime: %v\n", (time.Duration(review.DowntimeSeconds) * time.Second).Round(time.Minute))
+	fmt.Fprintf(&b, "%s\n", review.Reliability)
+
+	if len(review.TopCauses) > 0 {
+		b.WriteString("\nTop causes:\n")
+		for _, c := range review.TopCauses {
+			fmt.Fprintf(&b, "   %s: %d incidents, %v down\n", c.RootCause, c.Incidents, (time.Duration(c.DowntimeSeconds) * time.Second).Round(time.Minute))
+		}
+		if review.IncidentsWithoutRCA > 0 {
+			fmt.Fprintf(&b, "   not analysed yet: %d incidents\n", review.IncidentsWithoutRCA)
+		}
+	}
+
+	b.WriteString("\nPer website:\n")
+	for _, w := range review.Websites {
+		if w.ScheduledDowntimeSeconds > 0 {
+			fmt.Fprintf(&b, "   %s: %.2f%% uptime, %.2f%% excluding scheduled maintenance, %d incidents\n", w.URL, w.UptimePercentage, w.SLAUptimePercentage, w.Incidents)
+		} else {
+			fmt.Fprintf(&b, "   %s: %.2f%% uptime, %d incidents\n", w.URL, w.UptimePercentage, w.Incidents)
+		}
+	}
+
+	b.WriteString("\nKind regards,\nUptimeMonitor")
+	return b.String()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// providerStatusTTL is how long a provider status page is cached, so an
+// outage of many websites behind the same CDN fetches it only once.
+var providerStatusTTL = 5 * time.Minute
+
+type statusProvider struct {
+	Name  string
+	URL   string
+	parse func([]byte) ([]string, error)
+}
+
+var statusProviders = map[string]statusProvider{
+	"cloudflare": {"Cloudflare", "https://www.cloudflarestatus.com/api/v2/incidents/unresolved.json", parseStatuspage},
+	"aws":        {"AWS", "https://health.aws.amazon.com/public/currentevents", parseAWSHealth},
+	"azure":      {"Azure", "https://rssfeed.azure.status.microsoft/en-us/status/feed/", parseAzureFeed},
+}
+
+var (
+	providerStatusMu    sync.Mutex
+	providerStatusCache = make(map[string]providerStatus)
+)
+
+type providerStatus struct {
+	fetched   time.Time
+	incidents []string
+}
+
+// detectProvider recognizes the CDN or cloud a response was served by from
+// the headers it adds.
+func detectProvider(h http.Header) string {
+	server := strings.ToLower(h.Get("Server"))
+	switch {
+	case h.Get("Cf-Ray") != "" || server == "cloudflare":
+		return "cloudflare"
+	case h.Get("X-Amz-Cf-Id") != "" || h.Get("X-Amz-Request-Id") != "" || h.Get("X-Amzn-Requestid") != "" ||
+		strings.HasPrefix(server, "amazons3") || strings.HasPrefix(server, "awselb") || server == "cloudfront":
+		return "aws"
+	case h.Get("X-Azure-Ref") != "" || h.Get("X-Msedge-Ref") != "" || strings.Contains(server, "azure"):
+		return "azure"
+	}
+	return ""
+}
+
+// rememberProvider stores the detected provider, since failures usually come
+// without the response headers to recognize it by. hosting_provider can be set
+// by hand for websites whose provider doesn't show in the headers.
+func rememberProvider(db *sql.DB, url string, h http.Header) {
+	provider := detectProvider(h)
+	_, err := db.Exec("UPDATE websites SET detected_provider = NULLIF(?, '') WHERE website_url = ? AND NOT (detected_provider <=> NULLIF(?, ''))", provider, url, provider)
+	if err != nil {
+		fmt.Printf("Error saving provider of %s: %v\n", url, err)
+	}
+}
+
+// withProviderStatus adds what the status page of the provider of the website
+// says to a down alert.
+func withProviderStatus(db *sql.DB, url, message string) string {
+	var name string
+	err := db.QueryRow("SELECT COALESCE(hosting_provider, detected_provider, '') FROM websites WHERE website_url = ?", url).Scan(&name)
+	if err != nil {
+		fmt.Printf("Error getting provider of %s: %v\n", url, err)
+		return message
+	}
+	provider, ok := statusProviders[strings.ToLower(name)]
+	if !ok {
+		return message
+	}
+
+	incidents, err := providerIncidents(provider)
+	if err != nil {
+		fmt.Printf("Error getting %s status: %v\n", provider.Name, err)
+		return message
+	}
+	if len(incidents) == 0 {
+		return message + fmt.Sprintf("\n%s reports no ongoing incidents.", provider.Name)
+	}
+	return message + fmt.Sprintf("\n%s reports ongoing incidents:\n- %s", provider.Name, strings.Join(incidents, "\n- "))
+}
+
+func providerIncidents(p statusProvider) ([]string, error) {
+	providerStatusMu.Lock()
+	cached, ok := providerStatusCache[p.Name]
+	providerStatusMu.Unlock()
+	if ok && time.Since(cached.fetched) < providerStatusTTL {
+		return cached.incidents, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(p.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status page returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	incidents, err := p.parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(incidents) > 5 {
+		incidents = append(incidents[:5], fmt.Sprintf("and %d more", len(incidents)-5))
+	}
+
+	providerStatusMu.Lock()
+	providerStatusCache[p.Name] = providerStatus{fetched: time.Now(), incidents: incidents}
+	providerStatusMu.Unlock()
+	return incidents, nil
+}
+
+// parseStatuspage reads the unresolved incidents of an Atlassian Statuspage.
+func parseStatuspage(data []byte) ([]string, error) {
+	var page struct {
+		Incidents []struct {
+			Name      string `json:"name"`
+			Status    string `json:"status"`
+			Shortlink string `json:"shortlink"`
+		} `json:"incidents"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+
+	var incidents []string
+	for _, inc := range page.Incidents {
+		incidents = append(incidents, strings.TrimSpace(fmt.Sprintf("%s (%s) %s", inc.Name, inc.Status, inc.Shortlink)))
+	}
+	return incidents, nil
+}
+
+// parseAWSHealth reads the current events of the AWS Health Dashboard, which
+// is served as UTF-16 with a byte order mark.
+func parseAWSHealth(data []byte) ([]string, error) {
+	if bytes.HasPrefix(data, []byte{0xff, 0xfe}) || bytes.HasPrefix(data, []byte{0xfe, 0xff}) {
+		decoded, err := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+
+	var events []struct {
+		ServiceName string `json:"service_name"`
+		RegionName  string `json:"region_name"`
+		Summary     string `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+
+	var incidents []string
+	for _, e := range events {
+		incidents = append(incidents, fmt.Sprintf("%s %s: %s", e.ServiceName, e.RegionName, e.Summary))
+	}
+	return incidents, nil
+}
+
+// parseAzureFeed reads the RSS feed of Azure status, which only has items
+// while there is an active incident.
+func parseAzureFeed(data []byte) ([]string, error) {
+	var feed struct {
+		Items []struct {
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+
+	var incidents []string
+	for _, item := range feed.Items {
+		incidents = append(incidents, strings.TrimSpace(item.Title+" "+item.Link))
+	}
+	return incidents, nil
+}
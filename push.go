@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushProvider delivers a notification to one device token. Gone reports
+// whether the token isn't valid anymore and should be forgotten.
+type pushProvider interface {
+	Send(token, title, body, url string) (gone bool, err error)
+	// Verify checks the credentials without notifying any device.
+	Verify() error
+}
+
+var pushProviders = make(map[string]pushProvider)
+
+var pushClient = &http.Client{Timeout: 15 * time.Second}
+
+// loadPush sets up FCM when FCM_CREDENTIALS_FILE points to a service account
+// JSON file, and APNs when APNS_KEY_PATH, APNS_KEY_ID, APNS_TEAM_ID and
+// APNS_TOPIC are set. APNS_SANDBOX=true uses the development environment.
+func loadPush() error {
+	var errs []error
+
+	if path := os.Getenv("FCM_CREDENTIALS_FILE"); path != "" {
+		p, err := newFCMProvider(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("FCM: %v", err))
+		} else {
+			pushProviders["fcm"] = p
+		}
+	}
+
+	if path := os.Getenv("APNS_KEY_PATH"); path != "" {
+		p, err := newAPNsProvider(path, os.Getenv("APNS_KEY_ID"), os.Getenv("APNS_TEAM_ID"), os.Getenv("APNS_TOPIC"), os.Getenv("APNS_SANDBOX") == "true")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("APNs: %v", err))
+		} else {
+			pushProviders["apns"] = p
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKey(data)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
+
+// sendPush notifies every device registered by the user with the email, for
+// clients that would rather get a push than wait for an email.
+func sendPush(db *sql.DB, email, title, body, url string) {
+	if len(pushProviders) == 0 {
+		return
+	}
+
+	query := "SELECT push_devices.id, push_devices.platform, push_devices.token FROM push_devices JOIN users ON users.id = push_devices.user_id WHERE users.email = ?"
+	rows, err := db.Query(query, email)
+	if err != nil {
+		fmt.Printf("Error getting push devices for %s: %v\n", email, err)
+		return
+	}
+	type device struct {
+		id              int
+		platform, token string
+	}
+	var devices []device
+	for rows.Next() {
+		var d device
+		if err := rows.Scan(&d.id, &d.platform, &d.token); err != nil {
+			fmt.Printf("Error getting push devices for %s: %v\n", email, err)
+			rows.Close()
+			return
+		}
+		devices = append(devices, d)
+	}
+	rows.Close()
+
+	for _, d := range devices {
+		provider, ok := pushProviders[d.platform]
+		if !ok {
+			continue
+		}
+		if !shouldDeliver("push", d.token, title+"\n"+body) {
+			recordSkippedNotification(d.platform, email, title, "duplicate")
+			continue
+		}
+
+		var gone bool
+		attempts, err := retryDelivery(func() error {
+			var err error
+			gone, err = provider.Send(d.token, title, body, url)
+			if gone {
+				return nil
+			}
+			return err
+		})
+		if gone {
+			fmt.Printf("Removing %s device %d of %s, the token is no longer valid\n", d.platform, d.id, email)
+			if _, err := db.Exec("DELETE FROM push_devices WHERE id = ?", d.id); err != nil {
+				fmt.Printf("Error removing push device %d: %v\n", d.id, err)
+			}
+			continue
+		}
+		recordNotification(d.platform, email, title, attempts, err)
+		if err != nil {
+			fmt.Printf("Error sending %s push to %s: %v\n", d.platform, email, err)
+			continue
+		}
+		if _, err := db.Exec("UPDATE push_devices SET last_used_at = NOW() WHERE id = ?", d.id); err != nil {
+			fmt.Printf("Error updating push device %d: %v\n", d.id, err)
+		}
+	}
+}
+
+type fcmProvider struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         crypto.Signer
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+func newFCMProvider(path string) (*fcmProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, errors.New("service account file has no project_id or client_email")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	key, err := parsePrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fcmProvider{projectID: account.ProjectID, clientEmail: account.ClientEmail, tokenURI: account.TokenURI, key: key}, nil
+}
+
+// token returns an OAuth access token for the service account, using the JWT
+// bearer grant. Tokens are reused until shortly before they expire.
+func (p *fcmProvider) token() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken != "" && time.Until(p.expires) > time.Minute {
+		return p.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := signJWT(p.key, nil, map[string]any{
+		"iss":   p.clientEmail,
+		"scope": "https://www.googleapis.com/auth/firebase.messaging",
+		"aud":   p.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	form := neturl.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	resp, err := pushClient.PostForm(p.tokenURI, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	p.accessToken = token.AccessToken
+	p.expires = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return p.accessToken, nil
+}
+
+// Verify gets a new access token, which fails when the service account key
+// was revoked.
+func (p *fcmProvider) Verify() error {
+	p.mu.Lock()
+	p.accessToken = ""
+	p.mu.Unlock()
+
+	_, err := p.token()
+	return err
+}
+
+func (p *fcmProvider) Send(deviceToken, title, body, url string) (bool, error) {
+	accessToken, err := p.token()
+	if err != nil {
+		return false, err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token":        deviceToken,
+			"notification": map[string]string{"title": title, "body": body},
+			"data":         map[string]string{"url": url},
+			"android":      map[string]string{"priority": "high"},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://fcm.googleapis.com/v1/projects/"+p.projectID+"/messages:send", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	gone := resp.StatusCode == http.StatusNotFound || bytes.Contains(respBody, []byte("UNREGISTERED"))
+	return gone, fmt.Errorf("FCM returned status %d: %s", resp.StatusCode, respBody)
+}
+
+type apnsProvider struct {
+	keyID  string
+	teamID string
+	topic  string
+	host   string
+	key    crypto.Signer
+
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+func newAPNsProvider(path, keyID, teamID, topic string, sandbox bool) (*apnsProvider, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required")
+	}
+	key, err := readPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		return nil, errors.New("APNs key is not an ECDSA key")
+	}
+
+	host := "https://api.push.apple.com"
+	if sandbox {
+		host = "https://api.sandbox.push.apple.com"
+	}
+	return &apnsProvider{keyID: keyID, teamID: teamID, topic: topic, host: host, key: key}, nil
+}
+
+// token returns the provider token. Apple rejects tokens older than an hour
+// and also ones refreshed more than once every 20 minutes.
+func (p *apnsProvider) token() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jwt != "" && time.Since(p.issuedAt) < 50*time.Minute {
+		return p.jwt, nil
+	}
+
+	now := time.Now()
+	token, err := signJWT(p.key, map[string]any{"kid": p.keyID}, map[string]any{"iss": p.teamID, "iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	p.jwt, p.issuedAt = token, now
+	return token, nil
+}
+
+// Verify sends to a device token that can't exist. APNs answers BadDeviceToken
+// when it accepted the provider token, and 403 when the key isn't valid.
+func (p *apnsProvider) Verify() error {
+	_, err := p.Send(strings.Repeat("0", 64), "", "", "")
+	if err != nil && strings.HasSuffix(err.Error(), "BadDeviceToken") {
+		return nil
+	}
+	if err == nil {
+		return errors.New("APNs accepted a device token that can't exist")
+	}
+	return err
+}
+
+func (p *apnsProvider) Send(deviceToken, title, body, url string) (bool, error) {
+	token, err := p.token()
+	if err != nil {
+		return false, err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{"title": title, "body": body},
+			"sound": "default",
+		},
+		"url": url,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.host+"/3/device/"+neturl.PathEscape(deviceToken), bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", p.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	// APNs only speaks HTTP/2, which the default transport negotiates.
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&reason)
+	gone := resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "Unregistered"
+	return gone, fmt.Errorf("APNs returned status %d: %s", resp.StatusCode, reason.Reason)
+}
+
+type pushDevice struct {
+	ID         int        `json:"id"`
+	Platform   string     `json:"platform"`
+	Token      string     `json:"token"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// handleRegisterPushDevice serves POST /api/push/devices with {"platform":
+// "fcm" or "apns", "token": ...} for the signed in user. Registering a token
+// again moves it to the current user.
+func handleRegisterPushDevice(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "devices can only be registered by a signed in user")
+			return
+		}
+
+		var body struct {
+			Platform string `json:"platform"`
+			Token    string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" || len(body.Token) > 255 {
+			writeError(w, http.StatusBadRequest, "platform and token are required")
+			return
+		}
+		body.Platform = strings.ToLower(body.Platform)
+		if body.Platform != "fcm" && body.Platform != "apns" {
+			writeError(w, http.StatusBadRequest, "platform must be fcm or apns")
+			return
+		}
+
+		query := "INSERT INTO push_devices (user_id, platform, token, created_at) VALUES (?, ?, ?, NOW()) ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), platform = VALUES(platform)"
+		if _, err := db.Exec(query, userID, body.Platform, body.Token); err != nil {
+			fmt.Printf("Error registering push device for user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, body)
+	}
+}
+
+// handleListPushDevices serves GET /api/push/devices for the signed in user.
+func handleListPushDevices(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "not signed in")
+			return
+		}
+
+		rows, err := db.Query("SELECT id, platform, token, created_at, last_used_at FROM push_devices WHERE user_id = ? ORDER BY created_at", userID)
+		if err != nil {
+			fmt.Printf("Error getting push devices for user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer rows.Close()
+
+		devices := []pushDevice{}
+		for rows.Next() {
+			var d pushDevice
+			var lastUsed sql.NullTime
+			if err := rows.Scan(&d.ID, &d.Platform, &d.Token, &d.CreatedAt, &lastUsed); err != nil {
+				fmt.Printf("Error getting push devices for user %d: %v\n", userID, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			if lastUsed.Valid {
+				d.LastUsedAt = &lastUsed.Time
+			}
+			devices = append(devices, d)
+		}
+
+		writeJSON(w, http.StatusOK, devices)
+	}
+}
+
+// handleDeletePushDevice serves DELETE /api/push/devices/{id}.
+func handleDeletePushDevice(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "not signed in")
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		res, err := db.Exec("DELETE FROM push_devices WHERE id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			fmt.Printf("Error deleting push device %d: %v\n", id, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
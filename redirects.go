@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxRedirects is how many redirects a check follows before the website is
+// Degraded (MAX_REDIRECTS, or max_redirects of the website). Every hop costs
+// a round trip, so long chains show up as a slow website.
+var maxRedirects = 3
+
+// redirectHardLimit stops following a chain, so a check always ends.
+const redirectHardLimit = 20
+
+type redirectHop struct {
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+}
+
+type redirectChain struct {
+	Hops []redirectHop `json:"hops"`
+	Loop bool          `json:"loop"`
+	max  int
+}
+
+// followRedirects records the redirect chain of the requests of client, on
+// top of any CheckRedirect it already has.
+func followRedirects(client *http.Client, url string, max int) *redirectChain {
+	chain := &redirectChain{Hops: []redirectHop{{URL: url}}, max: max}
+
+	next := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.Response != nil {
+			chain.Hops[len(chain.Hops)-1].Status = req.Response.StatusCode
+		}
+
+		target := req.URL.String()
+		for _, hop := range chain.Hops {
+			if hop.URL == target {
+				chain.Loop = true
+			}
+		}
+		chain.Hops = append(chain.Hops, redirectHop{URL: target})
+
+		// Stopping returns the redirect response itself, which the check
+		// reports instead of a client error.
+		if chain.Loop || len(via) >= redirectHardLimit {
+			return http.ErrUseLastResponse
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+
+	return chain
+}
+
+func (c *redirectChain) finish(resp *http.Response) {
+	if resp != nil && !c.stopped() && c.Hops[len(c.Hops)-1].Status == 0 {
+		c.Hops[len(c.Hops)-1].Status = resp.StatusCode
+	}
+}
+
+// stopped reports whether the chain wasn't followed to its end.
+func (c *redirectChain) stopped() bool {
+	return c.Loop || c.redirects() >= redirectHardLimit
+}
+
+func (c *redirectChain) redirects() int {
+	return len(c.Hops) - 1
+}
+
+func (c *redirectChain) String() string {
+	urls := make([]string, len(c.Hops))
+	for i, hop := range c.Hops {
+		urls[i] = hop.URL
+		if hop.Status != 0 {
+			urls[i] += fmt.Sprintf(" (%d)", hop.Status)
+		}
+	}
+	return strings.Join(urls, " -> ")
+}
+
+// problem describes why the chain makes the website Degraded, or returns ""
+// when it doesn't.
+func (c *redirectChain) problem() string {
+	switch {
+	case c.Loop:
+		return "redirect loop: " + c.String()
+	case c.stopped():
+		return fmt.Sprintf("stopped after %d redirects: %s", c.redirects(), c.String())
+	case c.redirects() > c.max:
+		return fmt.Sprintf("%d redirects: %s", c.redirects(), c.String())
+	}
+	return ""
+}
+
+// saveRedirectChain stores the chain of the current check, saveCheckResult
+// copies it into the check result.
+func saveRedirectChain(db *sql.DB, url string, c *redirectChain) {
+	var chain any
+	if c.redirects() > 0 {
+		data, err := json.Marshal(c)
+		if err == nil {
+			chain = string(data)
+		}
+	}
+
+	_, err := db.Exec("UPDATE websites SET redirect_chain = ? WHERE website_url = ?", chain, url)
+	if err != nil {
+		fmt.Printf("Error saving redirect chain for %s: %v\n", url, err)
+	}
+}
+
+// reportDegraded alerts when the website wasn't Degraded on the previous
+// check. Call it before the new status is stored.
+func reportDegraded(db *sql.DB, url, status string, settings websiteSettings, timeString string) {
+	var previous string
+	err := db.QueryRow("SELECT COALESCE(website_status, '') FROM websites WHERE website_url = ?", url).Scan(&previous)
+	if err != nil {
+		fmt.Printf("Error getting status of %s: %v\n", url, err)
+	}
+
+	fmt.Printf("Website %s is degraded: %s\n", url, status)
+	if strings.HasPrefix(previous, "Degraded") || settings.InMaintenance {
+		return
+	}
+	sendSlackMessage(fmt.Sprintf("WARNING: Website %s is degraded. Status: %s \n Time: %s", url, status, timeString))
+}
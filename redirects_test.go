@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFollowRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/once", http.RedirectHandler("/ok", http.StatusMovedPermanently))
+	mux.Handle("/loop-a", http.RedirectHandler("/loop-b", http.StatusFound))
+	mux.Handle("/loop-b", http.RedirectHandler("/loop-a", http.StatusFound))
+	mux.Handle("/long-1", http.RedirectHandler("/long-2", http.StatusFound))
+	mux.Handle("/long-2", http.RedirectHandler("/long-3", http.StatusFound))
+	mux.Handle("/long-3", http.RedirectHandler("/long-4", http.StatusFound))
+	mux.Handle("/long-4", http.RedirectHandler("/ok", http.StatusFound))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path      string
+		redirects int
+		loop      bool
+		problem   string
+		status    int
+	}{
+		{"/ok", 0, false, "", http.StatusOK},
+		{"/once", 1, false, "", http.StatusOK},
+		{"/loop-a", 2, true, "redirect loop: ", http.StatusFound},
+		{"/long-1", 4, false, "4 redirects: ", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		client := &http.Client{}
+		chain := followRedirects(client, server.URL+tt.path, 3)
+		resp, err := client.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		chain.finish(resp)
+
+		if chain.redirects() != tt.redirects || chain.Loop != tt.loop {
+			t.Errorf("%s: %d redirects, loop %t, want %d, %t", tt.path, chain.redirects(), chain.Loop, tt.redirects, tt.loop)
+		}
+		if problem := chain.problem(); (tt.problem == "") != (problem == "") || !strings.HasPrefix(problem, tt.problem) {
+			t.Errorf("%s: problem %q, want prefix %q", tt.path, problem, tt.problem)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.path, resp.StatusCode, tt.status)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// probeRegion is the region this monitor checks from. Run one monitor per
+// region against the same database to get multi-region checks.
+var probeRegion = "default"
+
+var regionInterval = 5 * time.Minute
+var regionWindow = 15 * time.Minute
+
+type regionStat struct {
+	Region       string  `json:"region"`
+	Checks       int     `json:"checks"`
+	Failures     int     `json:"failures"`
+	Availability float64 `json:"availability"`
+	LatencyAvgMs float64 `json:"latency_avg_ms"`
+	LatencyP95Ms float64 `json:"latency_p95_ms"`
+	Status       string  `json:"status"` // ok, degraded or down
+
+	latencies []float64
+}
+
+// getRegionStats summarizes the check results of a website since `since` per
+// region the website was checked from.
+func getRegionStats(db *sql.DB, url string, since time.Time) ([]*regionStat, error) {
+	query := "SELECT region, up, response_time FROM check_results WHERE website_url = ? AND checked_at >= ?"
+
+	rows, err := db.Query(query, url, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]*regionStat)
+	for rows.Next() {
+		var region string
+		var up bool
+		var responseTime float64
+		if err := rows.Scan(&region, &up, &responseTime); err != nil {
+			return nil, err
+		}
+
+		s, ok := stats[region]
+		if !ok {
+			s = &regionStat{Region: region}
+			stats[region] = s
+		}
+		s.Checks++
+		if !up {
+			s.Failures++
+			continue
+		}
+		s.latencies = append(s.latencies, responseTime*1000)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*regionStat, 0, len(stats))
+	for _, s := range stats {
+		s.Availability = 100 * float64(s.Checks-s.Failures) / float64(s.Checks)
+		s.LatencyAvgMs, s.LatencyP95Ms = latencyStats(s.latencies)
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Region < result[j].Region })
+	classifyRegions(result)
+
+	return result, nil
+}
+
+// classifyRegions sets the status of every region. A region is down when most
+// of its checks failed, and degraded when more than a tenth failed or its p95
+// latency is more than twice that of the fastest other region.
+func classifyRegions(stats []*regionStat) {
+	for _, s := range stats {
+		failureRate := float64(s.Failures) / float64(s.Checks)
+
+		fastest := 0.0
+		for _, other := range stats {
+			if other != s && other.LatencyP95Ms > 0 && (fastest == 0 || other.LatencyP95Ms < fastest) {
+				fastest = other.LatencyP95Ms
+			}
+		}
+
+		switch {
+		case failureRate > 0.5:
+			s.Status = "down"
+		case failureRate > 0.1, fastest > 0 && s.LatencyP95Ms > 2*fastest:
+			s.Status = "degraded"
+		default:
+			s.Status = "ok"
+		}
+	}
+}
+
+// runRegionChecks alerts when a region of a website checked from more than
+// one region changes status. Every monitor runs this, the region_status row
+// makes sure only the first one to see the change sends the alert. Websites in
+// maintenance get no alerts.
+func runRegionChecks(db *sql.DB) error {
+	websites, err := getWebsiteURLs(db)
+	if err != nil {
+		return fmt.Errorf("fetching website URLs: %v", err)
+	}
+
+	since := time.Now().Add(-regionWindow)
+	for _, url := range websites {
+		stats, err := getRegionStats(db, url, since)
+		if err != nil {
+			fmt.Printf("Error getting region stats for %s: %v\n", url, err)
+			continue
+		}
+		if len(stats) < 2 {
+			continue
+		}
+
+		for _, s := range stats {
+			query := "INSERT INTO region_status (website_url, region, status, changed_at) VALUES (?, ?, ?, NOW()) ON DUPLICATE KEY UPDATE changed_at = IF(status = VALUES(status), changed_at, NOW()), status = VALUES(status)"
+			res, err := db.Exec(query, url, s.Region, s.Status)
+			if err != nil {
+				fmt.Printf("Error saving region status for %s: %v\n", url, err)
+				continue
+			}
+			// 1 is a new row, 2 an updated one and 0 an unchanged one.
+			n, _ := res.RowsAffected()
+			if n == 0 || (n == 1 && s.Status == "ok") {
+				continue
+			}
+			// The change is recorded, but planned outages don't page.
+			if getWebsiteSettings(db, url).InMaintenance {
+				continue
+			}
+
+			if s.Status == "ok" {
+				sendSlackMessage(fmt.Sprintf("MONITOR --> %s is fine again from %s (p95 %.0f ms)", url, s.Region, s.LatencyP95Ms))
+				continue
+			}
+			message := fmt.Sprintf("WARNING: %s is %s from %s: availability %.1f%%, p95 %.0f ms over the last %v.", url, s.Status, s.Region, s.Availability, s.LatencyP95Ms, regionWindow)
+			for _, other := range stats {
+				if other != s {
+					message += fmt.Sprintf("\n%s: %s, availability %.1f%%, p95 %.0f ms", other.Region, other.Status, other.Availability, other.LatencyP95Ms)
+				}
+			}
+			fmt.Println(message)
+			sendSlackMessage(message)
+		}
+	}
+	return nil
+}
+
+func regionWindowQuery(r *http.Request) (time.Duration, error) {
+	window := time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid window")
+		}
+		window = d
+	}
+	return window, nil
+}
+
+// handleRegions serves GET /api/regions?url=...&window=1h with the latency and
+// availability of a website per region.
+func handleRegions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+		if !allowedWebsite(db, r, url) {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+		window, err := regionWindowQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		stats, err := getRegionStats(db, url, time.Now().Add(-window))
+		if err != nil {
+			fmt.Printf("Error getting region stats for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"url":            url,
+			"window_seconds": window.Seconds(),
+			"regions":        stats,
+		})
+	}
+}
+
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.3em 1em; text-align: left; border-bottom: 1px solid #ddd; }
+.ok { color: #1a7f37; } .degraded { color: #bf8700; } .down { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>Status</h1>
+<p>Last {{.Window}}</p>
+{{range .Websites}}
+<h2>{{.URL}}</h2>
+<table>
+<tr><th>Region</th><th>Status</th><th>Availability</th><th>Average</th><th>p95</th></tr>
+{{range .Regions}}<tr><td>{{.Region}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{printf "%.2f" .Availability}}%</td><td>{{printf "%.0f" .LatencyAvgMs}} ms</td><td>{{printf "%.0f" .LatencyP95Ms}} ms</td></tr>
+{{else}}<tr><td colspan="5">No checks yet</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// handleStatusPage serves GET /status, the per-region status of the websites
+// of the signed in user, or of all websites with the API token.
+func handleStatusPage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window, err := regionWindowQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var urls []string
+		if userID, ok := requestUser(r); ok {
+			clientWebsites, err := getClientWebsites(db)
+			if err != nil {
+				fmt.Printf("Error fetching client websites: %v\n", err)
+				http.Error(w, "database error", http.StatusInternalServerError)
+				return
+			}
+			for _, cw := range clientWebsites {
+				if cw.clientID == userID {
+					urls = append(urls, cw.url)
+				}
+			}
+		} else {
+			urls, err = getWebsiteURLs(db)
+			if err != nil {
+				fmt.Printf("Error fetching website URLs: %v\n", err)
+				http.Error(w, "database error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		renderStatusPage(w, db, urls, window)
+	}
+}
+
+// handlePublicStatusPage serves GET /public/status/{slug}, the status page of
+// the client with that status_page_slug, without authentication.
+func handlePublicStatusPage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window, err := regionWindowQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var clientID int
+		err = db.QueryRow("SELECT id FROM users WHERE status_page_slug = ?", r.PathValue("slug")).Scan(&clientID)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error getting status page %s: %v\n", r.PathValue("slug"), err)
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+
+		urls, _, err := clientWebsiteURLs(db, clientID)
+		if err != nil {
+			fmt.Printf("Error fetching websites of client %d: %v\n", clientID, err)
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		renderStatusPage(w, db, urls, window)
+	}
+}
+
+func renderStatusPage(w http.ResponseWriter, db *sql.DB, urls []string, window time.Duration) {
+	type websiteStatus struct {
+		URL     string
+		Regions []*regionStat
+	}
+	page := struct {
+		Window   time.Duration
+		Websites []websiteStatus
+	}{Window: window}
+
+	since := time.Now().Add(-window)
+	for _, url := range urls {
+		stats, err := getRegionStats(db, url, since)
+		if err != nil {
+			fmt.Printf("Error getting region stats for %s: %v\n", url, err)
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		page.Websites = append(page.Websites, websiteStatus{URL: url, Regions: stats})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPage.Execute(w, page); err != nil {
+		fmt.Printf("Error rendering status page: %v\n", err)
+	}
+}
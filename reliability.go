@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// reliability holds the MTTR and MTBF of one or more websites. MTTR is the
+// mean duration of the incidents that ended in the window, MTBF the time up
+// divided by the number of incidents. Both are nil without incidents.
+type reliability struct {
+	Incidents   int      `json:"incidents"`
+	MTTRSeconds *float64 `json:"mttr_seconds"`
+	MTBFSeconds *float64 `json:"mtbf_seconds"`
+
+	recovered int
+	recovery  time.Duration
+	uptime    time.Duration
+}
+
+// add counts the incidents of one website in the window.
+func (r *reliability) add(incidents []incident, from, to time.Time) {
+	r.Incidents += len(incidents)
+	r.uptime += to.Sub(from) - downtime(incidents, from, to)
+	for _, inc := range incidents {
+		if inc.EndedAt.Valid && !inc.EndedAt.Time.After(to) {
+			r.recovered++
+			r.recovery += inc.EndedAt.Time.Sub(inc.StartedAt)
+		}
+	}
+
+	r.MTTRSeconds, r.MTBFSeconds = nil, nil
+	if r.recovered > 0 {
+		mttr := (r.recovery / time.Duration(r.recovered)).Seconds()
+		r.MTTRSeconds = &mttr
+	}
+	if r.Incidents > 0 {
+		mtbf := (r.uptime / time.Duration(r.Incidents)).Seconds()
+		r.MTBFSeconds = &mtbf
+	}
+}
+
+// String is the line used in reports.
+func (r reliability) String() string {
+	if r.Incidents == 0 {
+		return "MTTR / MTBF: no incidents"
+	}
+	s := "MTTR: "
+	if r.MTTRSeconds != nil {
+		s += formatDuration(time.Duration(*r.MTTRSeconds * float64(time.Second)))
+	} else {
+		s += "not recovered yet"
+	}
+	return s + ", MTBF: " + formatDuration(time.Duration(*r.MTBFSeconds*float64(time.Second)))
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%.1f days", d.Hours()/24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%.1f hours", d.Hours())
+	case d >= time.Minute:
+		return fmt.Sprintf("%.0f minutes", d.Minutes())
+	}
+	return fmt.Sprintf("%.0f seconds", d.Seconds())
+}
+
+func measureReliability(db *sql.DB, urls []string, from, to time.Time) (reliability, error) {
+	var r reliability
+	for _, url := range urls {
+		incidents, err := getIncidents(db, url, from, to)
+		if err != nil {
+			return r, err
+		}
+		r.add(incidents, from, to)
+	}
+	return r, nil
+}
+
+// handleReliability serves GET /api/reliability?url=...&from=...&to=... for a
+// website, or ?client=<id> for all websites of a client with the MTTR and MTBF
+// of each website too. Signed in clients get their own websites without client.
+func handleReliability(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := queryTimeRange(r, 90*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if url := r.URL.Query().Get("url"); url != "" {
+			if !allowedWebsite(db, r, url) {
+				writeError(w, http.StatusNotFound, "website not found")
+				return
+			}
+			rel, err := measureReliability(db, []string{url}, from, to)
+			if err != nil {
+				fmt.Printf("Error measuring reliability of %s: %v\n", url, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"url": url, "from": from, "to": to, "reliability": rel})
+			return
+		}
+
+		clientID, ok := requestUser(r)
+		if !ok {
+			clientID = intQuery(r, "client", 0)
+		}
+		if clientID == 0 {
+			writeError(w, http.StatusBadRequest, "url or client is required")
+			return
+		}
+
+		urls, _, err := clientWebsiteURLs(db, clientID)
+		if err != nil {
+			fmt.Printf("Error fetching websites of client %d: %v\n", clientID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		var total reliability
+		websites := make(map[string]reliability, len(urls))
+		for _, url := range urls {
+			incidents, err := getIncidents(db, url, from, to)
+			if err != nil {
+				fmt.Printf("Error measuring reliability of %s: %v\n", url, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			var rel reliability
+			rel.add(incidents, from, to)
+			websites[url] = rel
+			total.add(incidents, from, to)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"client": clientID, "from": from, "to": to, "reliability": total, "websites": websites})
+	}
+}
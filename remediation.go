@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type remediation struct {
+	Action        string // webhook, ci or systemd
+	Target        string // URL for webhook and ci, unit name for systemd
+	Secret        string
+	AfterFailures int
+}
+
+var systemdUnitName = regexp.MustCompile(`^[A-Za-z0-9@._:-]+$`)
+
+// countFailure keeps track of how many checks in a row failed and fires the
+// remediation of the website once that count reaches its threshold, unless the
+// website is in maintenance.
+func countFailure(db *sql.DB, url, status string) {
+	if strings.HasPrefix(status, "Skipped") {
+		return
+	}
+
+	if statusUp(status) {
+		_, err := db.Exec("UPDATE websites SET consecutive_failures = 0 WHERE website_url = ? AND consecutive_failures != 0", url)
+		if err != nil {
+			fmt.Printf("Error resetting failures for %s: %v\n", url, err)
+		}
+		return
+	}
+
+	_, err := db.Exec("UPDATE websites SET consecutive_failures = consecutive_failures + 1 WHERE website_url = ?", url)
+	if err != nil {
+		fmt.Printf("Error counting failure for %s: %v\n", url, err)
+		return
+	}
+
+	query := `SELECT remediations.action, remediations.target, COALESCE(remediations.secret, ''), remediations.after_failures
+		FROM remediations JOIN websites ON websites.website_url = remediations.website_url
+		WHERE remediations.website_url = ? AND websites.consecutive_failures = remediations.after_failures`
+
+	var r remediation
+	err = db.QueryRow(query, url).Scan(&r.Action, &r.Target, &r.Secret, &r.AfterFailures)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error getting remediation for %s: %v\n", url, err)
+		return
+	}
+	if getWebsiteSettings(db, url).InMaintenance {
+		fmt.Printf("Not running remediation %s for %s during maintenance\n", r.Action, url)
+		return
+	}
+
+	go runRemediation(db, url, status, r)
+}
+
+func runRemediation(db *sql.DB, url, status string, r remediation) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var output string
+	var err error
+	switch r.Action {
+	case "webhook", "ci":
+		output, err = remediationWebhook(ctx, url, status, r)
+	case "systemd":
+		output, err = restartSystemdUnit(ctx, r.Target)
+	default:
+		err = fmt.Errorf("unknown remediation action %q", r.Action)
+	}
+
+	message := fmt.Sprintf("MONITOR --> Remediation %s %s for %s after %d failures", r.Action, r.Target, url, r.AfterFailures)
+	if err != nil {
+		output = strings.TrimSpace(output + "\n" + err.Error())
+		message += " FAILED: " + err.Error()
+	} else {
+		message += " succeeded"
+	}
+	fmt.Println(message)
+	sendSlackMessage(message)
+
+	query := `INSERT INTO incident_remediations (incident_id, action, target, ran_at, success, output)
+		SELECT id, ?, ?, NOW(), ?, ? FROM incidents WHERE website_url = ? AND ended_at IS NULL ORDER BY started_at DESC LIMIT 1`
+	_, dbErr := db.Exec(query, r.Action, r.Target, err == nil, truncate(output, 4096), url)
+	if dbErr != nil {
+		fmt.Printf("Error saving remediation for %s: %v\n", url, dbErr)
+	}
+}
+
+// remediationWebhook posts the failure to a webhook, or to a CI trigger URL
+// such as a pipeline trigger or workflow dispatch endpoint.
+func remediationWebhook(ctx context.Context, url, status string, r remediation) (string, error) {
+	payload, err := json.Marshal(map[string]any{
+		"website":  url,
+		"status":   status,
+		"failures": r.AfterFailures,
+		"action":   r.Action,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Target, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Secret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	output := fmt.Sprintf("%s\n%s", resp.Status, body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return output, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return output, nil
+}
+
+// restartSystemdUnit restarts a unit on the machine the monitor runs on. This
+// is only allowed with REMEDIATION_ALLOW_SYSTEMD=true, for agent installs
+// running next to the website.
+func restartSystemdUnit(ctx context.Context, unit string) (string, error) {
+	if os.Getenv("REMEDIATION_ALLOW_SYSTEMD") != "true" {
+		return "", fmt.Errorf("systemd remediation is disabled, set REMEDIATION_ALLOW_SYSTEMD=true")
+	}
+	if !systemdUnitName.MatchString(unit) {
+		return "", fmt.Errorf("invalid unit name %q", unit)
+	}
+
+	out, err := exec.CommandContext(ctx, "systemctl", "restart", "--", unit).CombinedOutput()
+	return string(out), err
+}
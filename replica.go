@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// openReadReplica connects to the read-only database in DB_READ_DSN, e.g.
+//
+//	monitor_ro:secret@tcp(replica:3306)/uptime
+//
+// Reports, the status page and the read API use it, so heavy dashboards
+// don't compete with the check loop on the primary. The replica may lag a
+// little behind, which is fine for everything that reads it.
+func openReadReplica(dsn string) (*sql.DB, error) {
+	// We scan DATETIME columns into time.Time everywhere.
+	if !strings.Contains(dsn, "parseTime=") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "parseTime=true&loc=Local"
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type clientWebsite struct {
+	clientID int
+	email    string
+	url      string
+}
+
+// runMonthlyReports sends each client a report about the previous month, once
+// per month. The sent months are kept in monthly_reports so restarts don't
+// send a report twice. The reports themselves are built from readDB.
+func runMonthlyReports(db, readDB *sql.DB, now time.Time) error {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+
+	var sent int
+	err := db.QueryRow("SELECT COUNT(*) FROM monthly_reports WHERE month = ?", month.Format("2006-01-02")).Scan(&sent)
+	if err != nil {
+		return fmt.Errorf("checking monthly reports: %v", err)
+	}
+	if sent > 0 {
+		return nil
+	}
+
+	websites, err := getClientWebsites(readDB)
+	if err != nil {
+		return fmt.Errorf("fetching websites for monthly reports: %v", err)
+	}
+
+	byClient := make(map[string][]string)
+	var order []string
+	for _, w := range websites {
+		if _, ok := byClient[w.email]; !ok {
+			order = append(order, w.email)
+		}
+		byClient[w.email] = append(byClient[w.email], w.url)
+	}
+
+	for _, email := range order {
+		subject := fmt.Sprintf("Monthly uptime report %s", month.Format("January 2006"))
+		sendEmail(email, subject, monthlyReport(readDB, byClient[email], month, now))
+	}
+
+	_, err = db.Exec("INSERT INTO monthly_reports (month, sent_at) VALUES (?, NOW())", month.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("saving monthly report run: %v", err)
+	}
+	sendSlackMessage(fmt.Sprintf("MONITOR --> Sent monthly reports for %s to %d clients", month.Format("January 2006"), len(order)))
+	return nil
+}
+
+// getClientWebsites returns the websites of every client. Paused websites are
+// left out of the reports.
+func getClientWebsites(db *sql.DB) ([]clientWebsite, error) {
+	query := "SELECT users.id, users.email, websites.website_url FROM websites JOIN users ON users.id = websites.client WHERE NOT websites.paused ORDER BY users.id, websites.website_url"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var websites []clientWebsite
+	for rows.Next() {
+		var w clientWebsite
+		if err := rows.Scan(&w.clientID, &w.email, &w.url); err != nil {
+			return nil, err
+		}
+		websites = append(websites, w)
+	}
+
+	return websites, rows.Err()
+}
+
+func monthlyReport(db *sql.DB, urls []string, month, now time.Time) string {
+	from, to := month, month.AddDate(0, 1, 0)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dear user,\n\nHere is the uptime report of your websites for %s.\n\n", month.Format("January 2006"))
+
+	for _, url := range urls {
+		fmt.Fprintf(&b, "%s\n", url)
+
+		incidents, err := getIncidents(db, url, from, to)
+		if err != nil {
+			fmt.Printf("Error getting incidents for %s: %v\n", url, err)
+			b.WriteString("   No data available\n\n")
+			continue
+		}
+		figures, err := measureUptime(db, url, incidents, from, to)
+		if err != nil {
+			fmt.Printf("Error measuring uptime of %s: %v\n", url, err)
+		}
+		fmt.Fprintf(&b, "   Uptime: %.2f%%\n", figures.UptimePercentage)
+		if figures.ScheduledDowntimeSeconds > 0 {
+			scheduled := time.Duration(figures.ScheduledDowntimeSeconds) * time.Second
+			fmt.Fprintf(&b, "   SLA uptime: %.2f%% (%s of downtime during scheduled maintenance excluded)\n", figures.SLAUptimePercentage, formatDuration(scheduled))
+		}
+		fmt.Fprintf(&b, "   Incidents: %d\n", len(incidents))
+		var rel reliability
+		rel.add(incidents, from, to)
+		fmt.Fprintf(&b, "   %s\n", rel)
+
+		var avg sql.NullFloat64
+		err = db.QueryRow("SELECT AVG(response_time) FROM response_times WHERE website_url = ? AND checked_at >= ? AND checked_at < ?", url, from, to).Scan(&avg)
+		if err != nil {
+			fmt.Printf("Error getting response times for %s: %v\n", url, err)
+		} else if avg.Valid {
+			fmt.Fprintf(&b, "   Average response time: %.0f ms\n", avg.Float64*1000)
+		}
+
+		forecast, err := forecastReliability(db, url, now)
+		if err != nil {
+			fmt.Printf("Error forecasting %s: %v\n", url, err)
+		} else {
+			fmt.Fprintf(&b, "   %s\n", forecast)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("Kind regards,\nUptimeMonitor")
+	return b.String()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkJitter spreads checks by up to this fraction of their interval either
+// way, so websites added at the same time don't keep being checked together.
+var checkJitter = 0.1
+
+var schedulerTick = 5 * time.Second
+
+// checkConcurrency is how many checks run at the same time.
+var checkConcurrency = 1
+
+type scheduledWebsite struct {
+	URL      string
+	Interval time.Duration
+	Severity string
+}
+
+type scheduleEntry struct {
+	URL          string        `json:"url"`
+	Severity     string        `json:"severity"`
+	Interval     time.Duration `json:"-"`
+	LastRun      *time.Time    `json:"last_run"`
+	NextRun      time.Time     `json:"next_run"`
+	LastDuration time.Duration `json:"-"`
+}
+
+type scheduler struct {
+	mu        sync.Mutex
+	entries   map[string]*scheduleEntry
+	saturated bool
+}
+
+var checkScheduler = &scheduler{entries: make(map[string]*scheduleEntry)}
+
+func getScheduledWebsites(db *sql.DB) ([]scheduledWebsite, error) {
+	query := `SELECT websites.website_url, COALESCE(websites.check_interval_seconds, check_templates.check_interval_seconds, 0), COALESCE(websites.severity, check_templates.severity, '')
+		FROM websites LEFT JOIN check_templates ON check_templates.id = websites.template_id WHERE NOT websites.paused`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var websites []scheduledWebsite
+	for rows.Next() {
+		var w scheduledWebsite
+		var seconds int
+		if err := rows.Scan(&w.URL, &seconds, &w.Severity); err != nil {
+			return nil, err
+		}
+		w.Interval = checkInterval
+		if seconds > 0 {
+			w.Interval = time.Duration(seconds) * time.Second
+		}
+		websites = append(websites, w)
+	}
+
+	return websites, rows.Err()
+}
+
+// refresh brings the schedule in line with the websites in the database. New
+// websites are due right away, removed and paused websites are dropped.
+func (s *scheduler) refresh(websites []scheduledWebsite, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool, len(websites))
+	for _, w := range websites {
+		seen[w.URL] = true
+		entry, ok := s.entries[w.URL]
+		if !ok {
+			s.entries[w.URL] = &scheduleEntry{URL: w.URL, Severity: w.Severity, Interval: w.Interval, NextRun: now}
+			continue
+		}
+		entry.Severity = w.Severity
+		if entry.Interval != w.Interval {
+			entry.Interval = w.Interval
+			if entry.LastRun != nil {
+				entry.NextRun = nextRun(*entry.LastRun, w.Interval)
+			}
+		}
+	}
+
+	for url := range s.entries {
+		if !seen[url] {
+			delete(s.entries, url)
+		}
+	}
+}
+
+// due returns the websites whose next run has come and plans their next run.
+// Critical websites come first, then the ones that are the most overdue. When
+// the scheduler is saturated only checkConcurrency websites that aren't
+// critical are taken, the rest stay due for the next batch so critical
+// websites never queue behind them.
+func (s *scheduler) due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []*scheduleEntry
+	for _, entry := range s.entries {
+		if !entry.NextRun.After(now) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if ci, cj := entries[i].critical(), entries[j].critical(); ci != cj {
+			return ci
+		}
+		if !entries[i].NextRun.Equal(entries[j].NextRun) {
+			return entries[i].NextRun.Before(entries[j].NextRun)
+		}
+		return entries[i].URL < entries[j].URL
+	})
+
+	var due []string
+	others := 0
+	for _, entry := range entries {
+		if s.saturated && !entry.critical() {
+			if others >= checkConcurrency {
+				continue
+			}
+			others++
+		}
+		due = append(due, entry.URL)
+		lastRun := now
+		entry.LastRun = &lastRun
+		entry.NextRun = nextRun(now, entry.Interval)
+	}
+
+	return due
+}
+
+func (e *scheduleEntry) critical() bool {
+	return e.Severity == "critical"
+}
+
+// validSeverity checks a severity. Critical is the only level, websites
+// without a severity are checked normally.
+func validSeverity(severity string) error {
+	if severity != "" && severity != "critical" {
+		return fmt.Errorf("unknown severity %q, use critical or leave it empty", severity)
+	}
+	return nil
+}
+
+// finished records how long the check of a website took.
+func (s *scheduler) finished(url string, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[url]; ok {
+		entry.LastDuration = duration
+	}
+}
+
+// load is how many checks have to run at the same time on average to keep up
+// with every interval, based on how long the last check of each website took.
+func (s *scheduler) load() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var load float64
+	for _, entry := range s.entries {
+		if entry.Interval > 0 {
+			load += float64(entry.LastDuration) / float64(entry.Interval)
+		}
+	}
+	return load
+}
+
+// maxLag is how far the most overdue website is behind its planned run.
+func (s *scheduler) maxLag(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lag time.Duration
+	for _, entry := range s.entries {
+		if d := now.Sub(entry.NextRun); d > lag {
+			lag = d
+		}
+	}
+	return lag
+}
+
+// checkSaturation alerts once when the checks can't keep up with their
+// intervals anymore at the configured concurrency, and once when they can
+// again. It lets go of saturation at 90% to not flap around the limit.
+func (s *scheduler) checkSaturation(now time.Time) {
+	load := s.load()
+	lag := s.maxLag(now)
+
+	s.mu.Lock()
+	wasSaturated := s.saturated
+	switch {
+	case !s.saturated && load > float64(checkConcurrency):
+		s.saturated = true
+	case s.saturated && load < 0.9*float64(checkConcurrency):
+		s.saturated = false
+	}
+	saturated := s.saturated
+	s.mu.Unlock()
+
+	if saturated == wasSaturated {
+		return
+	}
+	if saturated {
+		message := fmt.Sprintf("WARNING --> Scheduler saturated: checks need %.1f concurrent slots but CHECK_CONCURRENCY is %d, the most overdue check is %v behind. Critical websites are checked first.", load, checkConcurrency, lag.Round(time.Second))
+		fmt.Println(message)
+		sendSlackMessage(message)
+	} else {
+		sendSlackMessage(fmt.Sprintf("MONITOR --> Scheduler caught up, checks need %.1f of %d concurrent slots", load, checkConcurrency))
+	}
+}
+
+func nextRun(from time.Time, interval time.Duration) time.Time {
+	jitter := time.Duration((rand.Float64()*2 - 1) * checkJitter * float64(interval))
+	return from.Add(interval + jitter)
+}
+
+func (s *scheduler) snapshot() []scheduleEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]scheduleEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NextRun.Before(entries[j].NextRun) })
+
+	return entries
+}
+
+// runScheduler checks every website when it is due, forever.
+func runScheduler(db *sql.DB) {
+	for {
+		websites, err := getScheduledWebsites(db)
+		if err != nil {
+			fmt.Printf("Error fetching website URLs: %v\n", err)
+		} else {
+			checkScheduler.refresh(websites, time.Now())
+		}
+
+		checkScheduler.checkSaturation(time.Now())
+
+		due := checkScheduler.due(time.Now())
+		if len(due) == 0 {
+			time.Sleep(schedulerTick)
+			continue
+		}
+		checkWebsites(db, due)
+		flushClientAlerts(db)
+	}
+}
+
+// handleSchedule serves GET /api/schedule with the planned next run of every
+// website and the maintenance windows that apply to it.
+func handleSchedule(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		windows, err := getMaintenanceWindows(db, time.Now())
+		if err != nil {
+			fmt.Printf("Error getting maintenance windows: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		type scheduleResponse struct {
+			scheduleEntry
+			IntervalSeconds     float64             `json:"interval_seconds"`
+			LastDurationSeconds float64             `json:"last_duration_seconds"`
+			InMaintenance       bool                `json:"in_maintenance"`
+			MaintenanceWindows  []maintenanceWindow `json:"maintenance_windows"`
+		}
+
+		now := time.Now()
+		result := []scheduleResponse{}
+		for _, entry := range checkScheduler.snapshot() {
+			res := scheduleResponse{
+				scheduleEntry:       entry,
+				IntervalSeconds:     entry.Interval.Seconds(),
+				LastDurationSeconds: entry.LastDuration.Seconds(),
+				MaintenanceWindows:  []maintenanceWindow{},
+			}
+			for _, mw := range windows {
+				if mw.URL != nil && *mw.URL != entry.URL {
+					continue
+				}
+				res.MaintenanceWindows = append(res.MaintenanceWindows, mw)
+				if !now.Before(mw.StartsAt) && now.Before(mw.EndsAt) {
+					res.InMaintenance = true
+				}
+			}
+			result = append(result, res)
+		}
+
+		checkScheduler.mu.Lock()
+		saturated := checkScheduler.saturated
+		checkScheduler.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"jitter":          checkJitter,
+			"concurrency":     checkConcurrency,
+			"load":            checkScheduler.load(),
+			"saturated":       saturated,
+			"max_lag_seconds": checkScheduler.maxLag(now).Seconds(),
+			"websites":        result,
+			"generated":       now,
+		})
+	}
+}
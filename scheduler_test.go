@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDue(t *testing.T) {
+	defer func(concurrency int) { checkConcurrency = concurrency }(checkConcurrency)
+	checkConcurrency = 1
+
+	now := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	newScheduler := func(saturated bool) *scheduler {
+		s := &scheduler{entries: make(map[string]*scheduleEntry), saturated: saturated}
+		s.refresh([]scheduledWebsite{
+			{URL: "https://b.example", Interval: time.Minute},
+			{URL: "https://a.example", Interval: time.Minute},
+			{URL: "https://shop.example", Interval: time.Minute, Severity: "critical"},
+			{URL: "https://later.example", Interval: time.Minute},
+		}, now)
+		s.entries["https://b.example"].NextRun = now.Add(-2 * time.Minute)
+		s.entries["https://later.example"].NextRun = now.Add(time.Minute)
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		saturated bool
+		want      []string
+	}{
+		// Critical first, then the most overdue, then by URL.
+		{"normal", false, []string{"https://shop.example", "https://b.example", "https://a.example"}},
+		// Saturated, only checkConcurrency websites that aren't critical.
+		{"saturated", true, []string{"https://shop.example", "https://b.example"}},
+	}
+
+	for _, tt := range tests {
+		s := newScheduler(tt.saturated)
+		if got := s.due(now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: due = %v, want %v", tt.name, got, tt.want)
+		}
+		for _, url := range tt.want {
+			entry := s.entries[url]
+			if entry.LastRun == nil || !entry.LastRun.Equal(now) || !entry.NextRun.After(now) {
+				t.Errorf("%s: %s not planned again: %+v", tt.name, url, entry)
+			}
+		}
+	}
+}
+
+func TestSchedulerRefresh(t *testing.T) {
+	now := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	s := &scheduler{entries: make(map[string]*scheduleEntry)}
+	s.refresh([]scheduledWebsite{{URL: "https://a.example", Interval: time.Minute}, {URL: "https://b.example", Interval: time.Minute}}, now)
+	s.due(now)
+
+	// b is removed or paused, a gets a longer interval and critical.
+	s.refresh([]scheduledWebsite{{URL: "https://a.example", Interval: time.Hour, Severity: "critical"}}, now)
+
+	if _, ok := s.entries["https://b.example"]; ok {
+		t.Error("removed website still scheduled")
+	}
+	a := s.entries["https://a.example"]
+	if a.Severity != "critical" || a.Interval != time.Hour {
+		t.Errorf("a = %+v, want critical every hour", a)
+	}
+	if a.NextRun.Before(now.Add(50 * time.Minute)) {
+		t.Errorf("a next runs at %v, want about an hour after its last run", a.NextRun)
+	}
+}
+
+func TestNextRunJitter(t *testing.T) {
+	now := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		next := nextRun(now, time.Minute)
+		if next.Before(now.Add(54*time.Second)) || next.After(now.Add(66*time.Second)) {
+			t.Fatalf("nextRun = %v, want within 10%% of a minute", next)
+		}
+	}
+}
+
+func TestValidSeverity(t *testing.T) {
+	for _, severity := range []string{"", "critical"} {
+		if err := validSeverity(severity); err != nil {
+			t.Errorf("validSeverity(%q) = %v", severity, err)
+		}
+	}
+	for _, severity := range []string{"high", "CRITICAL", "low"} {
+		if err := validSeverity(severity); err == nil {
+			t.Errorf("validSeverity(%q) succeeded", severity)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order on startup. Only ever append to this list.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS website_steps (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		website_url VARCHAR(255) NOT NULL,
+		step_order INT NOT NULL DEFAULT 0,
+		method VARCHAR(10) NOT NULL DEFAULT 'GET',
+		step_url VARCHAR(2048) NOT NULL,
+		body TEXT,
+		expected_status INT NOT NULL DEFAULT 200,
+		INDEX (website_url)
+	)`,
+	`CREATE TABLE IF NOT EXISTS website_sessions (
+		website_url VARCHAR(255) PRIMARY KEY,
+		cookies TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`,
+	"ALTER TABLE websites ADD COLUMN persist_session TINYINT(1) NOT NULL DEFAULT 0",
+	"ALTER TABLE websites ADD COLUMN max_body_bytes BIGINT NULL",
+	"ALTER TABLE websites ADD COLUMN sitemap_check TINYINT(1) NOT NULL DEFAULT 0",
+	"ALTER TABLE websites ADD COLUMN sitemap_url VARCHAR(2048) NULL",
+	`CREATE TABLE IF NOT EXISTS sitemap_reports (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		website_url VARCHAR(255) NOT NULL,
+		checked_at DATETIME NOT NULL,
+		total_urls INT NOT NULL,
+		sampled_urls INT NOT NULL,
+		healthy_urls INT NOT NULL,
+		healthy_percentage DECIMAL(5,2) NOT NULL,
+		INDEX (website_url, checked_at)
+	)`,
+	"ALTER TABLE websites ADD COLUMN expected_ssl_issuer VARCHAR(255) NULL",
+	"ALTER TABLE websites ADD COLUMN ssl_issuer_org VARCHAR(255) NULL",
+	"ALTER TABLE websites ADD COLUMN ssl_issuer_mismatch TINYINT(1) NOT NULL DEFAULT 0",
+	`CREATE TABLE IF NOT EXISTS status_code_counts (
+		website_url VARCHAR(255) NOT NULL,
+		day DATE NOT NULL,
+		count_2xx INT NOT NULL DEFAULT 0,
+		count_3xx INT NOT NULL DEFAULT 0,
+		count_4xx INT NOT NULL DEFAULT 0,
+		count_5xx INT NOT NULL DEFAULT 0,
+		count_error INT NOT NULL DEFAULT 0,
+		PRIMARY KEY (website_url, day)
+	)`,
+	`CREATE TABLE IF NOT EXISTS sessions (
+		token_hash CHAR(64) PRIMARY KEY,
+		user_id INT NOT NULL,
+		provider VARCHAR(50) NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		INDEX (user_id)
+	)`,
+	"ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, ADD COLUMN user_agent VARCHAR(255) NULL, ADD COLUMN ip_address VARCHAR(45) NULL",
+	"ALTER TABLE users ADD COLUMN password_hash VARCHAR(255) NULL, ADD COLUMN totp_secret VARCHAR(64) NULL, ADD COLUMN totp_enabled TINYINT(1) NOT NULL DEFAULT 0, ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0",
+	"ALTER TABLE websites ADD COLUMN depends_on VARCHAR(255) NULL",
+	`CREATE TABLE IF NOT EXISTS incidents (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		website_url VARCHAR(255) NOT NULL,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME NULL,
+		status VARCHAR(1024) NOT NULL,
+		INDEX (website_url, started_at)
+	)`,
+	"ALTER TABLE response_times ADD COLUMN checked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, ADD INDEX (website_url, checked_at)",
+	`CREATE TABLE IF NOT EXISTS monthly_reports (
+		month DATE PRIMARY KEY,
+		sent_at DATETIME NOT NULL
+	)`,
+	"ALTER TABLE websites ADD COLUMN debug_until DATETIME NULL",
+	`CREATE TABLE IF NOT EXISTS check_debug_logs (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		website_url VARCHAR(255) NOT NULL,
+		checked_at DATETIME NOT NULL,
+		log MEDIUMTEXT NOT NULL,
+		INDEX (website_url, checked_at)
+	)`,
+	"ALTER TABLE websites ADD COLUMN ssh_jump_host VARCHAR(255) NULL, ADD COLUMN ssh_key_path VARCHAR(255) NULL",
+	`CREATE TABLE IF NOT EXISTS network_profiles (
+		name VARCHAR(50) PRIMARY KEY,
+		interface VARCHAR(32) NULL,
+		source_address VARCHAR(45) NULL,
+		routing_mark INT NULL,
+		dns_server VARCHAR(255) NULL
+	)`,
+	"ALTER TABLE websites ADD COLUMN network_profile VARCHAR(50) NULL",
+	`CREATE TABLE IF NOT EXISTS website_tags (
+		website_url VARCHAR(255) NOT NULL,
+		tag VARCHAR(50) NOT NULL,
+		PRIMARY KEY (website_url, tag),
+		INDEX (tag)
+	)`,
+	`CREATE TABLE IF NOT EXISTS check_results (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		website_url VARCHAR(255) NOT NULL,
+		checked_at DATETIME NOT NULL,
+		up TINYINT(1) NOT NULL,
+		status VARCHAR(255) NOT NULL,
+		response_time DOUBLE NOT NULL,
+		INDEX (website_url, checked_at),
+		INDEX (checked_at)
+	)`,
+	"ALTER TABLE websites ADD COLUMN consecutive_failures INT NOT NULL DEFAULT 0",
+	`CREATE TABLE IF NOT EXISTS remediations (
+		website_url VARCHAR(255) PRIMARY KEY,
+		action VARCHAR(20) NOT NULL,
+		target VARCHAR(2048) NOT NULL,
+		secret VARCHAR(255) NULL,
+		after_failures INT NOT NULL DEFAULT 3
+	)`,
+	`CREATE TABLE IF NOT EXISTS incident_remediations (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		incident_id INT NOT NULL,
+		action VARCHAR(20) NOT NULL,
+		target VARCHAR(2048) NOT NULL,
+		ran_at DATETIME NOT NULL,
+		success TINYINT(1) NOT NULL,
+		output TEXT NOT NULL,
+		INDEX (incident_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS canary_pairs (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		primary_url VARCHAR(2048) NOT NULL,
+		secondary_url VARCHAR(2048) NOT NULL,
+		compare_status TINYINT(1) NOT NULL DEFAULT 1,
+		json_fields VARCHAR(1024) NULL,
+		max_latency_ratio DOUBLE NULL,
+		diverged TINYINT(1) NOT NULL DEFAULT 0,
+		last_checked DATETIME NULL
+	)`,
+	"ALTER TABLE websites ADD COLUMN domain_expiry_date DATETIME NULL",
+	"ALTER TABLE websites ADD COLUMN check_interval_seconds INT NULL",
+	`CREATE TABLE IF NOT EXISTS maintenance_windows (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		website_url VARCHAR(255) NULL,
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL,
+		reason VARCHAR(255) NULL,
+		INDEX (ends_at)
+	)`,
+	"ALTER TABLE websites ADD COLUMN severity VARCHAR(16) NULL",
+	"ALTER TABLE websites ADD COLUMN response_schema MEDIUMTEXT NULL",
+	"ALTER TABLE websites ADD COLUMN response_schema_pointer VARCHAR(255) NULL",
+	"ALTER TABLE websites ADD COLUMN schema_violation TEXT NULL",
+	"ALTER TABLE check_results ADD COLUMN region VARCHAR(64) NOT NULL DEFAULT ''",
+	`CREATE TABLE IF NOT EXISTS region_status (
+		website_url VARCHAR(255) NOT NULL,
+		region VARCHAR(64) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		changed_at DATETIME NOT NULL,
+		PRIMARY KEY (website_url, region)
+	)`,
+	`CREATE TABLE IF NOT EXISTS push_devices (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		platform VARCHAR(16) NOT NULL,
+		token VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME NULL,
+		UNIQUE KEY (token),
+		INDEX (user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webpush_subscriptions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		endpoint VARCHAR(1024) NOT NULL,
+		endpoint_hash CHAR(64) NOT NULL,
+		p256dh VARCHAR(255) NOT NULL,
+		auth VARCHAR(64) NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE KEY (endpoint_hash),
+		INDEX (user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS website_watchers (
+		user_id INT NOT NULL,
+		website_url VARCHAR(255) NOT NULL,
+		PRIMARY KEY (user_id, website_url),
+		INDEX (website_url)
+	)`,
+	"ALTER TABLE websites ADD COLUMN track_changes BOOLEAN NOT NULL DEFAULT FALSE",
+	"ALTER TABLE websites ADD COLUMN change_ignore_pattern VARCHAR(255) NULL",
+	`CREATE TABLE IF NOT EXISTS content_snapshots (
+		website_url VARCHAR(255) PRIMARY KEY,
+		content MEDIUMTEXT NOT NULL,
+		content_hash CHAR(64) NOT NULL,
+		changed_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS channel_checks (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		channel VARCHAR(32) NOT NULL,
+		checked_at DATETIME NOT NULL,
+		ok BOOLEAN NOT NULL,
+		error VARCHAR(1024) NULL,
+		INDEX (checked_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		occurred_at DATETIME NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		website_url VARCHAR(255) NULL,
+		message VARCHAR(1024) NOT NULL,
+		details JSON NULL,
+		INDEX (occurred_at),
+		INDEX (website_url, id),
+		INDEX (type, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS job_runs (
+		name VARCHAR(64) PRIMARY KEY,
+		last_started_at DATETIME NOT NULL,
+		last_finished_at DATETIME NULL,
+		last_error VARCHAR(1024) NULL
+	)`,
+	"ALTER TABLE websites ADD COLUMN max_redirects INT NULL",
+	"ALTER TABLE websites ADD COLUMN redirect_chain TEXT NULL",
+	"ALTER TABLE check_results ADD COLUMN redirect_chain TEXT NULL",
+	"ALTER TABLE websites ADD COLUMN public_sla BOOLEAN NOT NULL DEFAULT FALSE",
+	"ALTER TABLE incidents ADD COLUMN root_cause VARCHAR(64) NULL",
+	"ALTER TABLE incidents ADD COLUMN postmortem TEXT NULL",
+	"ALTER TABLE incidents ADD COLUMN postmortem_updated_at DATETIME NULL",
+	`CREATE TABLE IF NOT EXISTS quarterly_reviews (
+		quarter VARCHAR(7) PRIMARY KEY,
+		sent_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS geo_dns_pools (
+		website_url VARCHAR(255) NOT NULL,
+		region VARCHAR(64) NOT NULL,
+		networks TEXT NOT NULL,
+		max_connect_ms INT NULL,
+		PRIMARY KEY (website_url, region)
+	)`,
+	`CREATE TABLE IF NOT EXISTS geo_dns_status (
+		website_url VARCHAR(255) NOT NULL,
+		region VARCHAR(64) NOT NULL,
+		problem TEXT NULL,
+		checked_at DATETIME NOT NULL,
+		PRIMARY KEY (website_url, region)
+	)`,
+	"ALTER TABLE websites ADD COLUMN check_compression BOOLEAN NOT NULL DEFAULT FALSE",
+	"ALTER TABLE websites ADD COLUMN compression_problem TEXT NULL",
+	"ALTER TABLE websites ADD COLUMN check_http3 BOOLEAN NOT NULL DEFAULT FALSE",
+	"ALTER TABLE websites ADD COLUMN http3_up BOOLEAN NULL",
+	"ALTER TABLE websites ADD COLUMN http3_status VARCHAR(255) NULL",
+	"ALTER TABLE websites ADD COLUMN http3_response_time FLOAT NULL",
+	"ALTER TABLE websites ADD COLUMN http3_checked_at DATETIME NULL",
+	"ALTER TABLE websites ADD COLUMN check_encoding BOOLEAN NOT NULL DEFAULT FALSE",
+	"ALTER TABLE websites ADD COLUMN encoding_problem TEXT NULL",
+	`CREATE TABLE IF NOT EXISTS notification_attempts (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		attempted_at DATETIME NOT NULL,
+		channel VARCHAR(32) NOT NULL,
+		recipient VARCHAR(255) NULL,
+		summary VARCHAR(255) NOT NULL,
+		result VARCHAR(16) NOT NULL,
+		attempts INT NOT NULL,
+		error TEXT NULL,
+		INDEX (attempted_at),
+		INDEX (recipient)
+	)`,
+	"ALTER TABLE websites ADD COLUMN hosting_provider VARCHAR(32) NULL",
+	"ALTER TABLE websites ADD COLUMN detected_provider VARCHAR(32) NULL",
+	"ALTER TABLE websites ADD COLUMN ssl_expires_at DATETIME NULL",
+	`CREATE TABLE IF NOT EXISTS expiring_counts (
+		day DATE PRIMARY KEY,
+		certificates INT NOT NULL,
+		domains INT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS escalation_policies (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		repeat_count INT NOT NULL DEFAULT 0,
+		repeat_interval_seconds INT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS escalation_steps (
+		policy_id INT NOT NULL,
+		position INT NOT NULL,
+		delay_seconds INT NOT NULL,
+		channel VARCHAR(16) NOT NULL,
+		target VARCHAR(255) NULL,
+		PRIMARY KEY (policy_id, position)
+	)`,
+	"ALTER TABLE websites ADD COLUMN escalation_policy_id INT NULL",
+	`CREATE TABLE IF NOT EXISTS incident_escalations (
+		incident_id INT NOT NULL,
+		round INT NOT NULL,
+		position INT NOT NULL,
+		sent_at DATETIME NOT NULL,
+		PRIMARY KEY (incident_id, round, position)
+	)`,
+	"ALTER TABLE users ADD COLUMN status_page_slug VARCHAR(64) NULL UNIQUE",
+	`CREATE TABLE IF NOT EXISTS client_contacts (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		client INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		role VARCHAR(64) NOT NULL,
+		INDEX (client)
+	)`,
+	"ALTER TABLE websites ADD COLUMN sla_exclude_maintenance BOOLEAN NOT NULL DEFAULT TRUE",
+	"ALTER TABLE websites ADD COLUMN warmup_idle_seconds INT NULL, ADD COLUMN warmup_slow_ms INT NULL",
+	"ALTER TABLE websites ADD COLUMN check_seo BOOLEAN NOT NULL DEFAULT FALSE, ADD COLUMN seo_pages TEXT NULL, ADD COLUMN seo_problem TEXT NULL",
+	`CREATE TABLE IF NOT EXISTS incident_confirmations (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		incident_id INT NOT NULL,
+		provider VARCHAR(32) NOT NULL,
+		measurement_id BIGINT NOT NULL,
+		measurement VARCHAR(16) NOT NULL,
+		requested_at DATETIME NOT NULL,
+		completed_at DATETIME NULL,
+		probes INT NULL,
+		reachable INT NULL,
+		median_rtt_ms DOUBLE NULL,
+		probe_rtt_ms DOUBLE NULL,
+		summary TEXT NULL,
+		INDEX (incident_id),
+		INDEX (completed_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS check_templates (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		check_interval_seconds INT NULL,
+		timeout_seconds INT NULL,
+		max_body_bytes BIGINT NULL,
+		max_redirects INT NULL,
+		warmup_idle_seconds INT NULL,
+		warmup_slow_ms INT NULL,
+		severity VARCHAR(16) NULL,
+		escalation_policy_id INT NULL,
+		response_schema MEDIUMTEXT NULL,
+		response_schema_pointer VARCHAR(255) NULL,
+		updated_at DATETIME NOT NULL
+	)`,
+	"ALTER TABLE websites ADD COLUMN template_id INT NULL, ADD COLUMN timeout_seconds INT NULL, ADD INDEX (template_id)",
+	"ALTER TABLE websites ADD COLUMN paused BOOLEAN NOT NULL DEFAULT FALSE",
+}
+
+func migrateDB(db *sql.DB) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INT NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if _, err := db.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		if _, err := db.Exec("INSERT INTO schema_version (version) VALUES (?)", i+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
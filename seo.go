@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// checkSEO audits the tags search engines index a website by: noindex in the
+// robots meta tags or the X-Robots-Tag header, and the canonical link, which is
+// followed to make sure it answers and is indexable itself. A deploy that ships
+// the staging robots settings to production silently drops a client from the
+// search results while the website is up. Besides the website itself the key
+// pages in seo_pages, one URL per line, are audited too.
+func checkSEO(db *sql.DB, url string, header http.Header, body []byte, settings websiteSettings) {
+	var enabled bool
+	var pages, previous string
+	err := db.QueryRow("SELECT check_seo, COALESCE(seo_pages, ''), COALESCE(seo_problem, '') FROM websites WHERE website_url = ?", url).Scan(&enabled, &pages, &previous)
+	if err != nil {
+		fmt.Printf("Error getting SEO settings for %s: %v\n", url, err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	client := checkClient(settings, nil)
+	problems := seoProblems(client, url, header, body, settings.MaxBodyBytes)
+	for _, page := range strings.Fields(pages) {
+		header, body, err := fetchPage(client, page, settings.MaxBodyBytes)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", page, err))
+			continue
+		}
+		problems = append(problems, seoProblems(client, page, header, body, settings.MaxBodyBytes)...)
+	}
+	problem := truncate(strings.Join(problems, "\n"), 4096)
+	if problem == previous {
+		return
+	}
+
+	_, err = db.Exec("UPDATE websites SET seo_problem = NULLIF(?, '') WHERE website_url = ?", problem, url)
+	if err != nil {
+		fmt.Printf("Error updating SEO problem for %s: %v\n", url, err)
+	}
+
+	if settings.InMaintenance {
+		return
+	}
+	if problem == "" {
+		sendSlackMessage(fmt.Sprintf("MONITOR --> The SEO tags of %s are fine again", url))
+		return
+	}
+	if previous != "" {
+		return
+	}
+
+	message := fmt.Sprintf("Search engines may drop %s:\n%s", url, problem)
+	fmt.Println("SEO --> " + message)
+	sendSlackMessage("WARNING: " + message)
+}
+
+// seoProblems returns what is wrong with the indexing tags of one page.
+func seoProblems(client *http.Client, pageURL string, header http.Header, body []byte, limit int64) []string {
+	var problems []string
+	if where := noindex(header, body); where != "" {
+		problems = append(problems, fmt.Sprintf("%s: noindex in %s", pageURL, where))
+	}
+
+	canonicals := canonicalLinks(body)
+	switch {
+	case len(canonicals) == 0:
+		return problems
+	case len(canonicals) > 1:
+		return append(problems, fmt.Sprintf("%s: %d canonical links, search engines ignore them all", pageURL, len(canonicals)))
+	}
+
+	base, err := neturl.Parse(pageURL)
+	if err != nil {
+		return problems
+	}
+	ref, err := base.Parse(canonicals[0])
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s: invalid canonical link %q", pageURL, canonicals[0]))
+	}
+	canonical := ref.String()
+	if !strings.EqualFold(strings.TrimPrefix(ref.Hostname(), "www."), strings.TrimPrefix(base.Hostname(), "www.")) {
+		problems = append(problems, fmt.Sprintf("%s: the canonical link points to another host, %s", pageURL, canonical))
+	}
+
+	if same, _, _ := monitorKeys(canonical); same != "" {
+		if page, _, _ := monitorKeys(pageURL); page == same {
+			return problems
+		}
+	}
+	header, body, err = fetchPage(client, canonical, limit)
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s: canonical %s: %v", pageURL, canonical, err))
+	}
+	if where := noindex(header, body); where != "" {
+		problems = append(problems, fmt.Sprintf("%s: canonical %s has noindex in %s", pageURL, canonical, where))
+	}
+	return problems
+}
+
+// fetchPage gets a page for the audit, which only makes sense when it is 200.
+func fetchPage(client *http.Client, url string, limit int64) (http.Header, []byte, error) {
+	resp, err := client.Get(asciiURL(url))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	return resp.Header, body, err
+}
+
+// noindex returns where a page asks not to be indexed, or "". Robots rules
+// for all crawlers and for Googlebot count, "none" means noindex, nofollow.
+func noindex(header http.Header, body []byte) string {
+	for _, v := range header.Values("X-Robots-Tag") {
+		rules := strings.ToLower(v)
+		if agent, rest, ok := strings.Cut(rules, ":"); ok && !strings.Contains(agent, ",") {
+			if agent = strings.TrimSpace(agent); agent != "googlebot" {
+				continue
+			}
+			rules = rest
+		}
+		if robotsNoindex(rules) {
+			return "the X-Robots-Tag header"
+		}
+	}
+
+	for _, tag := range headTags(body, "meta") {
+		name := strings.ToLower(tag["name"])
+		if (name == "robots" || name == "googlebot") && robotsNoindex(tag["content"]) {
+			return fmt.Sprintf("the %s meta tag", name)
+		}
+	}
+	return ""
+}
+
+func robotsNoindex(rules string) bool {
+	for _, rule := range strings.Split(strings.ToLower(rules), ",") {
+		if rule = strings.TrimSpace(rule); rule == "noindex" || rule == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+func canonicalLinks(body []byte) []string {
+	var links []string
+	for _, tag := range headTags(body, "link") {
+		for _, rel := range strings.Fields(strings.ToLower(tag["rel"])) {
+			if rel == "canonical" {
+				links = append(links, strings.TrimSpace(tag["href"]))
+				break
+			}
+		}
+	}
+	return links
+}
+
+// headTags returns the attributes of the tags with the name in the head of an
+// HTML document.
+func headTags(body []byte, name string) []map[string]string {
+	var tags []map[string]string
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return tags
+		case html.EndTagToken:
+			if tn, _ := z.TagName(); string(tn) == "head" {
+				return tags
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tn, hasAttr := z.TagName()
+			if string(tn) == "body" {
+				return tags
+			}
+			if string(tn) != name {
+				continue
+			}
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+			tags = append(tags, attrs)
+		}
+	}
+}
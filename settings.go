@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// maxBodyBytes is the default cap on how much of a response body a check reads.
+// It can be overridden with MAX_BODY_BYTES or per website.
+var maxBodyBytes int64 = 1 << 20
+
+type websiteSettings struct {
+	MaxBodyBytes int64
+	Debug        bool
+	JumpHost     string
+	SSHKeyPath   string
+	Network      *networkProfile
+
+	// InMaintenance is set while a maintenance window covers the website.
+	InMaintenance bool
+
+	MaxRedirects int
+
+	// WarmUp is set when the website wasn't checked for warmup_idle_seconds,
+	// so the next request may hit a cold start. WarmUpSlow is warmup_slow_ms.
+	WarmUp     bool
+	WarmUpSlow time.Duration
+
+	// Timeout limits a whole request of the check, 0 means no limit.
+	Timeout time.Duration
+}
+
+func getWebsiteSettings(db *sql.DB, url string) websiteSettings {
+	settings := websiteSettings{MaxBodyBytes: maxBodyBytes, MaxRedirects: maxRedirects}
+
+	query := `SELECT COALESCE(websites.max_body_bytes, check_templates.max_body_bytes), COALESCE(websites.max_redirects, check_templates.max_redirects), COALESCE(websites.debug_until > NOW(), 0), COALESCE(websites.ssh_jump_host, ''), COALESCE(websites.ssh_key_path, ''),
+		network_profiles.name, COALESCE(network_profiles.interface, ''), COALESCE(network_profiles.source_address, ''), COALESCE(network_profiles.routing_mark, 0), COALESCE(network_profiles.dns_server, ''),
+		EXISTS (SELECT 1 FROM maintenance_windows WHERE (maintenance_windows.website_url = websites.website_url OR maintenance_windows.website_url IS NULL) AND NOW() BETWEEN maintenance_windows.starts_at AND maintenance_windows.ends_at),
+		COALESCE(TIMESTAMPDIFF(SECOND, (SELECT MAX(check_results.checked_at) FROM check_results WHERE check_results.website_url = websites.website_url), NOW()) >= COALESCE(websites.warmup_idle_seconds, check_templates.warmup_idle_seconds),
+			COALESCE(websites.warmup_idle_seconds, check_templates.warmup_idle_seconds) IS NOT NULL),
+		COALESCE(websites.warmup_slow_ms, check_templates.warmup_slow_ms, 0), COALESCE(websites.timeout_seconds, check_templates.timeout_seconds, 0)
+		FROM websites LEFT JOIN network_profiles ON network_profiles.name = websites.network_profile
+		LEFT JOIN check_templates ON check_templates.id = websites.template_id
+		WHERE websites.website_url = ?`
+
+	var maxBody, siteMaxRedirects sql.NullInt64
+	var profileName sql.NullString
+	var profile networkProfile
+	var warmUpSlowMs, timeoutSeconds int64
+	err := db.QueryRow(query, url).Scan(&maxBody, &siteMaxRedirects, &settings.Debug, &settings.JumpHost, &settings.SSHKeyPath,
+		&profileName, &profile.Interface, &profile.SourceAddress, &profile.RoutingMark, &profile.DNSServer, &settings.InMaintenance,
+		&settings.WarmUp, &warmUpSlowMs, &timeoutSeconds)
+	// Canary sides don't have to be websites, they get the defaults.
+	if err == sql.ErrNoRows {
+		return settings
+	}
+	if err != nil {
+		fmt.Printf("Error getting settings for %s: %v\n", url, err)
+		return settings
+	}
+
+	if maxBody.Valid && maxBody.Int64 > 0 {
+		settings.MaxBodyBytes = maxBody.Int64
+	}
+	if siteMaxRedirects.Valid && siteMaxRedirects.Int64 >= 0 {
+		settings.MaxRedirects = int(siteMaxRedirects.Int64)
+	}
+	settings.WarmUpSlow = time.Duration(warmUpSlowMs) * time.Millisecond
+	settings.Timeout = time.Duration(timeoutSeconds) * time.Second
+	if profileName.Valid {
+		profile.Name = profileName.String
+		settings.Network = &profile
+	}
+
+	return settings
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var checkResultsRetention = 90 * 24 * time.Hour
+
+type tagSignal struct {
+	Tag          string   `json:"tag"`
+	Websites     []string `json:"websites"`
+	DownWebsites []string `json:"down_websites"`
+	Checks       int      `json:"checks"`
+	Failures     int      `json:"failures"`
+	FailureRate  float64  `json:"failure_rate"`
+	LatencyAvgMs float64  `json:"latency_avg_ms"`
+	LatencyP95Ms float64  `json:"latency_p95_ms"`
+
+	latencies []float64
+	lastUp    map[string]bool
+}
+
+// saveCheckResult keeps the outcome of every check for signals and history.
+// Skipped checks aren't checks and aren't saved.
+func saveCheckResult(db *sql.DB, url, status string, responseTime time.Duration) {
+	if strings.HasPrefix(status, "Skipped") {
+		return
+	}
+
+	query := "INSERT INTO check_results (website_url, region, checked_at, up, status, response_time, redirect_chain) SELECT ?, ?, NOW(), ?, ?, ?, redirect_chain FROM websites WHERE website_url = ?"
+	_, err := db.Exec(query, url, probeRegion, statusUp(status), truncate(status, 255), responseTime.Seconds(), url)
+	if err != nil {
+		fmt.Printf("Error saving check result for %s: %v\n", url, err)
+	}
+
+	recordEvent(eventCheck, url, status, map[string]any{"up": statusUp(status), "response_time": responseTime.Seconds(), "region": probeRegion})
+	emitCheckResult(url, status, responseTime)
+}
+
+func pruneCheckResults(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM check_results WHERE checked_at < ?", time.Now().Add(-checkResultsRetention))
+	if err != nil {
+		return fmt.Errorf("pruning check results: %v", err)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// getTagSignals summarizes the check results since `since` per tag.
+func getTagSignals(db *sql.DB, since time.Time, tag string) ([]*tagSignal, error) {
+	query := `SELECT website_tags.tag, check_results.website_url, check_results.up, check_results.response_time
+		FROM check_results JOIN website_tags ON website_tags.website_url = check_results.website_url
+		WHERE check_results.checked_at >= ? AND (? = '' OR website_tags.tag = ?)
+		ORDER BY check_results.checked_at`
+
+	rows, err := db.Query(query, since, tag, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	signals := make(map[string]*tagSignal)
+	for rows.Next() {
+		var t, url string
+		var up bool
+		var responseTime float64
+		if err := rows.Scan(&t, &url, &up, &responseTime); err != nil {
+			return nil, err
+		}
+
+		s, ok := signals[t]
+		if !ok {
+			s = &tagSignal{Tag: t, Websites: []string{}, DownWebsites: []string{}, lastUp: make(map[string]bool)}
+			signals[t] = s
+		}
+		if _, seen := s.lastUp[url]; !seen {
+			s.Websites = append(s.Websites, url)
+		}
+		s.lastUp[url] = up
+		s.Checks++
+		if !up {
+			s.Failures++
+			continue
+		}
+		s.latencies = append(s.latencies, responseTime*1000)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*tagSignal, 0, len(signals))
+	for _, s := range signals {
+		s.FailureRate = float64(s.Failures) / float64(s.Checks)
+		s.LatencyAvgMs, s.LatencyP95Ms = latencyStats(s.latencies)
+		for _, url := range s.Websites {
+			if !s.lastUp[url] {
+				s.DownWebsites = append(s.DownWebsites, url)
+			}
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Tag < result[j].Tag })
+
+	return result, nil
+}
+
+// latencyStats returns the average and 95th percentile of the latencies.
+func latencyStats(latencies []float64) (float64, float64) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+
+	sorted := append([]float64(nil), latencies...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, l := range sorted {
+		sum += l
+	}
+	p95 := sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+
+	return sum / float64(len(sorted)), p95
+}
+
+// handleSignals serves GET /api/signals?window=15m&tag=...&format=prometheus.
+// It is meant for autoscalers and traffic managers, so the default JSON can
+// also be served in the Prometheus text format.
+func handleSignals(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window := 15 * time.Minute
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid window")
+				return
+			}
+			window = d
+		}
+
+		now := time.Now()
+		signals, err := getTagSignals(db, now.Add(-window), r.URL.Query().Get("tag"))
+		if err != nil {
+			fmt.Printf("Error getting signals: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		if r.URL.Query().Get("format") == "prometheus" {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			for _, s := range signals {
+				fmt.Fprintf(w, "uptimemonitor_failure_rate{tag=%q} %g\n", s.Tag, s.FailureRate)
+				fmt.Fprintf(w, "uptimemonitor_latency_avg_ms{tag=%q} %g\n", s.Tag, s.LatencyAvgMs)
+				fmt.Fprintf(w, "uptimemonitor_latency_p95_ms{tag=%q} %g\n", s.Tag, s.LatencyP95Ms)
+				fmt.Fprintf(w, "uptimemonitor_websites_down{tag=%q} %d\n", s.Tag, len(s.DownWebsites))
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"generated_at":   now,
+			"window_seconds": window.Seconds(),
+			"tags":           signals,
+		})
+	}
+}
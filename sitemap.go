@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var sitemapInterval = 7 * 24 * time.Hour
+var sitemapSampleSize = 50
+
+// sitemapMaxBytes is the largest sitemap the protocol allows.
+const sitemapMaxBytes = 50 << 20
+
+type sitemapURLSet struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+func runSitemapChecks(db *sql.DB) error {
+	query := "SELECT website_url, COALESCE(sitemap_url, '') FROM websites WHERE sitemap_check = 1 AND NOT paused"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("fetching sitemap websites: %v", err)
+	}
+
+	type sitemapSite struct{ url, sitemap string }
+	var sites []sitemapSite
+	for rows.Next() {
+		var s sitemapSite
+		if err := rows.Scan(&s.url, &s.sitemap); err != nil {
+			fmt.Printf("Error reading sitemap website: %v\n", err)
+			continue
+		}
+		if s.sitemap == "" {
+			s.sitemap = strings.TrimSuffix(s.url, "/") + "/sitemap.xml"
+		}
+		sites = append(sites, s)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("reading sitemap websites: %v", err)
+	}
+
+	for _, s := range sites {
+		checkSitemap(db, s.url, s.sitemap)
+	}
+	return nil
+}
+
+// checkSitemap fetches the sitemap of a website, requests a random sample of
+// the listed URLs and records how many of them returned 200. Slack only hears
+// about it when some pages are broken.
+func checkSitemap(db *sql.DB, url, sitemapURL string) {
+	settings := getWebsiteSettings(db, url)
+	client := checkClient(settings, nil)
+	if client.Timeout == 0 {
+		client.Timeout = 30 * time.Second
+	}
+
+	urls, err := fetchSitemap(client, sitemapURL, true)
+	if err != nil {
+		fmt.Printf("Error fetching sitemap for %s: %v\n", url, err)
+		if settings.InMaintenance {
+			return
+		}
+		sendSlackMessage(fmt.Sprintf("WARNING: Sitemap of %s could not be fetched. Error: %s", url, err.Error()))
+		return
+	}
+	if len(urls) == 0 {
+		fmt.Printf("Sitemap for %s has no URLs\n", url)
+		return
+	}
+
+	rand.Shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	sample := urls
+	if len(sample) > sitemapSampleSize {
+		sample = sample[:sitemapSampleSize]
+	}
+
+	var healthy int
+	var broken []string
+	for _, u := range sample {
+		resp, err := client.Get(asciiURL(u))
+		if err != nil {
+			broken = append(broken, fmt.Sprintf("%s (%v)", u, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			healthy++
+		} else {
+			broken = append(broken, fmt.Sprintf("%s (%d)", u, resp.StatusCode))
+		}
+	}
+
+	percentage := float64(healthy) / float64(len(sample)) * 100
+
+	query := "INSERT INTO sitemap_reports (website_url, checked_at, total_urls, sampled_urls, healthy_urls, healthy_percentage) VALUES (?, NOW(), ?, ?, ?, ?)"
+	_, err = db.Exec(query, url, len(urls), len(sample), healthy, percentage)
+	if err != nil {
+		fmt.Printf("Error saving sitemap report for %s: %v\n", url, err)
+	}
+
+	if len(broken) == 0 || settings.InMaintenance {
+		return
+	}
+
+	if len(broken) > 10 {
+		broken = append(broken[:10], fmt.Sprintf("and %d more", len(broken)-10))
+	}
+	message := fmt.Sprintf("MONITOR --> Sitemap coverage for %s: %.1f%% healthy (%d of %d sampled, %d listed)", url, percentage, healthy, len(sample), len(urls))
+	message += "\nBroken:\n" + strings.Join(broken, "\n")
+	sendSlackMessage(message)
+}
+
+// fetchSitemap returns the page URLs listed in a sitemap. Sitemap indexes are
+// followed one level deep.
+func fetchSitemap(client *http.Client, sitemapURL string, followIndex bool) ([]string, error) {
+	resp, err := client.Get(asciiURL(sitemapURL))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap returned status %d", resp.StatusCode)
+	}
+
+	body, err := readBody(resp, sitemapMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var set sitemapURLSet
+	if err := xml.Unmarshal(body, &set); err != nil {
+		return nil, err
+	}
+
+	urls := set.URLs
+	if followIndex {
+		for _, child := range set.Sitemaps {
+			childURLs, err := fetchSitemap(client, strings.TrimSpace(child), false)
+			if err != nil {
+				fmt.Printf("Error fetching sitemap %s: %v\n", child, err)
+				continue
+			}
+			urls = append(urls, childURLs...)
+		}
+	}
+
+	for i := range urls {
+		urls[i] = strings.TrimSpace(urls[i])
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// slaKey signs the public SLA statements (SLA_SIGNING_KEY_PATH, a PEM RSA or
+// P-256 key). Keep it stable: statements can only be verified with the key
+// that signed them.
+var slaKey crypto.Signer
+
+var maxSLAPeriod = 366 * 24 * time.Hour
+
+func loadSLAKey() error {
+	path := os.Getenv("SLA_SIGNING_KEY_PATH")
+	if path == "" {
+		return nil
+	}
+	key, err := readPrivateKey(path)
+	if err != nil {
+		return err
+	}
+	if _, err := publicJWK(key); err != nil {
+		return err
+	}
+	slaKey = key
+	return nil
+}
+
+type slaStatement struct {
+	Issuer   string    `json:"iss"`
+	Subject  string    `json:"sub"`
+	IssuedAt int64     `json:"iat"`
+	From     time.Time `json:"period_from"`
+	To       time.Time `json:"period_to"`
+	uptimeFigures
+	Incidents    int `json:"incidents"`
+	Checks       int `json:"checks"`
+	FailedChecks int `json:"failed_checks"`
+}
+
+func buildSLAStatement(db *sql.DB, url string, from, to time.Time) (slaStatement, error) {
+	incidents, err := getIncidents(db, url, from, to)
+	if err != nil {
+		return slaStatement{}, err
+	}
+
+	figures, err := measureUptime(db, url, incidents, from, to)
+	if err != nil {
+		return slaStatement{}, err
+	}
+
+	s := slaStatement{
+		Issuer:        publicURL(),
+		Subject:       url,
+		IssuedAt:      time.Now().Unix(),
+		From:          from.UTC(),
+		To:            to.UTC(),
+		uptimeFigures: figures,
+		Incidents:     len(incidents),
+	}
+
+	query := "SELECT COUNT(*), COALESCE(SUM(NOT up), 0) FROM check_results WHERE website_url = ? AND checked_at BETWEEN ? AND ?"
+	if err := db.QueryRow(query, url, from, to).Scan(&s.Checks, &s.FailedChecks); err != nil {
+		return slaStatement{}, err
+	}
+	return s, nil
+}
+
+// handlePublicSLA serves GET /public/sla?url=...&from=...&to=... without
+// authentication for websites with public_sla set. The response is a compact
+// JWS (application/jose) that anyone can verify with /public/sla/jwks.json.
+func handlePublicSLA(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if slaKey == nil {
+			writeError(w, http.StatusNotFound, "signed SLA statements are not configured")
+			return
+		}
+
+		url := r.URL.Query().Get("url")
+		var public bool
+		err := db.QueryRow("SELECT public_sla FROM websites WHERE website_url = ?", url).Scan(&public)
+		if err == sql.ErrNoRows || (err == nil && !public) {
+			writeError(w, http.StatusNotFound, "no public SLA for this website")
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error getting public SLA setting for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		from, to, err := queryTimeRange(r, 30*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if now := time.Now(); to.After(now) {
+			to = now
+		}
+		if !from.Before(to) || to.Sub(from) > maxSLAPeriod {
+			writeError(w, http.StatusBadRequest, "the period must end after it starts and be at most a year")
+			return
+		}
+
+		statement, err := buildSLAStatement(db, url, from, to)
+		if err != nil {
+			fmt.Printf("Error building SLA statement for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		jwk, _ := publicJWK(slaKey)
+		token, err := signJWT(slaKey, map[string]any{"kid": jwk["kid"]}, statement)
+		if err != nil {
+			fmt.Printf("Error signing SLA statement for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "signing error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jose")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		fmt.Fprint(w, token)
+	}
+}
+
+// handleSLAKeys serves GET /public/sla/jwks.json with the verification key.
+func handleSLAKeys(w http.ResponseWriter, r *http.Request) {
+	if slaKey == nil {
+		writeError(w, http.StatusNotFound, "signed SLA statements are not configured")
+		return
+	}
+	jwk, err := publicJWK(slaKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{jwk}})
+}
+
+// handleVerifySLA serves POST /public/sla/verify with a statement as the body,
+// for auditors without a JOSE library at hand. It returns the claims when the
+// signature is ours.
+func handleVerifySLA(w http.ResponseWriter, r *http.Request) {
+	if slaKey == nil {
+		writeError(w, http.StatusNotFound, "signed SLA statements are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	claims, err := verifyJWT(slaKey, strings.TrimSpace(string(body)))
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"valid": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"valid": true, "claims": json.RawMessage(claims)})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Charts are uploaded with the Slack files API, which needs a bot token with
+// the files:write scope and the ID of the channel; the incoming webhook can't
+// carry files. Without SLACK_BOT_TOKEN no charts are sent.
+var (
+	chartWindow      = 6 * time.Hour
+	chartMinDuration = 15 * time.Minute
+	chartWidth       = 800
+	chartHeight      = 300
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartGrid       = color.RGBA{225, 225, 225, 255}
+	chartIncident   = color.RGBA{255, 215, 215, 255}
+	chartLine       = color.RGBA{40, 110, 200, 255}
+	chartFailure    = color.RGBA{210, 30, 30, 255}
+)
+
+type chartPoint struct {
+	At           time.Time
+	Up           bool
+	ResponseTime float64
+}
+
+// chartIncidentAlert uploads a chart for significant incidents: when one opens
+// for a critical website and when one closes after lasting chartMinDuration.
+// Websites in maintenance get no chart.
+func chartIncidentAlert(db *sql.DB, url, status string, opened bool) {
+	if os.Getenv("SLACK_BOT_TOKEN") == "" || os.Getenv("SLACK_CHANNEL_ID") == "" || getWebsiteSettings(db, url).InMaintenance {
+		return
+	}
+
+	var severity string
+	var lasted sql.NullInt64
+	query := `SELECT COALESCE(websites.severity, check_templates.severity, ''),
+		(SELECT TIMESTAMPDIFF(SECOND, started_at, ended_at) FROM incidents WHERE website_url = websites.website_url AND ended_at IS NOT NULL ORDER BY ended_at DESC LIMIT 1)
+		FROM websites LEFT JOIN check_templates ON check_templates.id = websites.template_id WHERE websites.website_url = ?`
+	if err := db.QueryRow(query, url).Scan(&severity, &lasted); err != nil {
+		fmt.Printf("Error getting incident for chart of %s: %v\n", url, err)
+		return
+	}
+
+	var comment string
+	switch {
+	case opened && severity == "critical":
+		comment = fmt.Sprintf("%s is down: %s", url, status)
+	case !opened && lasted.Valid && time.Duration(lasted.Int64)*time.Second >= chartMinDuration:
+		comment = fmt.Sprintf("%s is up again after %s", url, formatDuration(time.Duration(lasted.Int64)*time.Second))
+	default:
+		return
+	}
+
+	go func() {
+		if err := sendIncidentChart(db, url, comment); err != nil {
+			fmt.Printf("Error sending chart for %s: %v\n", url, err)
+		}
+	}()
+}
+
+func sendIncidentChart(db *sql.DB, url, comment string) error {
+	to := time.Now()
+	from := to.Add(-chartWindow)
+
+	rows, err := db.Query("SELECT checked_at, up, response_time FROM check_results WHERE website_url = ? AND region = ? AND checked_at >= ? ORDER BY checked_at", url, probeRegion, from)
+	if err != nil {
+		return err
+	}
+	var points []chartPoint
+	for rows.Next() {
+		var p chartPoint
+		if err := rows.Scan(&p.At, &p.Up, &p.ResponseTime); err != nil {
+			rows.Close()
+			return err
+		}
+		points = append(points, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	incidents, err := getIncidents(db, url, from, to)
+	if err != nil {
+		return err
+	}
+
+	img, peak := renderChart(points, incidents, from, to)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+
+	comment += fmt.Sprintf("\nResponse times of the last %s, top of the chart is %.0f ms, red is downtime.", formatDuration(chartWindow), peak*1000)
+	attempts, err := retryDelivery(func() error {
+		return uploadSlackFile(os.Getenv("SLACK_BOT_TOKEN"), os.Getenv("SLACK_CHANNEL_ID"), "incident.png", buf.Bytes(), comment)
+	})
+	recordNotification("slack", "chart", comment, attempts, err)
+	return err
+}
+
+// renderChart draws the response times as a line, failed checks as marks on
+// the bottom and incidents as red bands. It returns the response time at the
+// top of the chart in seconds.
+func renderChart(points []chartPoint, incidents []incident, from, to time.Time) (*image.RGBA, float64) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	x := func(t time.Time) int {
+		return int(float64(chartWidth-1) * float64(t.Sub(from)) / float64(to.Sub(from)))
+	}
+
+	for _, inc := range incidents {
+		end := to
+		if inc.EndedAt.Valid {
+			end = inc.EndedAt.Time
+		}
+		band := image.Rect(max(0, x(inc.StartedAt)), 0, min(chartWidth, x(end)+1), chartHeight)
+		draw.Draw(img, band, &image.Uniform{chartIncident}, image.Point{}, draw.Src)
+	}
+
+	for i := 1; i < 4; i++ {
+		for px := 0; px < chartWidth; px += 2 {
+			img.Set(px, i*chartHeight/4, chartGrid)
+		}
+	}
+
+	peak := 0.0
+	for _, p := range points {
+		peak = max(peak, p.ResponseTime)
+	}
+	if peak == 0 {
+		peak = 1
+	}
+	peak *= 1.1
+	y := func(seconds float64) int {
+		return chartHeight - 1 - int(float64(chartHeight-10)*seconds/peak)
+	}
+
+	prevX, prevY := -1, 0
+	for _, p := range points {
+		px := x(p.At)
+		if !p.Up {
+			for py := chartHeight - 8; py < chartHeight; py++ {
+				img.Set(px, py, chartFailure)
+				img.Set(px+1, py, chartFailure)
+			}
+			prevX = -1
+			continue
+		}
+		py := y(p.ResponseTime)
+		if prevX >= 0 {
+			drawLine(img, prevX, prevY, px, py, chartLine)
+		}
+		prevX, prevY = px, py
+	}
+
+	return img, peak
+}
+
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		px := x0 + (x1-x0)*i/steps
+		py := y0 + (y1-y0)*i/steps
+		img.Set(px, py, c)
+		img.Set(px, py+1, c)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// uploadSlackFile shares a file in a channel: get an upload URL, send the file
+// there and complete the upload with the channel and the message.
+func uploadSlackFile(token, channel, filename string, data []byte, comment string) error {
+	form := neturl.Values{"filename": {filename}, "length": {fmt.Sprint(len(data))}}
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	if err := slackAPI(token, "files.getUploadURLExternal", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &upload); err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	mw.Close()
+
+	resp, err := http.Post(upload.UploadURL, mw.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack file upload returned status %s", resp.Status)
+	}
+
+	complete, err := json.Marshal(map[string]any{
+		"files":           []map[string]string{{"id": upload.FileID, "title": filename}},
+		"channel_id":      channel,
+		"initial_comment": comment,
+	})
+	if err != nil {
+		return err
+	}
+	return slackAPI(token, "files.completeUploadExternal", "application/json; charset=utf-8", bytes.NewReader(complete), nil)
+}
+
+func slackAPI(token, method, contentType string, body io.Reader, result any) error {
+	req, err := http.NewRequest(http.MethodPost, "https://slack.com/api/"+method, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("Slack %s returned %s", method, resp.Status)
+	}
+	if !status.OK {
+		return fmt.Errorf("Slack %s failed: %s", method, status.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
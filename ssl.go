@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+func issuerOrganization(cert *x509.Certificate) string {
+	if len(cert.Issuer.Organization) > 0 {
+		return cert.Issuer.Organization[0]
+	}
+	return cert.Issuer.CommonName
+}
+
+// checkIssuerPolicy alerts when the certificate issuer stops matching the issuer
+// pinned for the website or, when there is no pin, when the issuing organization
+// differs from the one seen on the previous check. Intermediates of the same CA
+// (e.g. Let's Encrypt R10/R11) rotate regularly, so only the organization is
+// compared for change detection. Nothing is sent during maintenance, when
+// certificates are usually swapped.
+func checkIssuerPolicy(db *sql.DB, url string, cert *x509.Certificate, settings websiteSettings) {
+	query := "SELECT COALESCE(expected_ssl_issuer, ''), COALESCE(ssl_issuer_org, ''), ssl_issuer_mismatch FROM websites WHERE website_url = ?"
+
+	var expected, previous string
+	var wasMismatch bool
+	err := db.QueryRow(query, url).Scan(&expected, &previous, &wasMismatch)
+	if err != nil {
+		fmt.Printf("Error getting ssl issuer policy for %s: %v\n", url, err)
+		return
+	}
+
+	issuer := cert.Issuer.String()
+	org := issuerOrganization(cert)
+
+	var message string
+	if expected != "" {
+		mismatch := !strings.Contains(strings.ToLower(issuer), strings.ToLower(expected))
+		if mismatch != wasMismatch {
+			_, err := db.Exec("UPDATE websites SET ssl_issuer_mismatch = ? WHERE website_url = ?", mismatch, url)
+			if err != nil {
+				fmt.Printf("Error updating ssl issuer policy for %s: %v\n", url, err)
+			}
+		}
+		if !mismatch || wasMismatch {
+			return
+		}
+		message = fmt.Sprintf("The SSL certificate of %s is issued by %s, expected issuer is %s.", url, issuer, expected)
+	} else if previous != "" && org != previous {
+		message = fmt.Sprintf("The SSL certificate issuer of %s changed from %s to %s.", url, previous, issuer)
+	} else {
+		return
+	}
+
+	fmt.Println("SSL ISSUER --> " + message)
+	if settings.InMaintenance {
+		return
+	}
+	sendSlackMessage("WARNING: " + message)
+
+	clientEmail, err := getClientEmail(db, url)
+	if err != nil {
+		fmt.Printf("Error getting client email for %s: %v\n", url, err)
+		return
+	}
+	sendEmail(clientEmail, fmt.Sprintf("ALERT!!!: SSL certificate issuer changed for %s", url), "Dear user,\n\n"+message+"\n\nIf you didn't expect this change, please check it ASAP")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type statusCodeDay struct {
+	Day    string `json:"day"`
+	Count2 int    `json:"2xx"`
+	Count3 int    `json:"3xx"`
+	Count4 int    `json:"4xx"`
+	Count5 int    `json:"5xx"`
+	Errors int    `json:"errors"`
+}
+
+// recordStatusCode counts the response status of a check in the daily
+// distribution of the website. A status of 0 counts as a connection error.
+func recordStatusCode(db *sql.DB, url string, status int) {
+	column := "count_error"
+	switch {
+	case status >= 200 && status < 300:
+		column = "count_2xx"
+	case status >= 300 && status < 400:
+		column = "count_3xx"
+	case status >= 400 && status < 500:
+		column = "count_4xx"
+	case status >= 500:
+		column = "count_5xx"
+	}
+
+	query := fmt.Sprintf("INSERT INTO status_code_counts (website_url, day, %[1]s) VALUES (?, CURDATE(), 1) ON DUPLICATE KEY UPDATE %[1]s = %[1]s + 1", column)
+	_, err := db.Exec(query, url)
+	if err != nil {
+		fmt.Printf("Error saving status code for %s: %v\n", url, err)
+	}
+}
+
+func getStatusCodeDays(db *sql.DB, url, from, to string) ([]statusCodeDay, error) {
+	query := "SELECT day, count_2xx, count_3xx, count_4xx, count_5xx, count_error FROM status_code_counts WHERE website_url = ? AND day BETWEEN ? AND ? ORDER BY day"
+
+	rows, err := db.Query(query, url, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []statusCodeDay{}
+	for rows.Next() {
+		var d statusCodeDay
+		var day time.Time
+		if err := rows.Scan(&day, &d.Count2, &d.Count3, &d.Count4, &d.Count5, &d.Errors); err != nil {
+			return nil, err
+		}
+		d.Day = day.Format("2006-01-02")
+		days = append(days, d)
+	}
+
+	return days, rows.Err()
+}
+
+// handleStatusCodes serves GET /api/status-codes?url=...&from=...&to=...
+func handleStatusCodes(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+		if !allowedWebsite(db, r, url) {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+
+		from, to, err := queryTimeRange(r, 30*24*time.Hour)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		days, err := getStatusCodeDays(db, url, from.Format("2006-01-02"), to.Format("2006-01-02"))
+		if err != nil {
+			fmt.Printf("Error getting status codes for %s: %v\n", url, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, days)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+type checkStep struct {
+	Method         string
+	URL            string
+	Body           string
+	ExpectedStatus int
+}
+
+type savedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func getWebsiteSteps(db *sql.DB, url string) ([]checkStep, error) {
+	query := "SELECT method, step_url, COALESCE(body, ''), expected_status FROM website_steps WHERE website_url = ? ORDER BY step_order"
+
+	rows, err := db.Query(query, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []checkStep
+
+	for rows.Next() {
+		var step checkStep
+		if err := rows.Scan(&step.Method, &step.URL, &step.Body, &step.ExpectedStatus); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, rows.Err()
+}
+
+// runSteps executes the steps of a multi-step monitor in order. All steps share
+// one cookie jar so logins and sessions carry over like they would in a browser.
+// A failing step throws away the persisted session.
+func runSteps(db *sql.DB, url string, steps []checkStep, settings websiteSettings) error {
+	base, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+
+	persist := sessionPersisted(db, url)
+	if persist {
+		loadSession(db, url, jar)
+	}
+
+	client := checkClient(settings, nil)
+	client.Jar = jar
+	client.Timeout = 30 * time.Second
+	visited := make(map[string]*neturl.URL)
+
+	for i, step := range steps {
+		if err := runStep(client, base, i, step, settings, visited); err != nil {
+			// The stored session may be what broke the step, so the next
+			// check starts from a fresh one.
+			if persist {
+				clearSession(db, url)
+			}
+			return err
+		}
+	}
+
+	if persist {
+		saveSession(db, url, jar, visited)
+	}
+
+	return nil
+}
+
+func runStep(client *http.Client, base *neturl.URL, i int, step checkStep, settings websiteSettings, visited map[string]*neturl.URL) error {
+	ref, err := neturl.Parse(step.URL)
+	if err != nil {
+		return fmt.Errorf("step %d: %v", i+1, err)
+	}
+	stepURL := base.ResolveReference(ref)
+	visited[stepURL.Scheme+"://"+stepURL.Host] = stepURL
+
+	req, err := http.NewRequest(step.Method, stepURL.String(), strings.NewReader(step.Body))
+	if err != nil {
+		return fmt.Errorf("step %d: %v", i+1, err)
+	}
+	if step.Body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("step %d (%s %s): %v", i+1, step.Method, stepURL, err)
+	}
+	_, err = readBody(resp, settings.MaxBodyBytes)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("step %d (%s %s): %v", i+1, step.Method, stepURL, err)
+	}
+
+	if resp.StatusCode != step.ExpectedStatus {
+		return fmt.Errorf("step %d (%s %s): expected status %d, got %d", i+1, step.Method, stepURL, step.ExpectedStatus, resp.StatusCode)
+	}
+	return nil
+}
+
+func sessionPersisted(db *sql.DB, url string) bool {
+	var persist bool
+	err := db.QueryRow("SELECT persist_session FROM websites WHERE website_url = ?", url).Scan(&persist)
+	if err != nil {
+		fmt.Printf("Error getting session setting for %s: %v\n", url, err)
+		return false
+	}
+	return persist
+}
+
+func loadSession(db *sql.DB, url string, jar http.CookieJar) {
+	var data string
+	err := db.QueryRow("SELECT cookies FROM website_sessions WHERE website_url = ?", url).Scan(&data)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error loading session for %s: %v\n", url, err)
+		return
+	}
+
+	var stored map[string][]savedCookie
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		fmt.Printf("Error decoding session for %s: %v\n", url, err)
+		return
+	}
+
+	for origin, cookies := range stored {
+		u, err := neturl.Parse(origin)
+		if err != nil {
+			continue
+		}
+		var httpCookies []*http.Cookie
+		for _, c := range cookies {
+			httpCookies = append(httpCookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		jar.SetCookies(u, httpCookies)
+	}
+}
+
+func saveSession(db *sql.DB, url string, jar http.CookieJar, visited map[string]*neturl.URL) {
+	stored := make(map[string][]savedCookie)
+	for origin, u := range visited {
+		for _, c := range jar.Cookies(u) {
+			stored[origin] = append(stored[origin], savedCookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		fmt.Printf("Error encoding session for %s: %v\n", url, err)
+		return
+	}
+
+	query := "REPLACE INTO website_sessions (website_url, cookies, updated_at) VALUES (?, ?, NOW())"
+	_, err = db.Exec(query, url, string(data))
+	if err != nil {
+		fmt.Printf("Error saving session for %s: %v\n", url, err)
+	}
+}
+
+func clearSession(db *sql.DB, url string) {
+	_, err := db.Exec("DELETE FROM website_sessions WHERE website_url = ?", url)
+	if err != nil {
+		fmt.Printf("Error clearing session for %s: %v\n", url, err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// syslogSDID is the structured data ID of our events. 32473 is the enterprise
+// number reserved for examples and documentation (RFC 5612).
+const syslogSDID = "uptime@32473"
+
+// Syslog export is configured with SYSLOG_ADDR, e.g. udp://siem:514,
+// tcp://siem:601 or unix:///dev/log, SYSLOG_FACILITY (0-23, default 16 for
+// local0) and SYSLOG_EVENTS, the event types to export (default
+// check,incident).
+var (
+	syslogNetwork  string
+	syslogAddress  string
+	syslogFacility = 16
+	syslogTypes    = map[string]bool{eventCheck: true, eventIncident: true}
+	syslogHostname = "-"
+	pendingSyslog  = make(chan event, 1000)
+)
+
+func loadSyslog() error {
+	addr := os.Getenv("SYSLOG_ADDR")
+	if addr == "" {
+		return nil
+	}
+	network, address, ok := strings.Cut(addr, "://")
+	if !ok || (network != "udp" && network != "tcp" && network != "unix" && network != "unixgram") {
+		return fmt.Errorf("SYSLOG_ADDR must look like udp://host:514, tcp://host:601 or unix:///dev/log")
+	}
+
+	if v := os.Getenv("SYSLOG_FACILITY"); v != "" {
+		var facility int
+		if _, err := fmt.Sscanf(v, "%d", &facility); err != nil || facility < 0 || facility > 23 {
+			return fmt.Errorf("invalid SYSLOG_FACILITY %q", v)
+		}
+		syslogFacility = facility
+	}
+	if v := os.Getenv("SYSLOG_EVENTS"); v != "" {
+		syslogTypes = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			syslogTypes[strings.TrimSpace(t)] = true
+		}
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		syslogHostname = host
+	}
+
+	syslogNetwork, syslogAddress = network, address
+	go runSyslog()
+	return nil
+}
+
+// exportSyslog queues an event for syslog without ever blocking the caller.
+func exportSyslog(e event) {
+	if syslogNetwork == "" || !syslogTypes[e.Type] {
+		return
+	}
+	select {
+	case pendingSyslog <- e:
+	default:
+		fmt.Printf("Syslog queue is full, dropped %s event: %s\n", e.Type, e.Message)
+	}
+}
+
+func runSyslog() {
+	var conn net.Conn
+	for e := range pendingSyslog {
+		msg := formatSyslog(e)
+		for attempt := 0; attempt < 2; attempt++ {
+			if conn == nil {
+				var err error
+				conn, err = net.DialTimeout(syslogNetwork, syslogAddress, 5*time.Second)
+				if err != nil {
+					fmt.Printf("Error connecting to syslog at %s: %v\n", syslogAddress, err)
+					break
+				}
+			}
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write(syslogFrame(msg)); err == nil {
+				break
+			} else {
+				fmt.Printf("Error writing to syslog at %s: %v\n", syslogAddress, err)
+			}
+			// Reconnect once, the collector may have restarted.
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// syslogFrame uses octet counting (RFC 6587) on TCP, where messages may
+// contain newlines. Other transports carry one message per write.
+func syslogFrame(msg string) []byte {
+	if syslogNetwork == "tcp" {
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	}
+	return []byte(msg)
+}
+
+// formatSyslog formats an event as an RFC 5424 message with the website and
+// the event details as structured data.
+func formatSyslog(e event) string {
+	params := map[string]string{}
+	if e.URL != nil {
+		params["url"] = *e.URL
+	}
+	var details map[string]any
+	if json.Unmarshal(e.Details, &details) == nil {
+		for k, v := range details {
+			if s, ok := v.(string); ok {
+				params[k] = s
+			} else if data, err := json.Marshal(v); err == nil {
+				params[k] = string(data)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for _, k := range keys {
+		fmt.Fprintf(&sd, ` %s="%s"`, syslogParamName(k), syslogEscaper.Replace(params[k]))
+	}
+	sd.WriteString("]")
+
+	pri := syslogFacility*8 + syslogSeverity(e, details)
+	timestamp := e.OccurredAt.Format("2006-01-02T15:04:05.000000Z07:00")
+	return fmt.Sprintf("<%d>1 %s %s uptimemonitor %d %s %s \ufeff%s", pri, timestamp, syslogHostname, os.Getpid(), e.Type, sd.String(), e.Message)
+}
+
+var syslogEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogParamName keeps to the characters RFC 5424 allows in names.
+func syslogParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	return truncate(name, 32)
+}
+
+// syslogSeverity maps events to severities: failed checks and opened
+// incidents are warnings, everything else is informational.
+func syslogSeverity(e event, details map[string]any) int {
+	switch e.Type {
+	case eventCheck:
+		if up, ok := details["up"].(bool); ok && !up {
+			return 4
+		}
+	case eventIncident:
+		if strings.Contains(e.Message, "opened") {
+			return 4
+		}
+		return 5
+	case eventNotification:
+		if delivered, ok := details["delivered"].(bool); ok && !delivered {
+			return 3
+		}
+	case eventConfig:
+		return 5
+	}
+	return 6
+}
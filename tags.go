@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleSetTags serves PUT /api/websites/tags with {"url": ..., "tags": [...]}
+// and replaces all tags of the website.
+func handleSetTags(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL  string   `json:"url"`
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+			writeError(w, http.StatusBadRequest, "url and tags are required")
+			return
+		}
+
+		if err := setWebsiteTags(db, body.URL, body.Tags); err != nil {
+			fmt.Printf("Error setting tags for %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		recordEvent(eventConfig, body.URL, "Tags changed by "+requestActor(r), map[string]any{"tags": body.Tags})
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+func setWebsiteTags(db *sql.DB, url string, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM website_tags WHERE website_url = ?", url); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT IGNORE INTO website_tags (website_url, tag) VALUES (?, ?)", url, tag); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// checkTemplate holds settings many websites share. A website with a template
+// uses the value of the template for every setting it doesn't set itself, so
+// changing the standard policy is one update of the template.
+type checkTemplate struct {
+	Name                  string          `json:"name"`
+	CheckIntervalSeconds  *int            `json:"check_interval_seconds"`
+	TimeoutSeconds        *int            `json:"timeout_seconds"`
+	MaxBodyBytes          *int64          `json:"max_body_bytes"`
+	MaxRedirects          *int            `json:"max_redirects"`
+	WarmupIdleSeconds     *int            `json:"warmup_idle_seconds"`
+	WarmupSlowMs          *int            `json:"warmup_slow_ms"`
+	Severity              *string         `json:"severity"`
+	EscalationPolicy      *string         `json:"escalation_policy"`
+	ResponseSchema        json.RawMessage `json:"response_schema,omitempty"`
+	ResponseSchemaPointer *string         `json:"response_schema_pointer"`
+	Websites              int             `json:"websites"`
+}
+
+func getCheckTemplates(db *sql.DB) ([]checkTemplate, error) {
+	query := `SELECT check_templates.name, check_templates.check_interval_seconds, check_templates.timeout_seconds, check_templates.max_body_bytes,
+		check_templates.max_redirects, check_templates.warmup_idle_seconds, check_templates.warmup_slow_ms, check_templates.severity,
+		escalation_policies.name, check_templates.response_schema, check_templates.response_schema_pointer,
+		(SELECT COUNT(*) FROM websites WHERE websites.template_id = check_templates.id)
+		FROM check_templates LEFT JOIN escalation_policies ON escalation_policies.id = check_templates.escalation_policy_id
+		ORDER BY check_templates.name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []checkTemplate{}
+	for rows.Next() {
+		var t checkTemplate
+		var schema sql.NullString
+		err := rows.Scan(&t.Name, &t.CheckIntervalSeconds, &t.TimeoutSeconds, &t.MaxBodyBytes, &t.MaxRedirects, &t.WarmupIdleSeconds, &t.WarmupSlowMs,
+			&t.Severity, &t.EscalationPolicy, &schema, &t.ResponseSchemaPointer, &t.Websites)
+		if err != nil {
+			return nil, err
+		}
+		if schema.Valid {
+			t.ResponseSchema = json.RawMessage(schema.String)
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// handleCheckTemplates serves GET /api/templates.
+func handleCheckTemplates(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		templates, err := getCheckTemplates(db)
+		if err != nil {
+			fmt.Printf("Error fetching check templates: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		writeJSON(w, http.StatusOK, templates)
+	}
+}
+
+// handleSetCheckTemplate serves PUT /api/templates/{name} and creates or
+// replaces the template. Settings left out or null aren't part of it.
+func handleSetCheckTemplate(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var t checkTemplate
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		t.Name = r.PathValue("name")
+
+		if t.CheckIntervalSeconds != nil && *t.CheckIntervalSeconds < 10 {
+			writeError(w, http.StatusBadRequest, "check_interval_seconds must be at least 10")
+			return
+		}
+		if t.TimeoutSeconds != nil && *t.TimeoutSeconds <= 0 {
+			writeError(w, http.StatusBadRequest, "timeout_seconds must be positive")
+			return
+		}
+		if t.Severity != nil {
+			s := strings.ToLower(strings.TrimSpace(*t.Severity))
+			if err := validSeverity(s); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			t.Severity = &s
+		}
+
+		var policyID *int
+		if t.EscalationPolicy != nil {
+			var id int
+			err := db.QueryRow("SELECT id FROM escalation_policies WHERE name = ?", *t.EscalationPolicy).Scan(&id)
+			if err == sql.ErrNoRows {
+				writeError(w, http.StatusNotFound, "escalation policy not found")
+				return
+			}
+			if err != nil {
+				fmt.Printf("Error getting escalation policy %s: %v\n", *t.EscalationPolicy, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			policyID = &id
+		}
+
+		var schema *string
+		if len(t.ResponseSchema) > 0 && string(t.ResponseSchema) != "null" {
+			pointer := ""
+			if t.ResponseSchemaPointer != nil {
+				pointer = *t.ResponseSchemaPointer
+			}
+			if _, err := compileResponseSchema(string(t.ResponseSchema), pointer); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid response_schema: "+err.Error())
+				return
+			}
+			s := string(t.ResponseSchema)
+			schema = &s
+		}
+
+		query := `INSERT INTO check_templates (name, check_interval_seconds, timeout_seconds, max_body_bytes, max_redirects, warmup_idle_seconds, warmup_slow_ms,
+			severity, escalation_policy_id, response_schema, response_schema_pointer, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+			ON DUPLICATE KEY UPDATE check_interval_seconds = VALUES(check_interval_seconds), timeout_seconds = VALUES(timeout_seconds),
+			max_body_bytes = VALUES(max_body_bytes), max_redirects = VALUES(max_redirects), warmup_idle_seconds = VALUES(warmup_idle_seconds),
+			warmup_slow_ms = VALUES(warmup_slow_ms), severity = VALUES(severity), escalation_policy_id = VALUES(escalation_policy_id),
+			response_schema = VALUES(response_schema), response_schema_pointer = VALUES(response_schema_pointer), updated_at = NOW()`
+		_, err := db.Exec(query, t.Name, t.CheckIntervalSeconds, t.TimeoutSeconds, t.MaxBodyBytes, t.MaxRedirects, t.WarmupIdleSeconds, t.WarmupSlowMs,
+			t.Severity, policyID, schema, t.ResponseSchemaPointer)
+		if err != nil {
+			fmt.Printf("Error saving check template %s: %v\n", t.Name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		db.QueryRow("SELECT COUNT(*) FROM websites JOIN check_templates ON check_templates.id = websites.template_id WHERE check_templates.name = ?", t.Name).Scan(&t.Websites)
+		recordEvent(eventConfig, "", fmt.Sprintf("Check template %s changed by %s, %d websites use it", t.Name, requestActor(r), t.Websites), t)
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// handleDeleteCheckTemplate serves DELETE /api/templates/{name}. Websites
+// using it keep only their own settings.
+func handleDeleteCheckTemplate(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		tx, err := db.Begin()
+		if err != nil {
+			fmt.Printf("Error deleting check template %s: %v\n", name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer tx.Rollback()
+
+		var id int
+		if err := tx.QueryRow("SELECT id FROM check_templates WHERE name = ?", name).Scan(&id); err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "check template not found")
+			return
+		} else if err != nil {
+			fmt.Printf("Error deleting check template %s: %v\n", name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		for _, query := range []string{
+			"UPDATE websites SET template_id = NULL WHERE template_id = ?",
+			"DELETE FROM check_templates WHERE id = ?",
+		} {
+			if _, err := tx.Exec(query, id); err != nil {
+				fmt.Printf("Error deleting check template %s: %v\n", name, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			fmt.Printf("Error deleting check template %s: %v\n", name, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		recordEvent(eventConfig, "", "Check template "+name+" removed by "+requestActor(r), nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleSetWebsiteTemplate serves PUT /api/websites/template with
+// {"url": "...", "template": "standard"}, or "template": null to remove it.
+func handleSetWebsiteTemplate(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL      string  `json:"url"`
+			Template *string `json:"template"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.URL == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+
+		var templateID *int
+		if body.Template != nil {
+			var id int
+			err := db.QueryRow("SELECT id FROM check_templates WHERE name = ?", *body.Template).Scan(&id)
+			if err == sql.ErrNoRows {
+				writeError(w, http.StatusNotFound, "check template not found")
+				return
+			}
+			if err != nil {
+				fmt.Printf("Error getting check template %s: %v\n", *body.Template, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			templateID = &id
+		}
+
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM websites WHERE website_url = ?)", body.URL).Scan(&exists)
+		if err != nil {
+			fmt.Printf("Error getting website %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+		if _, err := db.Exec("UPDATE websites SET template_id = ? WHERE website_url = ?", templateID, body.URL); err != nil {
+			fmt.Printf("Error setting check template for %s: %v\n", body.URL, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		recordEvent(eventConfig, body.URL, "Check template changed by "+requestActor(r), map[string]any{"template": body.Template})
+		writeJSON(w, http.StatusOK, body)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// TOTP as in RFC 6238: SHA-1, 30 second steps and 6 digits, which is what
+// every authenticator app supports.
+const totpStep = 30
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() string {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+func totpURL(secret, email string) string {
+	label := neturl.PathEscape("UptimeMonitor:" + email)
+	return fmt.Sprintf("otpauth://totp/%s?secret=%s&issuer=UptimeMonitor", label, secret)
+}
+
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// verifyTOTP checks a code against the current step and one step either side
+// to allow for clock drift. It returns the matched step so callers can refuse
+// to accept the same code twice; codes for steps up to lastStep are rejected.
+func verifyTOTP(secret, code string, lastStep int64) (int64, bool) {
+	return verifyTOTPAt(secret, code, lastStep, time.Now())
+}
+
+func verifyTOTPAt(secret, code string, lastStep int64, at time.Time) (int64, bool) {
+	now := at.Unix() / totpStep
+	for step := now - 1; step <= now+1; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA-1 secret of RFC 6238 appendix B, "12345678901234567890".
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the RFC 6238 SHA-1 test vectors.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(testTOTPSecret, tt.unix/totpStep)
+		if err != nil {
+			t.Fatalf("totpCode(%d) error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	step := at.Unix() / totpStep
+
+	code := func(step int64) string {
+		c, err := totpCode(testTOTPSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", "005924", 0, step, true},
+		{"previous step", code(step - 1), 0, step - 1, true},
+		{"next step", code(step + 1), 0, step + 1, true},
+		{"two steps back", code(step - 2), 0, 0, false},
+		{"two steps ahead", code(step + 2), 0, 0, false},
+		{"wrong code", "123456", 0, 0, false},
+		{"replayed code", "005924", step, 0, false},
+		{"code before last step", code(step - 1), step, 0, false},
+		{"code after last step", code(step + 1), step, step + 1, true},
+	}
+
+	for _, tt := range tests {
+		gotStep, gotOK := verifyTOTPAt(testTOTPSecret, tt.code, tt.lastStep, at)
+		if gotStep != tt.wantStep || gotOK != tt.wantOK {
+			t.Errorf("%s: verifyTOTPAt = %d, %t, want %d, %t", tt.name, gotStep, gotOK, tt.wantStep, tt.wantOK)
+		}
+	}
+
+	if _, ok := verifyTOTPAt("not base32!", "005924", 0, at); ok {
+		t.Error("invalid secret accepted")
+	}
+}
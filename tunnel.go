@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshClientKey identifies a jump host connection. Websites that use the same
+// jump host with different keys get their own connection.
+type sshClientKey struct {
+	jumpHost string
+	keyPath  string
+}
+
+var (
+	sshClientsMu sync.Mutex
+	sshClients   = make(map[sshClientKey]*ssh.Client)
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// checkDialer returns how a check connects to its target: directly, over the
+// network profile of the website, or through the SSH jump host configured for
+// the website (user@host[:port]).
+func checkDialer(settings websiteSettings) dialFunc {
+	if settings.JumpHost == "" {
+		if settings.Network != nil {
+			return settings.Network.dialer().DialContext
+		}
+		d := &net.Dialer{Timeout: 30 * time.Second}
+		return d.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, err := sshClient(settings.JumpHost, settings.SSHKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("ssh jump host %s: %v", settings.JumpHost, err)
+		}
+
+		conn, err := client.DialContext(ctx, network, addr)
+		if err != nil {
+			// A refused channel means the jump host couldn't reach the target,
+			// the connection itself is fine and other checks may be using it.
+			// Anything else may mean it died, start over next time.
+			var channelErr *ssh.OpenChannelError
+			if !errors.As(err, &channelErr) && ctx.Err() == nil {
+				dropSSHClient(settings.JumpHost, settings.SSHKeyPath, client)
+			}
+			return nil, fmt.Errorf("ssh jump host %s: %v", settings.JumpHost, err)
+		}
+		return conn, nil
+	}
+}
+
+// dialTLS opens a TLS connection to addr the same way checks reach the website.
+func dialTLS(settings websiteSettings, addr string) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rawConn, err := checkDialer(settings)(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	conn := tls.Client(rawConn, &tls.Config{ServerName: host})
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sshClient returns a connection to the jump host, reusing it between checks.
+// Host keys are verified against SSH_KNOWN_HOSTS (~/.ssh/known_hosts by default).
+// The dial happens outside the lock, so a slow jump host doesn't hold up
+// checks that go through other ones.
+func sshClient(jumpHost, keyPath string) (*ssh.Client, error) {
+	cacheKey := sshClientKey{jumpHost: jumpHost, keyPath: keyPath}
+	sshClientsMu.Lock()
+	client, ok := sshClients[cacheKey]
+	sshClientsMu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	user, addr, ok := strings.Cut(jumpHost, "@")
+	if !ok {
+		return nil, fmt.Errorf("jump host must look like user@host[:port]")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	if keyPath == "" {
+		keyPath = os.Getenv("SSH_KEY_PATH")
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	knownHostsPath := os.Getenv("SSH_KNOWN_HOSTS")
+	if knownHostsPath == "" {
+		home, _ := os.UserHomeDir()
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err = ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         15 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sshClientsMu.Lock()
+	defer sshClientsMu.Unlock()
+	// Another check may have connected in the meantime, keep one connection.
+	if existing, ok := sshClients[cacheKey]; ok {
+		client.Close()
+		return existing, nil
+	}
+	sshClients[cacheKey] = client
+	return client, nil
+}
+
+func dropSSHClient(jumpHost, keyPath string, client *ssh.Client) {
+	sshClientsMu.Lock()
+	defer sshClientsMu.Unlock()
+
+	cacheKey := sshClientKey{jumpHost: jumpHost, keyPath: keyPath}
+	if sshClients[cacheKey] == client {
+		delete(sshClients, cacheKey)
+		client.Close()
+	}
+}
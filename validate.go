@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type validation struct {
+	errors   int
+	warnings int
+}
+
+func (v *validation) ok(format string, args ...any) {
+	fmt.Printf("OK       "+format+"\n", args...)
+}
+
+func (v *validation) warn(format string, args ...any) {
+	v.warnings++
+	fmt.Printf("WARNING  "+format+"\n", args...)
+}
+
+func (v *validation) fail(format string, args ...any) {
+	v.errors++
+	fmt.Printf("ERROR    "+format+"\n", args...)
+}
+
+// runValidate checks the configuration the way the daemon would use it, for
+// `uptimemonitor validate` before starting it under systemd. It returns the
+// exit code: 1 when anything is wrong enough to keep the monitor from working.
+func runValidate() int {
+	v := &validation{}
+
+	if err := godotenv.Load(); err != nil {
+		v.warn(".env not loaded (%v), using the environment only", err)
+	} else {
+		v.ok(".env loaded")
+	}
+
+	v.checkEnv()
+	v.checkKeys()
+	db := v.checkDatabase()
+	if db != nil {
+		v.checkSchema(db)
+		db.Close()
+	}
+	v.checkReadReplica()
+	v.checkSlack()
+	v.checkSMTP()
+	v.checkAtlas()
+
+	fmt.Printf("\n%d errors, %d warnings\n", v.errors, v.warnings)
+	if v.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (v *validation) checkEnv() {
+	for _, name := range []string{"DB_USERNAME", "DB_NAME", "DB_SERVER", "DB_PORT"} {
+		if os.Getenv(name) == "" {
+			v.fail("%s is not set, the monitor can't reach its database", name)
+		}
+	}
+	if os.Getenv("SLACK_WEBHOOK_URL") == "" {
+		v.warn("SLACK_WEBHOOK_URL is not set, no Slack alerts will be sent")
+	}
+	if os.Getenv("SMTP_SERVER") == "" {
+		v.warn("SMTP_SERVER is not set, no emails will be sent")
+	} else {
+		for _, name := range []string{"SMTP_PORT", "SENDER_EMAIL"} {
+			if os.Getenv(name) == "" {
+				v.fail("%s is not set but SMTP_SERVER is", name)
+			}
+		}
+	}
+
+	if (os.Getenv("API_ADDR") == "") != (os.Getenv("API_TOKEN") == "") {
+		v.fail("set both API_ADDR and API_TOKEN to start the API, or neither")
+	}
+	if os.Getenv("API_ADDR") != "" && publicURL() == "" && os.Getenv("OIDC_PROVIDERS") != "" {
+		v.fail("PUBLIC_URL is required for OIDC_PROVIDERS, it is the base of the callback URLs")
+	}
+
+	if s := os.Getenv("CHECK_JITTER"); s != "" {
+		if f, err := strconv.ParseFloat(s, 64); err != nil || f < 0 || f >= 1 {
+			v.fail("CHECK_JITTER %q must be a fraction from 0 up to 1, e.g. 0.1", s)
+		}
+	}
+	if s := os.Getenv("CHECK_OUTPUT"); s != "" && s != "ndjson" {
+		v.fail("CHECK_OUTPUT %q is unknown, the only output is ndjson", s)
+	}
+	if s := os.Getenv("MAX_REDIRECTS"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil || n < 0 {
+			v.fail("MAX_REDIRECTS %q must be a whole number, 0 or more", s)
+		}
+	}
+	for _, name := range []string{"CHECK_CONCURRENCY", "MAX_BODY_BYTES"} {
+		if s := os.Getenv(name); s != "" {
+			if n, err := strconv.ParseInt(s, 10, 64); err != nil || n <= 0 {
+				v.fail("%s %q must be a positive whole number", name, s)
+			}
+		}
+	}
+	for _, name := range []string{"ALERT_DEDUP_WINDOW", "SLACK_DEDUP_WINDOW", "EMAIL_DEDUP_WINDOW", "PUSH_DEDUP_WINDOW", "WEBPUSH_DEDUP_WINDOW"} {
+		if s := os.Getenv(name); s != "" {
+			if _, err := time.ParseDuration(s); err != nil {
+				v.fail("%s %q is not a duration, use e.g. 10m or 1h", name, s)
+			}
+		}
+	}
+}
+
+func (v *validation) checkKeys() {
+	if os.Getenv("DKIM_PRIVATE_KEY_PATH") != "" {
+		if err := loadDKIM(); err != nil {
+			v.fail("DKIM key: %v", err)
+		} else if dkimKey == nil {
+			v.fail("DKIM_PRIVATE_KEY_PATH is set but DKIM_DOMAIN or DKIM_SELECTOR isn't")
+		} else {
+			v.ok("DKIM key loaded for %s._domainkey.%s", dkimSelector, dkimDomain)
+		}
+	}
+
+	if err := loadPush(); err != nil {
+		v.fail("push notifications: %v", err)
+	}
+	for platform, p := range pushProviders {
+		if err := p.Verify(); err != nil {
+			v.fail("%s credentials were rejected: %v", platform, err)
+		} else {
+			v.ok("%s credentials accepted", platform)
+		}
+	}
+
+	if err := loadSLAKey(); err != nil {
+		v.fail("SLA signing key: %v", err)
+	} else if slaKey != nil {
+		v.ok("SLA signing key loaded")
+	}
+
+	if err := loadVAPID(); err != nil {
+		v.fail("VAPID key: %v", err)
+	} else if vapidKey != nil {
+		v.ok("VAPID key loaded")
+	}
+}
+
+func (v *validation) checkDatabase() *sql.DB {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&loc=Local", os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_SERVER"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		v.fail("database: %v", err)
+		return nil
+	}
+	db.SetConnMaxLifetime(10 * time.Second)
+
+	if err := db.Ping(); err != nil {
+		v.fail("can't connect to the database at %s:%s: %v", os.Getenv("DB_SERVER"), os.Getenv("DB_PORT"), err)
+		db.Close()
+		return nil
+	}
+	v.ok("connected to database %s", os.Getenv("DB_NAME"))
+	return db
+}
+
+func (v *validation) checkReadReplica() {
+	dsn := os.Getenv("DB_READ_DSN")
+	if dsn == "" {
+		return
+	}
+	db, err := openReadReplica(dsn)
+	if err != nil {
+		v.warn("can't connect to the read replica, the monitor will read from the primary: %v", err)
+		return
+	}
+	defer db.Close()
+	v.ok("connected to the read replica")
+}
+
+func (v *validation) checkSchema(db *sql.DB) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		v.warn("no schema version found (%v), the monitor will create the schema on its first start", err)
+		return
+	}
+
+	switch {
+	case version == len(migrations):
+		v.ok("schema is up to date (version %d)", version)
+	case version < len(migrations):
+		v.warn("schema is at version %d, the monitor will migrate it to %d on start", version, len(migrations))
+	default:
+		v.fail("schema is at version %d but this build only knows %d, it is older than the database", version, len(migrations))
+	}
+
+	var websites int
+	if err := db.QueryRow("SELECT COUNT(*) FROM websites").Scan(&websites); err != nil {
+		v.fail("websites table: %v", err)
+	} else if websites == 0 {
+		v.warn("there are no websites to check yet")
+	} else {
+		v.ok("%d websites to check", websites)
+	}
+}
+
+// checkSlack posts an empty payload, which Slack answers with 400 no_text for
+// a working webhook without posting anything.
+func (v *validation) checkSlack() {
+	url := os.Getenv("SLACK_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		v.fail("can't reach the Slack webhook: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "no_text"):
+		v.ok("Slack webhook is valid")
+	case resp.StatusCode == http.StatusOK:
+		v.ok("Slack webhook answered %s", resp.Status)
+	default:
+		v.fail("Slack webhook answered %s: %s, it may have been revoked or rotated", resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+// checkSMTP connects and logs in without sending anything.
+func (v *validation) checkSMTP() {
+	server, port := os.Getenv("SMTP_SERVER"), os.Getenv("SMTP_PORT")
+	if server == "" || port == "" {
+		return
+	}
+	addr := net.JoinHostPort(server, port)
+
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		v.fail("can't reach SMTP server %s: %v", addr, err)
+		return
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	c, err := smtp.NewClient(conn, server)
+	if err != nil {
+		conn.Close()
+		v.fail("SMTP server %s: %v", addr, err)
+		return
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: server}); err != nil {
+			v.fail("SMTP STARTTLS with %s: %v", addr, err)
+			return
+		}
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		if err := c.Auth(smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), server)); err != nil {
+			v.fail("SMTP login as %s failed: %v, check SMTP_USERNAME and SMTP_PASSWORD", username, err)
+			return
+		}
+	}
+	c.Quit()
+
+	v.ok("SMTP server %s accepted the login", addr)
+}
+
+// checkAtlas reads the credit balance. Keys that may only create measurements
+// can't, so that is a warning.
+func (v *validation) checkAtlas() {
+	key := os.Getenv("RIPE_ATLAS_KEY")
+	if key == "" {
+		return
+	}
+
+	var credits struct {
+		CurrentBalance int `json:"current_balance"`
+	}
+	if err := atlasRequest(key, http.MethodGet, "/credits/", nil, &credits); err != nil {
+		v.warn("can't read the RIPE Atlas credits with RIPE_ATLAS_KEY: %v", err)
+		return
+	}
+	v.ok("RIPE Atlas key accepted, %d credits left", credits.CurrentBalance)
+}
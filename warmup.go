@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// coldStart reports why the first request to a website after an idle period
+// looks like it hit a cold start, or "" when it doesn't. Serverless and
+// auto-scaled backends often fail or time out while an instance starts, or
+// answer 502/503 while one is scaled in, so such a request is retried once
+// before the check records anything. Set warmup_idle_seconds on the website
+// to turn this on, and warmup_slow_ms to also retry responses slower than that.
+func coldStart(settings websiteSettings, resp *http.Response, err error, elapsed time.Duration) string {
+	switch {
+	case err != nil:
+		return "failed: " + err.Error()
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable:
+		return "returned " + resp.Status
+	case settings.WarmUpSlow > 0 && elapsed > settings.WarmUpSlow:
+		return "took " + elapsed.Round(time.Millisecond).String()
+	}
+	return ""
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// vapidKey signs Web Push requests (VAPID_PRIVATE_KEY_PATH, a PEM P-256 key,
+// e.g. from openssl ecparam -name prime256v1 -genkey -noout). VAPID_SUBJECT is
+// the mailto: or https: contact push services reach out to.
+var (
+	vapidKey     *ecdsa.PrivateKey
+	vapidSubject string
+)
+
+// webPushClient only connects to public addresses, the endpoint of a
+// subscription comes from the browser.
+var webPushClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: publicAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func loadVAPID() error {
+	path := os.Getenv("VAPID_PRIVATE_KEY_PATH")
+	if path == "" {
+		return nil
+	}
+
+	key, err := readPrivateKey(path)
+	if err != nil {
+		return err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return errors.New("VAPID key is not an ECDSA key")
+	}
+	if _, err := ecKey.ECDH(); err != nil || ecKey.Curve.Params().BitSize != 256 {
+		return errors.New("VAPID key is not a P-256 key")
+	}
+
+	vapidKey = ecKey
+	vapidSubject = os.Getenv("VAPID_SUBJECT")
+	if vapidSubject == "" {
+		vapidSubject = "mailto:" + os.Getenv("SENDER_EMAIL")
+	}
+	return nil
+}
+
+// vapidPublicKey is the applicationServerKey browsers subscribe with.
+func vapidPublicKey() string {
+	pub, _ := vapidKey.PublicKey.ECDH()
+	return base64.RawURLEncoding.EncodeToString(pub.Bytes())
+}
+
+type webPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// encryptWebPush encrypts a payload for a subscription as aes128gcm content
+// (RFC 8188) with the keys of RFC 8291.
+func encryptWebPush(sub webPushSubscription, payload []byte) ([]byte, error) {
+	uaPublicBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %v", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublicBytes...), asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record, 0x02 marks it as the last one.
+	record := append(append([]byte(nil), payload...), 0x02)
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(4096))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	body.Write(gcm.Seal(nil, nonce, record, nil))
+	return body.Bytes(), nil
+}
+
+// sendWebPush delivers one notification. Gone reports whether the push
+// service has forgotten the subscription.
+func sendWebPush(sub webPushSubscription, payload []byte) (bool, error) {
+	endpoint, err := neturl.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" {
+		return true, fmt.Errorf("invalid endpoint %q", sub.Endpoint)
+	}
+
+	body, err := encryptWebPush(sub, payload)
+	if err != nil {
+		return true, err
+	}
+
+	token, err := signJWT(vapidKey, nil, map[string]any{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": vapidSubject,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+vapidPublicKey())
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+
+	resp, err := webPushClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	gone := resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+	return gone, fmt.Errorf("push service returned status %d: %s", resp.StatusCode, respBody)
+}
+
+// notifyWatchers sends a browser notification to every subscription of the
+// users watching the website.
+func notifyWatchers(db *sql.DB, url, title, body string) {
+	if vapidKey == nil || getWebsiteSettings(db, url).InMaintenance {
+		return
+	}
+
+	query := `SELECT webpush_subscriptions.id, webpush_subscriptions.endpoint, webpush_subscriptions.p256dh, webpush_subscriptions.auth
+		FROM webpush_subscriptions JOIN website_watchers ON website_watchers.user_id = webpush_subscriptions.user_id
+		WHERE website_watchers.website_url = ?`
+	rows, err := db.Query(query, url)
+	if err != nil {
+		fmt.Printf("Error getting web push subscriptions for %s: %v\n", url, err)
+		return
+	}
+	type subscription struct {
+		id int
+		webPushSubscription
+	}
+	var subs []subscription
+	for rows.Next() {
+		var s subscription
+		if err := rows.Scan(&s.id, &s.Endpoint, &s.Keys.P256dh, &s.Keys.Auth); err != nil {
+			fmt.Printf("Error getting web push subscriptions for %s: %v\n", url, err)
+			rows.Close()
+			return
+		}
+		subs = append(subs, s)
+	}
+	rows.Close()
+
+	payload, err := json.Marshal(map[string]string{"title": title, "body": body, "url": url})
+	if err != nil {
+		return
+	}
+
+	for _, s := range subs {
+		recipient := fmt.Sprintf("subscription %d", s.id)
+		if !shouldDeliver("webpush", s.Endpoint, title+"\n"+body) {
+			recordSkippedNotification("webpush", recipient, title, "duplicate")
+			continue
+		}
+
+		var gone bool
+		attempts, err := retryDelivery(func() error {
+			var err error
+			gone, err = sendWebPush(s.webPushSubscription, payload)
+			if gone {
+				return nil
+			}
+			return err
+		})
+		if gone {
+			fmt.Printf("Removing web push subscription %d: %v\n", s.id, err)
+			if _, err := db.Exec("DELETE FROM webpush_subscriptions WHERE id = ?", s.id); err != nil {
+				fmt.Printf("Error removing web push subscription %d: %v\n", s.id, err)
+			}
+			continue
+		}
+		recordNotification("webpush", recipient, title, attempts, err)
+		if err != nil {
+			fmt.Printf("Error sending web push for %s: %v\n", url, err)
+		}
+	}
+}
+
+// webPushWorker is a service worker the dashboard can register to show the
+// notifications.
+const webPushWorker = `self.addEventListener("push", (event) => {
+  const data = event.data ? event.data.json() : {};
+  event.waitUntil(self.registration.showNotification(data.title || "UptimeMonitor", {
+    body: data.body,
+    data: { url: data.url },
+    tag: data.url,
+  }));
+});
+
+self.addEventListener("notificationclick", (event) => {
+  event.notification.close();
+});
+`
+
+func handleWebPushWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	fmt.Fprint(w, webPushWorker)
+}
+
+// handleWebPushKey serves GET /api/webpush/key with the public VAPID key.
+func handleWebPushKey(w http.ResponseWriter, r *http.Request) {
+	if vapidKey == nil {
+		writeError(w, http.StatusNotFound, "web push is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"public_key": vapidPublicKey()})
+}
+
+// handleWebPushSubscribe serves POST /api/webpush/subscriptions with the
+// PushSubscription of the browser, as returned by PushManager.subscribe.
+func handleWebPushSubscribe(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "subscriptions can only be added by a signed in user")
+			return
+		}
+
+		var sub webPushSubscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil || sub.Endpoint == "" || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+			writeError(w, http.StatusBadRequest, "endpoint, keys.p256dh and keys.auth are required")
+			return
+		}
+		endpoint, err := neturl.Parse(sub.Endpoint)
+		if _, encErr := encryptWebPush(sub, nil); encErr != nil || err != nil || endpoint.Scheme != "https" || endpoint.Host == "" || len(sub.Endpoint) > 1024 {
+			writeError(w, http.StatusBadRequest, "invalid subscription")
+			return
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(r.Context(), endpoint.Hostname())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("resolving %s: %v", endpoint.Hostname(), err))
+			return
+		}
+		for _, addr := range addrs {
+			if !publicIP(addr.IP) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s resolves to %s, which is not a public address", endpoint.Hostname(), addr.IP))
+				return
+			}
+		}
+
+		query := "INSERT INTO webpush_subscriptions (user_id, endpoint, endpoint_hash, p256dh, auth, created_at) VALUES (?, ?, ?, ?, ?, NOW()) ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), p256dh = VALUES(p256dh), auth = VALUES(auth)"
+		if _, err := db.Exec(query, userID, sub.Endpoint, hashToken(sub.Endpoint), sub.Keys.P256dh, sub.Keys.Auth); err != nil {
+			fmt.Printf("Error saving web push subscription for user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// handleWebPushUnsubscribe serves DELETE /api/webpush/subscriptions?endpoint=...
+func handleWebPushUnsubscribe(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "not signed in")
+			return
+		}
+
+		endpoint := r.URL.Query().Get("endpoint")
+		_, err := db.Exec("DELETE FROM webpush_subscriptions WHERE endpoint_hash = ? AND user_id = ?", hashToken(endpoint), userID)
+		if err != nil {
+			fmt.Printf("Error deleting web push subscription for user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleListWatched serves GET /api/watch with the websites the signed in
+// user gets notifications for.
+func handleListWatched(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "not signed in")
+			return
+		}
+
+		rows, err := db.Query("SELECT website_url FROM website_watchers WHERE user_id = ? ORDER BY website_url", userID)
+		if err != nil {
+			fmt.Printf("Error getting watched websites for user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		defer rows.Close()
+
+		urls := []string{}
+		for rows.Next() {
+			var url string
+			if err := rows.Scan(&url); err != nil {
+				fmt.Printf("Error getting watched websites for user %d: %v\n", userID, err)
+				writeError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			urls = append(urls, url)
+		}
+
+		writeJSON(w, http.StatusOK, urls)
+	}
+}
+
+// handleWatch serves PUT and DELETE /api/watch?url=... to start and stop
+// watching a website.
+func handleWatch(db *sql.DB, watch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUser(r)
+		if !ok {
+			writeError(w, http.StatusForbidden, "not signed in")
+			return
+		}
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			writeError(w, http.StatusBadRequest, "url is required")
+			return
+		}
+
+		if watch && !allowedWebsite(db, r, url) {
+			writeError(w, http.StatusNotFound, "website not found")
+			return
+		}
+
+		query := "DELETE FROM website_watchers WHERE user_id = ? AND website_url = ?"
+		if watch {
+			query = "INSERT IGNORE INTO website_watchers (user_id, website_url) VALUES (?, ?)"
+		}
+		if _, err := db.Exec(query, userID, url); err != nil {
+			fmt.Printf("Error updating watched websites for user %d: %v\n", userID, err)
+			writeError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// The user agent keys of RFC 8291 appendix A.
+const (
+	testUAPrivateKey = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	testUAPublicKey  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	testAuthSecret   = "BTBZMqHH6r4Tts7J_aSIgg"
+)
+
+// decryptWebPush undoes encryptWebPush the way a browser does.
+func decryptWebPush(t *testing.T, uaPrivate *ecdh.PrivateKey, authSecret, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 {
+		t.Fatalf("body too short: %d bytes", len(body))
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != 4096 {
+		t.Errorf("record size = %d, want 4096", rs)
+	}
+	idlen := int(body[20])
+	asPublicBytes := body[21 : 21+idlen]
+	ciphertext := body[21+idlen:]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		t.Fatalf("invalid sender key: %v", err)
+	}
+	ecdhSecret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPrivate.PublicKey().Bytes()...), asPublicBytes...)
+	ikm := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), ikm)
+	cek := make([]byte, 16)
+	io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek)
+	nonce := make([]byte, 12)
+	io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypting: %v", err)
+	}
+	if len(record) == 0 || record[len(record)-1] != 0x02 {
+		t.Fatalf("record is not padded as the last record: %x", record)
+	}
+	return record[:len(record)-1]
+}
+
+func TestEncryptWebPush(t *testing.T) {
+	privateBytes, _ := base64.RawURLEncoding.DecodeString(testUAPrivateKey)
+	uaPrivate, err := ecdh.P256().NewPrivateKey(privateBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicBytes, _ := base64.RawURLEncoding.DecodeString(testUAPublicKey)
+	if !bytes.Equal(uaPrivate.PublicKey().Bytes(), publicBytes) {
+		t.Fatal("test keys don't match")
+	}
+	authSecret, _ := base64.RawURLEncoding.DecodeString(testAuthSecret)
+
+	var sub webPushSubscription
+	sub.Endpoint = "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV"
+	sub.Keys.P256dh = testUAPublicKey
+	sub.Keys.Auth = testAuthSecret
+
+	tests := []string{
+		"When I grow up, I want to be a watermelon",
+		"",
+		`{"title":"https://example.com is down","body":"Status 503"}`,
+	}
+
+	for _, payload := range tests {
+		body, err := encryptWebPush(sub, []byte(payload))
+		if err != nil {
+			t.Fatalf("encryptWebPush(%q) error: %v", payload, err)
+		}
+		if got := decryptWebPush(t, uaPrivate, authSecret, body); string(got) != payload {
+			t.Errorf("round trip of %q = %q", payload, got)
+		}
+	}
+}
+
+func TestEncryptWebPushKeys(t *testing.T) {
+	var sub webPushSubscription
+	sub.Keys.P256dh = testUAPublicKey
+	sub.Keys.Auth = testAuthSecret + "=="
+	if _, err := encryptWebPush(sub, []byte("hi")); err != nil {
+		t.Errorf("padded auth secret: %v", err)
+	}
+
+	sub.Keys.P256dh = "not a key"
+	if _, err := encryptWebPush(sub, []byte("hi")); err == nil {
+		t.Error("invalid p256dh key accepted")
+	}
+}
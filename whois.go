@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+var whoisInterval = 24 * time.Hour
+
+// whoisExpiryFields are the labels registries use for the expiry date.
+var whoisExpiryFields = []string{
+	"registry expiry date:",
+	"registrar registration expiration date:",
+	"expiration date:",
+	"expiry date:",
+	"expires:",
+	"expire:",
+	"paid-till:",
+}
+
+var whoisDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006.01.02",
+	"02-Jan-2006",
+	"02.01.2006",
+}
+
+func runWhoisChecks(db *sql.DB) error {
+	websites, err := getWebsiteURLs(db)
+	if err != nil {
+		return fmt.Errorf("fetching website URLs: %v", err)
+	}
+
+	var domains []string
+	urls := make(map[string][]string)
+	for _, url := range websites {
+		domain, err := registeredDomain(url)
+		if err != nil {
+			fmt.Printf("Error getting domain of %s: %v\n", url, err)
+			continue
+		}
+		if urls[domain] == nil {
+			domains = append(domains, domain)
+		}
+		urls[domain] = append(urls[domain], url)
+	}
+
+	for _, domain := range domains {
+		whoisDomain(db, domain, urls[domain])
+	}
+	return nil
+}
+
+// registeredDomain returns the registered domain of a website in punycode,
+// e.g. xn--bcher-kva.example for https://shop.bücher.example.
+func registeredDomain(rawURL string) (string, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return publicsuffix.EffectiveTLDPlusOne(asciiHost(u.Hostname()))
+}
+
+// whoisDomain looks up when a domain expires and stores it for every website
+// on the domain.
+func whoisDomain(db *sql.DB, domain string, urls []string) {
+	tld := domain[strings.LastIndex(domain, ".")+1:]
+	server := "whois.iana.org"
+	response, err := whoisQuery(server, tld)
+	if err != nil {
+		fmt.Printf("Error querying %s for %s: %v\n", server, tld, err)
+		return
+	}
+	if refer := whoisField(response, []string{"refer:", "whois:"}); refer != "" {
+		server = refer
+	}
+
+	response, err = whoisQuery(server, domain)
+	if err != nil {
+		fmt.Printf("Error querying %s for %s: %v\n", server, domain, err)
+		return
+	}
+
+	expiry, ok := parseWhoisDate(whoisField(response, whoisExpiryFields))
+	if !ok {
+		fmt.Printf("No expiry date found in WHOIS of %s\n", domain)
+		return
+	}
+
+	for _, url := range urls {
+		_, err = db.Exec("UPDATE websites SET domain_expiry_date = ? WHERE website_url = ?", expiry, url)
+		if err != nil {
+			fmt.Printf("Error updating domain expiry for %s: %v\n", url, err)
+		}
+	}
+}
+
+func whoisQuery(server, query string) (string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(server, "43"), 15*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", query); err != nil {
+		return "", err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	return string(data), err
+}
+
+// whoisField returns the value of the first line starting with one of the
+// labels, compared case-insensitively.
+func whoisField(response string, labels []string) string {
+	for _, label := range labels {
+		scanner := bufio.NewScanner(strings.NewReader(response))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(strings.ToLower(line), label) {
+				if value := strings.TrimSpace(line[len(label):]); value != "" {
+					return value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func parseWhoisDate(value string) (time.Time, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	value = fields[0]
+	for _, layout := range whoisDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWhoisDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"2027-03-01T04:00:00Z", time.Date(2027, 3, 1, 4, 0, 0, 0, time.UTC), true},
+		{"2027-03-01T04:00:00.0Z", time.Date(2027, 3, 1, 4, 0, 0, 0, time.UTC), true},
+		// Only the date is kept, the time is a separate field.
+		{"2027-03-01 04:00:00", time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2027-03-01", time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2027.03.01", time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"01-Mar-2027", time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"01.03.2027", time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"  2027-03-01 (registrar)", time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"", time.Time{}, false},
+		{"   ", time.Time{}, false},
+		{"never", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseWhoisDate(tt.value)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseWhoisDate(%q) = %v, %t, want %v, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWhoisField(t *testing.T) {
+	response := "Domain Name: EXAMPLE.COM\r\nRegistry Expiry Date: 2027-08-13T04:00:00Z\r\nexpires: \r\nRegistrar: Example\r\n"
+
+	tests := []struct {
+		labels []string
+		want   string
+	}{
+		{whoisExpiryFields, "2027-08-13T04:00:00Z"},
+		{[]string{"registrar:"}, "Example"},
+		{[]string{"expires:"}, ""},
+		{[]string{"paid-till:"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := whoisField(response, tt.labels); got != tt.want {
+			t.Errorf("whoisField(%v) = %q, want %q", tt.labels, got, tt.want)
+		}
+	}
+}